@@ -3,8 +3,14 @@ package main
 import (
 	"context"
 	"flag"
+	"time"
+
+	// embed the time zone database for the active windows of selectors
+	_ "time/tzdata"
 
 	"eci.io/eci-profile/pkg/client/clientset/versioned"
+	"eci.io/eci-profile/pkg/metrics"
+	"eci.io/eci-profile/pkg/policy"
 	"eci.io/eci-profile/pkg/profile"
 
 	"k8s.io/client-go/kubernetes"
@@ -19,14 +25,60 @@ func main() {
 	var caKeyPath string
 	var qps float64
 	var burst int
+	var virtualNodeSelector string
+	var virtualNodeTolerations string
+	var metricsAddress string
+	var driftReconcilePeriod time.Duration
+	var driftReconcileQPS float64
+	var deletionCostRanking string
+	var failurePatterns string
+	var fallbackCooldown time.Duration
+	var breakerProbePeriod time.Duration
+	var breakerWindow time.Duration
+	var breakerFailureRatio float64
 	flag.StringVar(&kubeConfig, "kubeconfig", "", "Path to a kubeConfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&caCertPath, "cacert", "", "Path to CA cert file in PEM format. Only for self-defined CA.")
 	flag.StringVar(&caKeyPath, "cakey", "", "Path to CA key file in PEM format. Only for self-defined CA.")
 	flag.Float64Var(&qps, "client-qps", 500, "k8s client maximum qps for throttle, default qps: 500")
 	flag.IntVar(&burst, "client-burst", 1000, "k8s client maximum burst for throttle, default burst: 1000.")
+	flag.StringVar(&virtualNodeSelector, "virtual-node-selector", policy.DefaultVirtualNodeSelector, "Comma separated key=value node labels to identify virtual nodes.")
+	flag.StringVar(&virtualNodeTolerations, "virtual-node-tolerations", policy.DefaultVirtualNodeTolerations, "Comma separated key[=value][:effect] tolerations required by virtual nodes.")
+	flag.StringVar(&metricsAddress, "metrics-address", ":8080", "The address serving the prometheus metrics, empty to disable it.")
+	flag.DurationVar(&driftReconcilePeriod, "drift-reconcile-period", 5*time.Minute, "How often the running pods on virtual nodes are reconciled with the effect of the selectors opting in, 0 to disable it.")
+	flag.Float64Var(&driftReconcileQPS, "drift-reconcile-qps", 5, "The maximum number of drifted pods patched per second.")
+	flag.StringVar(&deletionCostRanking, "deletion-cost-ranking", "", "Keep the pod deletion cost of ReplicaSets with pods on virtual nodes, ranking the pods on virtual nodes by price or age, empty to disable it.")
+	flag.StringVar(&failurePatterns, "fallback-failure-patterns", profile.DefaultFailurePatterns, "Comma separated case-insensitive regular expressions matching the status reason, message or warning events of the pods ECI failed to create.")
+	flag.DurationVar(&fallbackCooldown, "fallback-cooldown", 0, "How long the replacements of the pods failed on virtual nodes avoid virtual nodes, e.g. 30m, 0 disables the fallback.")
+	flag.DurationVar(&breakerProbePeriod, "breaker-probe-period", 0, "How long the breaker of an unhealthy virtual node stays open before it's half-opened, e.g. 5m, 0 disables the breakers.")
+	flag.DurationVar(&breakerWindow, "breaker-window", 10*time.Minute, "How long the outcomes of the pods on a virtual node are counted in its failure ratio.")
+	flag.Float64Var(&breakerFailureRatio, "breaker-failure-ratio", 0.5, "The ratio of the pods failed on a virtual node in the window opening its breaker, 0 to open it only when the node is not ready.")
 	flag.Parse()
 
+	if driftReconcileQPS <= 0 {
+		klog.Fatalf("drift-reconcile-qps must be positive, but got %v", driftReconcileQPS)
+	}
+	if breakerFailureRatio < 0 || breakerFailureRatio > 1 {
+		klog.Fatalf("breaker-failure-ratio must be in [0, 1], but got %v", breakerFailureRatio)
+	}
+	switch deletionCostRanking {
+	case "", profile.DeletionCostRankingPrice, profile.DeletionCostRankingAge:
+	default:
+		klog.Fatalf("deletion-cost-ranking must be %s or %s, but got %s", profile.DeletionCostRankingPrice, profile.DeletionCostRankingAge, deletionCostRanking)
+	}
+	virtualNodeLabels, err := policy.ParseNodeSelector(virtualNodeSelector)
+	if err != nil {
+		klog.Fatalf("failed to parse virtual node selector: %q", err)
+	}
+	tolerations, err := policy.ParseTolerations(virtualNodeTolerations)
+	if err != nil {
+		klog.Fatalf("failed to parse virtual node tolerations: %q", err)
+	}
+	patterns, err := profile.ParseFailurePatterns(failurePatterns)
+	if err != nil {
+		klog.Fatalf("failed to parse fallback failure patterns: %q", err)
+	}
+
 	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeConfig)
 	if err != nil {
 		klog.Fatalf("failed to build client config: %q", err)
@@ -43,18 +95,32 @@ func main() {
 	}
 
 	profileConfig := &profile.Config{
-		K8sClient:     k8sClient,
-		ProfileClient: profileClient,
-		CACertPath:    caKeyPath,
-		CAKeyPath:     caKeyPath,
+		K8sClient:              k8sClient,
+		ProfileClient:          profileClient,
+		CACertPath:             caKeyPath,
+		CAKeyPath:              caKeyPath,
+		VirtualNodeLabels:      virtualNodeLabels,
+		VirtualNodeTolerations: tolerations,
+		DriftReconcilePeriod:   driftReconcilePeriod,
+		DriftReconcileQPS:      driftReconcileQPS,
+		DeletionCostRanking:    deletionCostRanking,
+		FailurePatterns:        patterns,
+		FallbackCooldown:       fallbackCooldown,
+		BreakerProbePeriod:     breakerProbePeriod,
+		BreakerWindow:          breakerWindow,
+		BreakerFailureRatio:    breakerFailureRatio,
 	}
 	manager, err := profile.NewManager(profileConfig)
 	if err != nil {
 		klog.Fatalf("failed to create eci-profile manager: %q", err)
 	}
 
+	ctx := context.TODO()
+	if metricsAddress != "" {
+		go metrics.Serve(ctx, metricsAddress)
+	}
 	klog.Infof("ready to start eci-profile manager service")
-	if err := manager.Run(context.TODO()); err != nil {
+	if err := manager.Run(ctx); err != nil {
 		klog.Fatalf("run profile service failed: %q", err)
 	}
 }
@@ -0,0 +1,17 @@
+package v1
+
+const (
+	// AnnotationSelectorOptOut set to "true" on a pod or namespace opts the pods out of all selectors
+	AnnotationSelectorOptOut = "eci.aliyun.com/selector-opt-out"
+	// AnnotationSelector on a pod names the only selector which may be applied to it
+	AnnotationSelector = "eci.aliyun.com/selector"
+	// AnnotationRolloutKey is hashed into the rollout cohort of the pods whose
+	// name isn't generated yet when they are admitted
+	AnnotationRolloutKey = "eci.aliyun.com/rollout-key"
+	// AnnotationTrace records the selector which mutated the pod last, its
+	// value is a JSON object, see policy.Trace
+	AnnotationTrace = "eci.aliyun.com/profile-trace"
+	// AnnotationAvoidVirtualNode keeps the pod off virtual nodes until the
+	// RFC3339 time, it's set on the pods failed on ECI and their replacements
+	AnnotationAvoidVirtualNode = "eci.aliyun.com/avoid-virtual-node"
+)
@@ -6,34 +6,252 @@ import (
 )
 
 // +genclient
-// +genclient:noStatus
 // +genclient:nonNamespaced
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
 
 type Selector struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
-	Spec              SelectorSpec `json:"spec"`
+	Spec              SelectorSpec   `json:"spec"`
+	Status            SelectorStatus `json:"status,omitempty"`
 }
 
 type SelectorSpec struct {
 	NamespaceLabels *metav1.LabelSelector `json:"namespaceLabels,omitempty"`
 	ObjectLabels    *metav1.LabelSelector `json:"objectLabels,omitempty"`
-	Effect          *SideEffect           `json:"effect,omitempty"`
-	Policy          *PolicySource         `json:"policy,omitempty"`
-	Priority        *int32                `json:"priority,omitempty"`
+	// PodMatch matches the pod fields, it's ANDed with the label selectors
+	PodMatch *PodMatch `json:"podMatch,omitempty"`
+	// MatchCondition is a CEL expression evaluated against the pod and the
+	// namespace, e.g. pod.metadata.labels["owner"] == namespaceObject.metadata.annotations["team"]
+	MatchCondition string        `json:"matchCondition,omitempty"`
+	Effect         *SideEffect   `json:"effect,omitempty"`
+	Policy         *PolicySource `json:"policy,omitempty"`
+	Priority       *int32        `json:"priority,omitempty"`
+	// ActiveWindows limits the selector to these time windows, it's always
+	// active if empty
+	ActiveWindows []ActiveWindow `json:"activeWindows,omitempty"`
+	// RolloutPercent applies the selector to this percentage of the matched
+	// pods only, the others fall through to the next matched selector
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	RolloutPercent *int32 `json:"rolloutPercent,omitempty"`
+	// Mode decides whether the selector mutates the pods, defaults to Enforce
+	Mode SelectorMode `json:"mode,omitempty"`
+	// ReconcileDrift patches the effect annotations and labels missing in the
+	// running pods on virtual nodes, e.g. after they are added to the effect
+	ReconcileDrift bool `json:"reconcileDrift,omitempty"`
+	// DriftPolicy decides whether the reconciliation overwrites the effect
+	// keys the pods already have, defaults to AddMissing
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
 }
 
-type FairPolicySource struct{}
+// +kubebuilder:validation:Enum=AddMissing;Enforce
+type DriftPolicy string
+
+const (
+	// DriftPolicyAddMissing only adds the effect keys missing in the pods
+	DriftPolicyAddMissing DriftPolicy = "AddMissing"
+	// DriftPolicyEnforce also overwrites the existing keys by the merge policy
+	DriftPolicyEnforce DriftPolicy = "Enforce"
+)
+
+// +kubebuilder:validation:Enum=Enforce;Audit
+type SelectorMode string
+
+const (
+	// SelectorModeEnforce applies the effect and the policy to the pods
+	SelectorModeEnforce SelectorMode = "Enforce"
+	// SelectorModeAudit only records what the selector would change
+	SelectorModeAudit SelectorMode = "Audit"
+)
+
+// ActiveWindow is either a cron schedule with a duration, or a daily time
+// range on some weekdays.
+type ActiveWindow struct {
+	// Schedule is a cron expression starting the window, e.g. "0 9 * * 1-5"
+	Schedule string `json:"schedule,omitempty"`
+	// Duration is the length of the window started by the schedule
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// Days restricts the time range to these weekdays, e.g. Mon or Sat, every day if empty
+	Days []string `json:"days,omitempty"`
+	// Start is the beginning of the time range in HH:MM
+	Start string `json:"start,omitempty"`
+	// End is the end of the time range in HH:MM, the range crosses midnight if End isn't after Start
+	End string `json:"end,omitempty"`
+	// TimeZone is the IANA name of the time zone, defaults to UTC
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+type SelectorStatus struct {
+	// Active tells whether the selector is within its active windows
+	Active bool `json:"active,omitempty"`
+	// NextActivationTime is when the next active window begins
+	NextActivationTime *metav1.Time `json:"nextActivationTime,omitempty"`
+	// Audit summarizes what the selector would have changed in Audit mode
+	Audit *AuditStatus `json:"audit,omitempty"`
+	// Drift reports the running pods drifted from the effect
+	Drift *DriftStatus `json:"drift,omitempty"`
+}
+
+type DriftStatus struct {
+	// DriftedPods is the number of drifted pods found by the last reconciliation
+	DriftedPods int32 `json:"driftedPods"`
+	// ReconciledPods is the number of drifted pods patched so far
+	ReconciledPods int64 `json:"reconciledPods,omitempty"`
+	// LastReconcileTime is when the last reconciliation finished
+	LastReconcileTime *metav1.Time `json:"lastReconcileTime,omitempty"`
+}
+
+type AuditStatus struct {
+	// AuditedPods is the number of pods the selector would have mutated
+	AuditedPods int64 `json:"auditedPods,omitempty"`
+	// LastAuditTime is when the last pod was audited
+	LastAuditTime *metav1.Time `json:"lastAuditTime,omitempty"`
+	// LastPod is the namespace/name of the last audited pod
+	LastPod string `json:"lastPod,omitempty"`
+	// LastPhase is the phase in which the last pod was audited
+	LastPhase string `json:"lastPhase,omitempty"`
+	// LastPatch is the patch the selector would have applied to the last pod
+	LastPatch string `json:"lastPatch,omitempty"`
+}
+
+// PodMatch matches the pod fields, all the specified criteria are ANDed and
+// a list matches if it contains the value of the pod.
+type PodMatch struct {
+	// OwnerKinds matches the kind of the controller owner, e.g. Job or ReplicaSet
+	OwnerKinds []string `json:"ownerKinds,omitempty"`
+	// OwnerNames matches the name of the controller owner
+	OwnerNames          []string         `json:"ownerNames,omitempty"`
+	QOSClasses          []v1.PodQOSClass `json:"qosClasses,omitempty"`
+	PriorityClassNames  []string         `json:"priorityClassNames,omitempty"`
+	ServiceAccountNames []string         `json:"serviceAccountNames,omitempty"`
+	SchedulerNames      []string         `json:"schedulerNames,omitempty"`
+	// MinRequests matches the pods requesting at least these resources
+	MinRequests v1.ResourceList `json:"minRequests,omitempty"`
+	// MaxRequests matches the pods requesting at most these resources
+	MaxRequests v1.ResourceList `json:"maxRequests,omitempty"`
+	// MinLimits matches the pods limited to at least these resources
+	MinLimits v1.ResourceList `json:"minLimits,omitempty"`
+	// MaxLimits matches the pods limited to at most these resources
+	MaxLimits v1.ResourceList `json:"maxLimits,omitempty"`
+}
+
+type FairPolicySource struct {
+	// MaxVirtualNodeLifetime evicts the pods which have run on virtual nodes longer
+	MaxVirtualNodeLifetime *metav1.Duration `json:"maxVirtualNodeLifetime,omitempty"`
+}
 
 type NormalNodeOnlyPolicySource struct{}
 
 type NormalNodePreferPolicySource struct {
 	CPURatio    *int `json:"cpuRatio,omitempty"`
 	MemoryRatio *int `json:"memoryRatio,omitempty"`
+	// OverflowDelay is how long a pod stays unschedulable before it overflows
+	// to virtual nodes, giving the cluster autoscaler time to add normal nodes
+	OverflowDelay *metav1.Duration `json:"overflowDelay,omitempty"`
+	// OverflowReasons are the unschedulable reasons allowing the pods to
+	// overflow to virtual nodes, defaults to InsufficientCPU, InsufficientMemory
+	// and InsufficientPods
+	OverflowReasons []UnschedulableReason `json:"overflowReasons,omitempty"`
+	// Rebalance evicts the pods overflowed to virtual nodes once they fit on
+	// the normal nodes again
+	Rebalance *RebalancePolicy `json:"rebalance,omitempty"`
+	// MaxVirtualNodeLifetime evicts the pods which have run on virtual nodes longer
+	MaxVirtualNodeLifetime *metav1.Duration `json:"maxVirtualNodeLifetime,omitempty"`
+}
+
+// UnschedulableReason classifies why the scheduler failed to fit a pod on a node.
+// +kubebuilder:validation:Enum=InsufficientCPU;InsufficientMemory;InsufficientPods;InsufficientResource;Taint;Affinity;Volume;Port;Other
+type UnschedulableReason string
+
+const (
+	UnschedulableReasonInsufficientCPU    UnschedulableReason = "InsufficientCPU"
+	UnschedulableReasonInsufficientMemory UnschedulableReason = "InsufficientMemory"
+	UnschedulableReasonInsufficientPods   UnschedulableReason = "InsufficientPods"
+	// UnschedulableReasonInsufficientResource is lack of the other resources, e.g. ephemeral storage or GPU
+	UnschedulableReasonInsufficientResource UnschedulableReason = "InsufficientResource"
+	UnschedulableReasonTaint                UnschedulableReason = "Taint"
+	UnschedulableReasonAffinity             UnschedulableReason = "Affinity"
+	UnschedulableReasonVolume               UnschedulableReason = "Volume"
+	UnschedulableReasonPort                 UnschedulableReason = "Port"
+	UnschedulableReasonOther                UnschedulableReason = "Other"
+)
+
+type RebalancePolicy struct {
+	// MaxEvictionsPerInterval limits the pods evicted in every interval, defaults to 1
+	// +kubebuilder:validation:Minimum=1
+	MaxEvictionsPerInterval *int32 `json:"maxEvictionsPerInterval,omitempty"`
+	// Interval defaults to 5m
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// MinVirtualNodeAge is how long a pod runs on virtual nodes before it may
+	// be evicted, defaults to 10m
+	MinVirtualNodeAge *metav1.Duration `json:"minVirtualNodeAge,omitempty"`
+}
+
+// ReplicaSplitPolicySource places the replicas of a ReplicaSet, StatefulSet or
+// Job on normal nodes up to the base replicas, and the rest on virtual nodes
+// up to the ratio.
+type ReplicaSplitPolicySource struct {
+	// BaseReplicas is the number of replicas kept on normal nodes before any
+	// replica runs on virtual nodes
+	// +kubebuilder:validation:Minimum=0
+	BaseReplicas *int32 `json:"baseReplicas,omitempty"`
+	// MaxVirtualRatio is the maximum percentage of the replicas on virtual nodes
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	MaxVirtualRatio *int32 `json:"maxVirtualRatio,omitempty"`
+	// MaxVirtualNodeLifetime evicts the pods which have run on virtual nodes longer
+	MaxVirtualNodeLifetime *metav1.Duration `json:"maxVirtualNodeLifetime,omitempty"`
 }
 
-type VirtualNodeOnlyPolicySource struct{}
+// StatefulSetOrdinalPolicySource keeps the StatefulSet pods below the ordinal,
+// e.g. the primaries, on normal nodes, and places the others by AboveOrdinal.
+type StatefulSetOrdinalPolicySource struct {
+	// Ordinal is the lowest ordinal allowed on virtual nodes
+	// +kubebuilder:validation:Minimum=0
+	Ordinal int32 `json:"ordinal"`
+	// AboveOrdinal is the policy of the pods at or above the ordinal, defaults to VirtualNodeOnly
+	AboveOrdinal OrdinalPolicy `json:"aboveOrdinal,omitempty"`
+	// MaxVirtualNodeLifetime evicts the pods which have run on virtual nodes longer
+	MaxVirtualNodeLifetime *metav1.Duration `json:"maxVirtualNodeLifetime,omitempty"`
+}
+
+// OrdinalPolicy is the policy of the StatefulSet pods at or above the ordinal.
+// +kubebuilder:validation:Enum=VirtualNodeOnly;Fair
+type OrdinalPolicy string
+
+const (
+	OrdinalPolicyVirtualNodeOnly OrdinalPolicy = "VirtualNodeOnly"
+	OrdinalPolicyFair            OrdinalPolicy = "Fair"
+)
+
+type VirtualNodeOnlyPolicySource struct {
+	// Topology selects among multiple virtual nodes, e.g. one per zone or vSwitch.
+	// Only VirtualNodeOnly pins the pods to virtual nodes at creation, the other
+	// policies tolerate virtual nodes once the pods are unschedulable, when the
+	// node affinity of the pods is immutable
+	Topology *VirtualNodeTopology `json:"topology,omitempty"`
+	// MaxVirtualNodeLifetime evicts the pods which have run on virtual nodes longer
+	MaxVirtualNodeLifetime *metav1.Duration `json:"maxVirtualNodeLifetime,omitempty"`
+}
+
+type VirtualNodeTopology struct {
+	// TopologyKey is the node label grouping virtual nodes, defaults to topology.kubernetes.io/zone
+	TopologyKey string `json:"topologyKey,omitempty"`
+	// RequiredZones restricts pods to the virtual nodes of these zones
+	RequiredZones []string `json:"requiredZones,omitempty"`
+	// PreferredZones prefers the virtual nodes of these zones by weight
+	PreferredZones []WeightedZone `json:"preferredZones,omitempty"`
+	// Spread spreads the pods of a workload across zones in proportion to their weights
+	Spread bool `json:"spread,omitempty"`
+}
+
+type WeightedZone struct {
+	Zone string `json:"zone"`
+	// Weight ranges from 1 to 100
+	Weight int32 `json:"weight"`
+}
 
 type NamespaceResourceLimitPolicySource struct {
 	Namespace string          `json:"namespace"`
@@ -45,14 +263,29 @@ type PolicySource struct {
 	NormalNodeOnly         *NormalNodeOnlyPolicySource         `json:"normalNodeOnly,omitempty"`
 	NormalNodePrefer       *NormalNodePreferPolicySource       `json:"normalNodePrefer,omitempty"`
 	VirtualNodeOnly        *VirtualNodeOnlyPolicySource        `json:"virtualNodeOnly,omitempty"`
+	ReplicaSplit           *ReplicaSplitPolicySource           `json:"replicaSplit,omitempty"`
+	StatefulSetOrdinal     *StatefulSetOrdinalPolicySource     `json:"statefulSetOrdinal,omitempty"`
 	NamespaceResourceLimit *NamespaceResourceLimitPolicySource `json:"namespaceResourceLimit,omitempty"`
+	// VirtualNodeTolerations overrides the global tolerations required by virtual nodes
+	VirtualNodeTolerations []v1.Toleration `json:"virtualNodeTolerations,omitempty"`
 }
 
 type SideEffect struct {
 	Annotations map[string]string `json:"annotations,omitempty"` // 需要追加的annotation
 	Labels      map[string]string `json:"labels,omitempty"`      // 需要追加的label
+	// MergePolicy decides whether the effect overwrites the existing values of the pod, defaults to Overwrite
+	MergePolicy EffectMergePolicy `json:"mergePolicy,omitempty"`
 }
 
+type EffectMergePolicy string
+
+const (
+	// EffectMergePolicyOverwrite overwrites the existing annotations and labels of the pod
+	EffectMergePolicyOverwrite EffectMergePolicy = "Overwrite"
+	// EffectMergePolicyIfNotPresent only adds the annotations and labels missing in the pod
+	EffectMergePolicyIfNotPresent EffectMergePolicy = "IfNotPresent"
+)
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 type SelectorList struct {
@@ -60,3 +293,45 @@ type SelectorList struct {
 	metav1.ListMeta `json:"metadata,omitempty"`
 	Items           []Selector `json:"items"`
 }
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+
+// VirtualNodeBudget limits the resources requested by the pods on virtual
+// nodes, in the whole cluster or in a namespace.
+type VirtualNodeBudget struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              VirtualNodeBudgetSpec   `json:"spec"`
+	Status            VirtualNodeBudgetStatus `json:"status,omitempty"`
+}
+
+type VirtualNodeBudgetSpec struct {
+	// Namespace limits the budget to the pods of the namespace, the budget
+	// covers the whole cluster if empty
+	Namespace string `json:"namespace,omitempty"`
+	// Limits are the maximum resources, e.g. cpu and memory, requested by the
+	// pods on virtual nodes
+	Limits v1.ResourceList `json:"limits"`
+}
+
+type VirtualNodeBudgetStatus struct {
+	// Used are the resources requested by the pods bound to virtual nodes, or
+	// not bound yet but tolerating them
+	Used v1.ResourceList `json:"used,omitempty"`
+	// Exhausted is true once any used resource reaches its limit
+	Exhausted bool `json:"exhausted,omitempty"`
+	// LastUpdateTime is when the usage was accounted last
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type VirtualNodeBudgetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VirtualNodeBudget `json:"items"`
+}
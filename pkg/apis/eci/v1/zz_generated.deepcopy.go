@@ -11,9 +11,77 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActiveWindow) DeepCopyInto(out *ActiveWindow) {
+	*out = *in
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActiveWindow.
+func (in *ActiveWindow) DeepCopy() *ActiveWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(ActiveWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuditStatus) DeepCopyInto(out *AuditStatus) {
+	*out = *in
+	if in.LastAuditTime != nil {
+		in, out := &in.LastAuditTime, &out.LastAuditTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuditStatus.
+func (in *AuditStatus) DeepCopy() *AuditStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AuditStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftStatus) DeepCopyInto(out *DriftStatus) {
+	*out = *in
+	if in.LastReconcileTime != nil {
+		in, out := &in.LastReconcileTime, &out.LastReconcileTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftStatus.
+func (in *DriftStatus) DeepCopy() *DriftStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FairPolicySource) DeepCopyInto(out *FairPolicySource) {
 	*out = *in
+	if in.MaxVirtualNodeLifetime != nil {
+		in, out := &in.MaxVirtualNodeLifetime, &out.MaxVirtualNodeLifetime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FairPolicySource.
@@ -76,6 +144,26 @@ func (in *NormalNodePreferPolicySource) DeepCopyInto(out *NormalNodePreferPolicy
 		*out = new(int)
 		**out = **in
 	}
+	if in.OverflowDelay != nil {
+		in, out := &in.OverflowDelay, &out.OverflowDelay
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.OverflowReasons != nil {
+		in, out := &in.OverflowReasons, &out.OverflowReasons
+		*out = make([]UnschedulableReason, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rebalance != nil {
+		in, out := &in.Rebalance, &out.Rebalance
+		*out = new(RebalancePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxVirtualNodeLifetime != nil {
+		in, out := &in.MaxVirtualNodeLifetime, &out.MaxVirtualNodeLifetime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NormalNodePreferPolicySource.
@@ -88,13 +176,86 @@ func (in *NormalNodePreferPolicySource) DeepCopy() *NormalNodePreferPolicySource
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodMatch) DeepCopyInto(out *PodMatch) {
+	*out = *in
+	if in.OwnerKinds != nil {
+		in, out := &in.OwnerKinds, &out.OwnerKinds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.OwnerNames != nil {
+		in, out := &in.OwnerNames, &out.OwnerNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.QOSClasses != nil {
+		in, out := &in.QOSClasses, &out.QOSClasses
+		*out = make([]corev1.PodQOSClass, len(*in))
+		copy(*out, *in)
+	}
+	if in.PriorityClassNames != nil {
+		in, out := &in.PriorityClassNames, &out.PriorityClassNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceAccountNames != nil {
+		in, out := &in.ServiceAccountNames, &out.ServiceAccountNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SchedulerNames != nil {
+		in, out := &in.SchedulerNames, &out.SchedulerNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MinRequests != nil {
+		in, out := &in.MinRequests, &out.MinRequests
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.MaxRequests != nil {
+		in, out := &in.MaxRequests, &out.MaxRequests
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.MinLimits != nil {
+		in, out := &in.MinLimits, &out.MinLimits
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.MaxLimits != nil {
+		in, out := &in.MaxLimits, &out.MaxLimits
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodMatch.
+func (in *PodMatch) DeepCopy() *PodMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(PodMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PolicySource) DeepCopyInto(out *PolicySource) {
 	*out = *in
 	if in.Fair != nil {
 		in, out := &in.Fair, &out.Fair
 		*out = new(FairPolicySource)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.NormalNodeOnly != nil {
 		in, out := &in.NormalNodeOnly, &out.NormalNodeOnly
@@ -109,13 +270,30 @@ func (in *PolicySource) DeepCopyInto(out *PolicySource) {
 	if in.VirtualNodeOnly != nil {
 		in, out := &in.VirtualNodeOnly, &out.VirtualNodeOnly
 		*out = new(VirtualNodeOnlyPolicySource)
-		**out = **in
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReplicaSplit != nil {
+		in, out := &in.ReplicaSplit, &out.ReplicaSplit
+		*out = new(ReplicaSplitPolicySource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StatefulSetOrdinal != nil {
+		in, out := &in.StatefulSetOrdinal, &out.StatefulSetOrdinal
+		*out = new(StatefulSetOrdinalPolicySource)
+		(*in).DeepCopyInto(*out)
 	}
 	if in.NamespaceResourceLimit != nil {
 		in, out := &in.NamespaceResourceLimit, &out.NamespaceResourceLimit
 		*out = new(NamespaceResourceLimitPolicySource)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.VirtualNodeTolerations != nil {
+		in, out := &in.VirtualNodeTolerations, &out.VirtualNodeTolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicySource.
@@ -128,12 +306,73 @@ func (in *PolicySource) DeepCopy() *PolicySource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RebalancePolicy) DeepCopyInto(out *RebalancePolicy) {
+	*out = *in
+	if in.MaxEvictionsPerInterval != nil {
+		in, out := &in.MaxEvictionsPerInterval, &out.MaxEvictionsPerInterval
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MinVirtualNodeAge != nil {
+		in, out := &in.MinVirtualNodeAge, &out.MinVirtualNodeAge
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RebalancePolicy.
+func (in *RebalancePolicy) DeepCopy() *RebalancePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RebalancePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplicaSplitPolicySource) DeepCopyInto(out *ReplicaSplitPolicySource) {
+	*out = *in
+	if in.BaseReplicas != nil {
+		in, out := &in.BaseReplicas, &out.BaseReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxVirtualRatio != nil {
+		in, out := &in.MaxVirtualRatio, &out.MaxVirtualRatio
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxVirtualNodeLifetime != nil {
+		in, out := &in.MaxVirtualNodeLifetime, &out.MaxVirtualNodeLifetime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicaSplitPolicySource.
+func (in *ReplicaSplitPolicySource) DeepCopy() *ReplicaSplitPolicySource {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplicaSplitPolicySource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Selector) DeepCopyInto(out *Selector) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Selector.
@@ -199,6 +438,11 @@ func (in *SelectorSpec) DeepCopyInto(out *SelectorSpec) {
 		*out = new(metav1.LabelSelector)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.PodMatch != nil {
+		in, out := &in.PodMatch, &out.PodMatch
+		*out = new(PodMatch)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Effect != nil {
 		in, out := &in.Effect, &out.Effect
 		*out = new(SideEffect)
@@ -214,6 +458,18 @@ func (in *SelectorSpec) DeepCopyInto(out *SelectorSpec) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.ActiveWindows != nil {
+		in, out := &in.ActiveWindows, &out.ActiveWindows
+		*out = make([]ActiveWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RolloutPercent != nil {
+		in, out := &in.RolloutPercent, &out.RolloutPercent
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SelectorSpec.
@@ -226,6 +482,35 @@ func (in *SelectorSpec) DeepCopy() *SelectorSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SelectorStatus) DeepCopyInto(out *SelectorStatus) {
+	*out = *in
+	if in.NextActivationTime != nil {
+		in, out := &in.NextActivationTime, &out.NextActivationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Audit != nil {
+		in, out := &in.Audit, &out.Audit
+		*out = new(AuditStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Drift != nil {
+		in, out := &in.Drift, &out.Drift
+		*out = new(DriftStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SelectorStatus.
+func (in *SelectorStatus) DeepCopy() *SelectorStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SelectorStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SideEffect) DeepCopyInto(out *SideEffect) {
 	*out = *in
@@ -255,9 +540,146 @@ func (in *SideEffect) DeepCopy() *SideEffect {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StatefulSetOrdinalPolicySource) DeepCopyInto(out *StatefulSetOrdinalPolicySource) {
+	*out = *in
+	if in.MaxVirtualNodeLifetime != nil {
+		in, out := &in.MaxVirtualNodeLifetime, &out.MaxVirtualNodeLifetime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatefulSetOrdinalPolicySource.
+func (in *StatefulSetOrdinalPolicySource) DeepCopy() *StatefulSetOrdinalPolicySource {
+	if in == nil {
+		return nil
+	}
+	out := new(StatefulSetOrdinalPolicySource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualNodeBudget) DeepCopyInto(out *VirtualNodeBudget) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualNodeBudget.
+func (in *VirtualNodeBudget) DeepCopy() *VirtualNodeBudget {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualNodeBudget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtualNodeBudget) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualNodeBudgetList) DeepCopyInto(out *VirtualNodeBudgetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VirtualNodeBudget, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualNodeBudgetList.
+func (in *VirtualNodeBudgetList) DeepCopy() *VirtualNodeBudgetList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualNodeBudgetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtualNodeBudgetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualNodeBudgetSpec) DeepCopyInto(out *VirtualNodeBudgetSpec) {
+	*out = *in
+	if in.Limits != nil {
+		in, out := &in.Limits, &out.Limits
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualNodeBudgetSpec.
+func (in *VirtualNodeBudgetSpec) DeepCopy() *VirtualNodeBudgetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualNodeBudgetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualNodeBudgetStatus) DeepCopyInto(out *VirtualNodeBudgetStatus) {
+	*out = *in
+	if in.Used != nil {
+		in, out := &in.Used, &out.Used
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.LastUpdateTime != nil {
+		in, out := &in.LastUpdateTime, &out.LastUpdateTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualNodeBudgetStatus.
+func (in *VirtualNodeBudgetStatus) DeepCopy() *VirtualNodeBudgetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualNodeBudgetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VirtualNodeOnlyPolicySource) DeepCopyInto(out *VirtualNodeOnlyPolicySource) {
 	*out = *in
+	if in.Topology != nil {
+		in, out := &in.Topology, &out.Topology
+		*out = new(VirtualNodeTopology)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxVirtualNodeLifetime != nil {
+		in, out := &in.MaxVirtualNodeLifetime, &out.MaxVirtualNodeLifetime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualNodeOnlyPolicySource.
@@ -269,3 +691,43 @@ func (in *VirtualNodeOnlyPolicySource) DeepCopy() *VirtualNodeOnlyPolicySource {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualNodeTopology) DeepCopyInto(out *VirtualNodeTopology) {
+	*out = *in
+	if in.RequiredZones != nil {
+		in, out := &in.RequiredZones, &out.RequiredZones
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PreferredZones != nil {
+		in, out := &in.PreferredZones, &out.PreferredZones
+		*out = make([]WeightedZone, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualNodeTopology.
+func (in *VirtualNodeTopology) DeepCopy() *VirtualNodeTopology {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualNodeTopology)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WeightedZone) DeepCopyInto(out *WeightedZone) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WeightedZone.
+func (in *WeightedZone) DeepCopy() *WeightedZone {
+	if in == nil {
+		return nil
+	}
+	out := new(WeightedZone)
+	in.DeepCopyInto(out)
+	return out
+}
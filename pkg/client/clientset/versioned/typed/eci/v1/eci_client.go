@@ -28,6 +28,7 @@ import (
 type EciV1Interface interface {
 	RESTClient() rest.Interface
 	SelectorsGetter
+	VirtualNodeBudgetsGetter
 }
 
 // EciV1Client is used to interact with features provided by the eci.aliyun.com group.
@@ -39,6 +40,10 @@ func (c *EciV1Client) Selectors() SelectorInterface {
 	return newSelectors(c)
 }
 
+func (c *EciV1Client) VirtualNodeBudgets() VirtualNodeBudgetInterface {
+	return newVirtualNodeBudgets(c)
+}
+
 // NewForConfig creates a new EciV1Client for the given config.
 // NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
 // where httpClient was generated with rest.HTTPClientFor(c).
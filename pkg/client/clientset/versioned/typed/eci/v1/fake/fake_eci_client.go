@@ -31,6 +31,10 @@ func (c *FakeEciV1) Selectors() v1.SelectorInterface {
 	return &FakeSelectors{c}
 }
 
+func (c *FakeEciV1) VirtualNodeBudgets() v1.VirtualNodeBudgetInterface {
+	return &FakeVirtualNodeBudgets{c}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeEciV1) RESTClient() rest.Interface {
@@ -95,6 +95,17 @@ func (c *FakeSelectors) Update(ctx context.Context, selector *eciv1.Selector, op
 	return obj.(*eciv1.Selector), err
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeSelectors) UpdateStatus(ctx context.Context, selector *eciv1.Selector, opts v1.UpdateOptions) (*eciv1.Selector, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateSubresourceAction(selectorsResource, "status", selector), &eciv1.Selector{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*eciv1.Selector), err
+}
+
 // Delete takes name of the selector and deletes it. Returns an error if one occurs.
 func (c *FakeSelectors) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
 	_, err := c.Fake.
@@ -39,6 +39,7 @@ type SelectorsGetter interface {
 type SelectorInterface interface {
 	Create(ctx context.Context, selector *v1.Selector, opts metav1.CreateOptions) (*v1.Selector, error)
 	Update(ctx context.Context, selector *v1.Selector, opts metav1.UpdateOptions) (*v1.Selector, error)
+	UpdateStatus(ctx context.Context, selector *v1.Selector, opts metav1.UpdateOptions) (*v1.Selector, error)
 	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
 	DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error
 	Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1.Selector, error)
@@ -127,6 +128,21 @@ func (c *selectors) Update(ctx context.Context, selector *v1.Selector, opts meta
 	return
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *selectors) UpdateStatus(ctx context.Context, selector *v1.Selector, opts metav1.UpdateOptions) (result *v1.Selector, err error) {
+	result = &v1.Selector{}
+	err = c.client.Put().
+		Resource("selectors").
+		Name(selector.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(selector).
+		Do(ctx).
+		Into(result)
+	return
+}
+
 // Delete takes name of the selector and deletes it. Returns an error if one occurs.
 func (c *selectors) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
 	return c.client.Delete().
@@ -25,6 +25,8 @@ import (
 type Interface interface {
 	// Selectors returns a SelectorInformer.
 	Selectors() SelectorInformer
+	// VirtualNodeBudgets returns a VirtualNodeBudgetInformer.
+	VirtualNodeBudgets() VirtualNodeBudgetInformer
 }
 
 type version struct {
@@ -42,3 +44,8 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 func (v *version) Selectors() SelectorInformer {
 	return &selectorInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
 }
+
+// VirtualNodeBudgets returns a VirtualNodeBudgetInformer.
+func (v *version) VirtualNodeBudgets() VirtualNodeBudgetInformer {
+	return &virtualNodeBudgetInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
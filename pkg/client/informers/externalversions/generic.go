@@ -54,6 +54,8 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 	// Group=eci.aliyun.com, Version=v1
 	case v1.SchemeGroupVersion.WithResource("selectors"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Eci().V1().Selectors().Informer()}, nil
+	case v1.SchemeGroupVersion.WithResource("virtualnodebudgets"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Eci().V1().VirtualNodeBudgets().Informer()}, nil
 
 	}
 
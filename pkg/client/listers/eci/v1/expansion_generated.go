@@ -20,3 +20,7 @@ package v1
 // SelectorListerExpansion allows custom methods to be added to
 // SelectorLister.
 type SelectorListerExpansion interface{}
+
+// VirtualNodeBudgetListerExpansion allows custom methods to be added to
+// VirtualNodeBudgetLister.
+type VirtualNodeBudgetListerExpansion interface{}
@@ -0,0 +1,127 @@
+package expression
+
+import (
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// PodVariable is the name of the pod in the expressions
+	PodVariable = "pod"
+	// NamespaceVariable is the name of the namespace in the expressions, namespace
+	// itself is a reserved word of CEL
+	NamespaceVariable = "namespaceObject"
+
+	// costLimit bounds the evaluation of an expression, it's the same as the
+	// per expression limit of the CRD validation rules.
+	costLimit uint64 = 1000000
+)
+
+// Program is a compiled CEL expression evaluated against a pod and its namespace.
+type Program struct {
+	expression string
+	program    cel.Program
+}
+
+func newEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable(PodVariable, cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable(NamespaceVariable, cel.MapType(cel.StringType, cel.DynType)),
+		ext.Strings(),
+	)
+}
+
+// CompileBool compiles an expression which must evaluate to a bool.
+func CompileBool(expression string) (*Program, error) {
+	return compile(expression, cel.BoolType)
+}
+
+// CompileString compiles an expression which must evaluate to a string.
+func CompileString(expression string) (*Program, error) {
+	return compile(expression, cel.StringType)
+}
+
+func compile(expression string, resultType *cel.Type) (*Program, error) {
+	env, err := newEnv()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create CEL environment")
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, errors.Errorf("failed to compile %q: %v", expression, issues.Err())
+	}
+	// the type of the fields is only known at runtime
+	outputType := ast.OutputType()
+	if outputType.String() != cel.DynType.String() && !resultType.IsAssignableType(outputType) {
+		return nil, errors.Errorf("expression %q must evaluate to %s, but got %s", expression, resultType, outputType)
+	}
+	program, err := env.Program(ast, cel.CostLimit(costLimit), cel.InterruptCheckFrequency(100))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create program of %q", expression)
+	}
+	return &Program{expression: expression, program: program}, nil
+}
+
+// EvalBool evaluates the expression, the namespace may be nil.
+func (p *Program) EvalBool(pod *v1.Pod, namespace *v1.Namespace) (bool, error) {
+	value, err := p.eval(pod, namespace)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, errors.Errorf("expression %q evaluates to %T, expect bool", p.expression, value)
+	}
+	return result, nil
+}
+
+// EvalString evaluates the expression, the namespace may be nil.
+func (p *Program) EvalString(pod *v1.Pod, namespace *v1.Namespace) (string, error) {
+	value, err := p.eval(pod, namespace)
+	if err != nil {
+		return "", err
+	}
+	result, ok := value.(string)
+	if !ok {
+		return "", errors.Errorf("expression %q evaluates to %T, expect string", p.expression, value)
+	}
+	return result, nil
+}
+
+func (p *Program) eval(pod *v1.Pod, namespace *v1.Namespace) (interface{}, error) {
+	podObject := map[string]interface{}{}
+	if pod != nil {
+		object, err := toUnstructured(pod)
+		if err != nil {
+			return nil, err
+		}
+		podObject = object
+	}
+	namespaceObject := map[string]interface{}{}
+	if namespace != nil {
+		object, err := toUnstructured(namespace)
+		if err != nil {
+			return nil, err
+		}
+		namespaceObject = object
+	}
+	value, _, err := p.program.Eval(map[string]interface{}{
+		PodVariable:       podObject,
+		NamespaceVariable: namespaceObject,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to evaluate %q", p.expression)
+	}
+	return value.Value(), nil
+}
+
+func toUnstructured(obj runtime.Object) (map[string]interface{}, error) {
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert object")
+	}
+	return object, nil
+}
@@ -0,0 +1,86 @@
+package expression
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCompileBool(t *testing.T) {
+	for desc, test := range map[string]struct {
+		expression string
+		expectErr  bool
+	}{
+		"bool expression":    {expression: `pod.metadata.name == "foo"`},
+		"dynamic expression": {expression: `pod.spec.hostNetwork`},
+		"syntax error":       {expression: `pod.metadata.name ==`, expectErr: true},
+		"undeclared":         {expression: `node.metadata.name == "foo"`, expectErr: true},
+		"not bool":           {expression: `"foo"`, expectErr: true},
+	} {
+		_, err := CompileBool(test.expression)
+		if (err != nil) != test.expectErr {
+			t.Errorf("%s: expect error %v, but got %v", desc, test.expectErr, err)
+		}
+	}
+}
+
+func TestEvalBool(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "foo",
+			Labels: map[string]string{"owner": "team-a"},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "c", Image: "registry.example.com/app:v1"}},
+			Volumes: []v1.Volume{
+				{Name: "data", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+	namespace := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "default",
+			Annotations: map[string]string{"team": "team-a"},
+		},
+	}
+	for desc, test := range map[string]struct {
+		expression string
+		namespace  *v1.Namespace
+		expect     bool
+		expectErr  bool
+	}{
+		"image and volumes": {
+			expression: `pod.spec.containers.all(c, c.image.startsWith("registry.example.com/")) && pod.spec.volumes.all(v, !has(v.hostPath))`,
+			namespace:  namespace,
+			expect:     true,
+		},
+		"namespace annotation equals pod label": {
+			expression: `pod.metadata.labels["owner"] == namespaceObject.metadata.annotations["team"]`,
+			namespace:  namespace,
+			expect:     true,
+		},
+		"missing namespace": {
+			expression: `has(namespaceObject.metadata)`,
+			expect:     false,
+		},
+		"missing key": {
+			expression: `pod.metadata.annotations["foo"] == "bar"`,
+			namespace:  namespace,
+			expectErr:  true,
+		},
+	} {
+		program, err := CompileBool(test.expression)
+		if err != nil {
+			t.Fatalf("%s: failed to compile: %v", desc, err)
+		}
+		actual, err := program.EvalBool(pod, test.namespace)
+		if (err != nil) != test.expectErr {
+			t.Errorf("%s: expect error %v, but got %v", desc, test.expectErr, err)
+			continue
+		}
+		if actual != test.expect {
+			t.Errorf("%s: expect %v, but got %v", desc, test.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package expression
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	templateLeftDelim  = "{{"
+	templateRightDelim = "}}"
+)
+
+// Template is a string embedding CEL expressions between {{ and }}, every
+// expression must evaluate to a string.
+type Template struct {
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal string
+	program *Program
+}
+
+// IsTemplate reports whether the value embeds any expression.
+func IsTemplate(value string) bool {
+	return strings.Contains(value, templateLeftDelim)
+}
+
+// ParseTemplate compiles the expressions embedded in the value.
+func ParseTemplate(value string) (*Template, error) {
+	template := &Template{}
+	rest := value
+	for {
+		start := strings.Index(rest, templateLeftDelim)
+		if start < 0 {
+			if rest != "" {
+				template.parts = append(template.parts, templatePart{literal: rest})
+			}
+			return template, nil
+		}
+		if start > 0 {
+			template.parts = append(template.parts, templatePart{literal: rest[:start]})
+		}
+		rest = rest[start+len(templateLeftDelim):]
+		end := strings.Index(rest, templateRightDelim)
+		if end < 0 {
+			return nil, errors.Errorf("unclosed %s in %q", templateLeftDelim, value)
+		}
+		source := strings.TrimSpace(rest[:end])
+		if source == "" {
+			return nil, errors.Errorf("empty expression in %q", value)
+		}
+		program, err := CompileString(source)
+		if err != nil {
+			return nil, err
+		}
+		template.parts = append(template.parts, templatePart{program: program})
+		rest = rest[end+len(templateRightDelim):]
+	}
+}
+
+// Render evaluates the expressions against the pod and its namespace, the
+// namespace may be nil.
+func (t *Template) Render(pod *v1.Pod, namespace *v1.Namespace) (string, error) {
+	var builder strings.Builder
+	for _, part := range t.parts {
+		if part.program == nil {
+			builder.WriteString(part.literal)
+			continue
+		}
+		value, err := part.program.EvalString(pod, namespace)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteString(value)
+	}
+	return builder.String(), nil
+}
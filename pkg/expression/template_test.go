@@ -0,0 +1,78 @@
+package expression
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTemplate(t *testing.T) {
+	isController := true
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "nginx-5d8f7c", Controller: &isController},
+			},
+		},
+	}
+	namespace := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "default",
+			Annotations: map[string]string{"team/sg": "sg-123"},
+		},
+	}
+	for desc, test := range map[string]struct {
+		value       string
+		expect      string
+		expectParse bool
+		expectErr   bool
+	}{
+		"literal": {
+			value:  "foo",
+			expect: "foo",
+		},
+		"namespace annotation": {
+			value:  `{{ namespaceObject.metadata.annotations["team/sg"] }}`,
+			expect: "sg-123",
+		},
+		"mixed": {
+			value:  `{{ pod.metadata.ownerReferences[0].kind }}/{{ pod.metadata.name }}-x`,
+			expect: "ReplicaSet/foo-x",
+		},
+		"unclosed": {
+			value:       `{{ pod.metadata.name`,
+			expectParse: true,
+		},
+		"empty expression": {
+			value:       `{{ }}`,
+			expectParse: true,
+		},
+		"not string": {
+			value:       `{{ 1 }}`,
+			expectParse: true,
+		},
+		"missing key": {
+			value:     `{{ pod.metadata.annotations["foo"] }}`,
+			expectErr: true,
+		},
+	} {
+		template, err := ParseTemplate(test.value)
+		if (err != nil) != test.expectParse {
+			t.Errorf("%s: expect parse error %v, but got %v", desc, test.expectParse, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		actual, err := template.Render(pod, namespace)
+		if (err != nil) != test.expectErr {
+			t.Errorf("%s: expect error %v, but got %v", desc, test.expectErr, err)
+			continue
+		}
+		if actual != test.expect {
+			t.Errorf("%s: expect %q, but got %q", desc, test.expect, actual)
+		}
+	}
+}
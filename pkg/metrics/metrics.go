@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
+)
+
+const namespace = "eci_profile"
+
+var (
+	// AuditedPods counts the pods matched by selectors in Audit mode.
+	AuditedPods = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "selector_audited_pods_total",
+		Help:      "Number of pods a selector in Audit mode would have mutated.",
+	}, []string{"selector", "phase"})
+	// DriftedPods is the number of running pods drifted from the effect of selectors.
+	DriftedPods = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "selector_drifted_pods",
+		Help:      "Number of running pods on virtual nodes drifted from the effect of a selector, found by the last reconciliation.",
+	}, []string{"selector"})
+	// ReconciledPods counts the drifted pods patched by selectors.
+	ReconciledPods = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "selector_reconciled_pods_total",
+		Help:      "Number of drifted pods patched with the effect of a selector.",
+	}, []string{"selector"})
+	// RebalancedPods counts the pods evicted from virtual nodes back to normal nodes.
+	RebalancedPods = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "selector_rebalanced_pods_total",
+		Help:      "Number of pods evicted from virtual nodes since they fit on the normal nodes again.",
+	}, []string{"selector"})
+	// LifetimeEvictedPods counts the pods evicted from virtual nodes for exceeding the max lifetime.
+	LifetimeEvictedPods = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "selector_lifetime_evicted_pods_total",
+		Help:      "Number of pods evicted from virtual nodes since they have run there longer than the max lifetime of a selector.",
+	}, []string{"selector"})
+	// FallbackPods counts the pods failed on ECI and deleted to be recreated on normal nodes.
+	FallbackPods = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fallback_pods_total",
+		Help:      "Number of pods failed on virtual nodes and deleted so that their replacements avoid virtual nodes.",
+	}, []string{"namespace"})
+	// VirtualNodeBreakerOpen is 1 while the breaker of a virtual node is open.
+	VirtualNodeBreakerOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "virtual_node_breaker_open",
+		Help:      "Whether the breaker of a virtual node is open, i.e. the node is not ready or too many recent pods failed on it.",
+	}, []string{"node"})
+	// VirtualNodeBudgetUsed is the resources used by the pods on virtual nodes in a budget.
+	VirtualNodeBudgetUsed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "virtual_node_budget_used",
+		Help:      "Resources requested by the pods on virtual nodes in a budget, in cores or bytes.",
+	}, []string{"budget", "resource"})
+)
+
+func init() {
+	prometheus.MustRegister(AuditedPods, DriftedPods, ReconciledPods, RebalancedPods, LifetimeEvictedPods, FallbackPods, VirtualNodeBreakerOpen, VirtualNodeBudgetUsed)
+}
+
+// Serve exposes the metrics at /metrics of the address until the context is done.
+func Serve(ctx context.Context, address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: address, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	klog.Infof("serving metrics on %s", address)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		klog.Errorf("failed to serve metrics: %q", err)
+	}
+}
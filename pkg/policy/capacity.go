@@ -0,0 +1,96 @@
+package policy
+
+import (
+	"eci.io/eci-profile/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// NodeCapacity tracks the free resources of a normal node.
+type NodeCapacity struct {
+	Node *v1.Node
+	Free v1.ResourceList
+}
+
+// NewNodeCapacity subtracts the requests of the pods bound to the node from
+// its allocatable resources, every pod takes one of the allocatable pods.
+func NewNodeCapacity(node *v1.Node, pods []*v1.Pod) *NodeCapacity {
+	capacity := &NodeCapacity{Node: node, Free: node.Status.Allocatable.DeepCopy()}
+	if capacity.Free == nil {
+		capacity.Free = v1.ResourceList{}
+	}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != node.Name || isTerminated(pod) {
+			continue
+		}
+		capacity.Reserve(pod)
+	}
+	return capacity
+}
+
+// IsSchedulable reports whether new pods may be scheduled to the node.
+func IsSchedulable(node *v1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Fits reports whether the pod tolerates the taints, matches the node
+// selector and fits in the free resources of the node.
+func (c *NodeCapacity) Fits(pod *v1.Pod) bool {
+	for i := range c.Node.Spec.Taints {
+		taint := &c.Node.Spec.Taints[i]
+		if taint.Effect == v1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		if !toleratesTaint(pod.Spec.Tolerations, taint) {
+			return false
+		}
+	}
+	if !matchNodeSelector(c.Node, pod.Spec.NodeSelector, pod.Spec.Affinity) {
+		return false
+	}
+	for name, request := range podRequests(pod) {
+		if request.IsZero() {
+			continue
+		}
+		if free, ok := c.Free[name]; !ok || free.Cmp(request) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Reserve takes the requests of the pod from the free resources.
+func (c *NodeCapacity) Reserve(pod *v1.Pod) {
+	for name, request := range podRequests(pod) {
+		free := c.Free[name]
+		free.Sub(request)
+		c.Free[name] = free
+	}
+}
+
+func podRequests(pod *v1.Pod) v1.ResourceList {
+	requests := utils.PodRequests(pod)
+	requests[v1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+	return requests
+}
+
+func toleratesTaint(tolerations []v1.Toleration, taint *v1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTerminated(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
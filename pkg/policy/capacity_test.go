@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newCapacityPod(nodeName, cpu, memory string) *v1.Pod {
+	return &v1.Pod{
+		Spec: v1.PodSpec{
+			NodeName: nodeName,
+			Containers: []v1.Container{{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse(cpu),
+				v1.ResourceMemory: resource.MustParse(memory),
+			}}}},
+		},
+	}
+}
+
+func TestNodeCapacity(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"pool": "idc"}},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("4"),
+				v1.ResourceMemory: resource.MustParse("8Gi"),
+				v1.ResourcePods:   resource.MustParse("10"),
+			},
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+		},
+	}
+	completed := newCapacityPod("node-1", "2", "4Gi")
+	completed.Status.Phase = v1.PodSucceeded
+	capacity := NewNodeCapacity(node, []*v1.Pod{
+		newCapacityPod("node-1", "2", "4Gi"),
+		newCapacityPod("node-2", "2", "4Gi"),
+		completed,
+	})
+	if cpu := capacity.Free[v1.ResourceCPU]; cpu.Cmp(resource.MustParse("2")) != 0 {
+		t.Errorf("expect 2 free cpu, but got %s", cpu.String())
+	}
+
+	pod := newCapacityPod("", "1", "2Gi")
+	if !capacity.Fits(pod) {
+		t.Errorf("expect the pod fits")
+	}
+	capacity.Reserve(pod)
+	capacity.Reserve(pod)
+	if capacity.Fits(pod) {
+		t.Errorf("expect the pod doesn't fit once the cpu is taken")
+	}
+
+	capacity = NewNodeCapacity(node, nil)
+	pod.Spec.NodeSelector = map[string]string{"pool": "gpu"}
+	if capacity.Fits(pod) {
+		t.Errorf("expect the pod doesn't fit the node selector")
+	}
+	pod.Spec.NodeSelector = nil
+	node.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "db", Effect: v1.TaintEffectNoSchedule}}
+	if capacity.Fits(pod) {
+		t.Errorf("expect the pod doesn't tolerate the taint")
+	}
+	pod.Spec.Tolerations = []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpExists}}
+	if !capacity.Fits(pod) {
+		t.Errorf("expect the pod tolerates the taint")
+	}
+
+	if !IsSchedulable(node) {
+		t.Errorf("expect the ready node schedulable")
+	}
+	node.Spec.Unschedulable = true
+	if IsSchedulable(node) {
+		t.Errorf("expect the cordoned node unschedulable")
+	}
+}
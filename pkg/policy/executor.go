@@ -13,6 +13,8 @@ type PatchInfo struct {
 }
 
 type Executor interface {
+	// OnPodCreating is called from the pod admission which may be a dry run,
+	// so it only computes the patches and never writes to the cluster.
 	OnPodCreating(selector *eciv1.Selector, pod *v1.Pod) ([]PatchInfo, error)
 	OnPodUnscheduled(selector *eciv1.Selector, pod *v1.Pod) (*utils.PatchOption, error)
 	OnPodScheduled(selector *eciv1.Selector, pod *v1.Pod) (*utils.PatchOption, error)
@@ -3,45 +3,53 @@ package policy
 import (
 	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
 	"eci.io/eci-profile/pkg/utils"
+	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
 )
 
-type FairExecutor struct{}
+type FairExecutor struct {
+	virtualNode *VirtualNode
+}
 
-func NewFairExecutor() Executor {
-	return &FairExecutor{}
+func NewFairExecutor(virtualNode *VirtualNode) Executor {
+	return &FairExecutor{virtualNode: virtualNode}
 }
 
 func (e *FairExecutor) OnPodCreating(selector *eciv1.Selector, pod *v1.Pod) ([]PatchInfo, error) {
-	var patchInfos []PatchInfo
-	if !existVirtualTolerations(pod.Spec.Tolerations) {
-		patchInfos = append(patchInfos, addVirtualNodeToleration(pod))
-	}
-	if len(selector.Spec.Effect.Annotations) > 0 {
-		patchInfos = append(patchInfos, addAnnotations(selector, pod))
+	if pod.Spec.NodeName != "" && e.virtualNode.IsNodeSuspended(pod.Spec.NodeName) {
+		return nil, errors.Errorf("virtual node %s is suspended by its breaker", pod.Spec.NodeName)
 	}
-	if len(selector.Spec.Effect.Labels) > 0 {
-		patchInfos = append(patchInfos, addLabels(selector, pod))
+	var patchInfos []PatchInfo
+	tolerations := e.virtualNode.Tolerations(selector)
+	if (pod.Spec.NodeName != "" || !e.virtualNode.IsSuspended()) && !existVirtualTolerations(pod.Spec.Tolerations, tolerations) {
+		patchInfos = append(patchInfos, addVirtualNodeToleration(pod, tolerations))
 	}
+	patchInfos = append(patchInfos, addAnnotations(selector, pod)...)
+	patchInfos = append(patchInfos, addLabels(selector, pod)...)
 	return patchInfos, nil
 }
 
+// OnPodUnscheduled adds the tolerations unless all the virtual nodes are
+// suspended, the node affinity of the existing pod can't exclude some of them.
 func (e *FairExecutor) OnPodUnscheduled(selector *eciv1.Selector, pod *v1.Pod) (*utils.PatchOption, error) {
-	if existVirtualTolerations(pod.Spec.Tolerations) {
+	if e.virtualNode.IsSuspended() {
+		return nil, nil
+	}
+	tolerations := e.virtualNode.Tolerations(selector)
+	if existVirtualTolerations(pod.Spec.Tolerations, tolerations) {
 		return nil, nil
 	}
 	patchOption := utils.NewPatchOption()
-	tolerations := append(pod.Spec.Tolerations, virtualNodeToleration)
-	patchOption.WithTolerations(tolerations)
+	patchOption.WithTolerations(appendVirtualTolerations(pod.Spec.Tolerations, tolerations))
 	return patchOption, nil
 }
 
 func (e *FairExecutor) OnPodScheduled(selector *eciv1.Selector, pod *v1.Pod) (*utils.PatchOption, error) {
 	patchOption := utils.NewPatchOption()
-	if !existVirtualTolerations(pod.Spec.Tolerations) {
-		tolerations := append(pod.Spec.Tolerations, virtualNodeToleration)
-		patchOption.WithTolerations(tolerations)
+	tolerations := e.virtualNode.Tolerations(selector)
+	if !existVirtualTolerations(pod.Spec.Tolerations, tolerations) {
+		patchOption.WithTolerations(appendVirtualTolerations(pod.Spec.Tolerations, tolerations))
 	}
-	patchOption.WithAnnotations(selector.Spec.Effect.Annotations).WithLabels(selector.Spec.Effect.Labels)
+	patchOption.WithAnnotations(effectAnnotations(selector, pod)).WithLabels(effectLabels(selector, pod))
 	return patchOption, nil
 }
@@ -68,7 +68,7 @@ func TestFairOnPodCreatingWithTolerations(t *testing.T) {
 		if test.mutatePodFn != nil {
 			test.mutatePodFn(test.pod)
 		}
-		executor := NewFairExecutor()
+		executor := NewFairExecutor(newTestVirtualNode())
 		actual, err := executor.OnPodCreating(test.selector, test.pod)
 		if err != nil {
 			t.Fatalf("[%s] [tolerations] executor on pod creating failed, err: %v", desc, err)
@@ -233,7 +233,7 @@ func TestFairOnPodCreatingWithAnnotationsAndLabels(t *testing.T) {
 		if test.mutatePodFn != nil {
 			test.mutatePodFn(test.pod)
 		}
-		executor := NewFairExecutor()
+		executor := NewFairExecutor(newTestVirtualNode())
 		actual, err := executor.OnPodCreating(test.selector, test.pod)
 		if err != nil {
 			t.Fatalf("[%s] executor on pod creating failed, err: %v", desc, err)
@@ -339,18 +339,8 @@ func TestFairOnPodUnscheduled(t *testing.T) {
 					},
 				},
 			},
+			// the effect is applied once the pod is scheduled to virtual nodes
 			expect: &utils.PatchOption{
-				Metadata: struct {
-					Annotations map[string]string "json:\"annotations,omitempty\""
-					Labels      map[string]string "json:\"labels,omitempty\""
-				}{
-					Annotations: map[string]string{
-						"foo": "boo",
-					},
-					Labels: map[string]string{
-						"foo": "boo",
-					},
-				},
 				Spec: struct {
 					Tolerations []v1.Toleration "json:\"tolerations,omitempty\""
 				}{
@@ -370,7 +360,7 @@ func TestFairOnPodUnscheduled(t *testing.T) {
 		if test.mutatePodFn != nil {
 			test.mutatePodFn(test.pod)
 		}
-		executor := NewFairExecutor()
+		executor := NewFairExecutor(newTestVirtualNode())
 		actual, err := executor.OnPodUnscheduled(test.selector, test.pod)
 		if err != nil && err != test.expectErr {
 			t.Fatalf("[%s] executor on pod unscheduled failed, err: %v", desc, err)
@@ -7,10 +7,11 @@ import (
 )
 
 type NormalNodePreferExecutor struct {
+	virtualNode *VirtualNode
 }
 
-func NewNormalNodePreferExecutor() Executor {
-	return &NormalNodePreferExecutor{}
+func NewNormalNodePreferExecutor(virtualNode *VirtualNode) Executor {
+	return &NormalNodePreferExecutor{virtualNode: virtualNode}
 }
 
 func (e *NormalNodePreferExecutor) OnPodCreating(selector *eciv1.Selector, pod *v1.Pod) ([]PatchInfo, error) {
@@ -18,21 +19,24 @@ func (e *NormalNodePreferExecutor) OnPodCreating(selector *eciv1.Selector, pod *
 }
 
 func (e *NormalNodePreferExecutor) OnPodUnscheduled(selector *eciv1.Selector, pod *v1.Pod) (*utils.PatchOption, error) {
-	if existVirtualTolerations(pod.Spec.Tolerations) {
+	if e.virtualNode.IsSuspended() {
+		return nil, nil
+	}
+	tolerations := e.virtualNode.Tolerations(selector)
+	if existVirtualTolerations(pod.Spec.Tolerations, tolerations) {
 		return nil, nil
 	}
 	patchOption := utils.NewPatchOption()
-	tolerations := append(pod.Spec.Tolerations, virtualNodeToleration)
-	patchOption.WithTolerations(tolerations)
+	patchOption.WithTolerations(appendVirtualTolerations(pod.Spec.Tolerations, tolerations))
 	return patchOption, nil
 }
 
 func (e *NormalNodePreferExecutor) OnPodScheduled(selector *eciv1.Selector, pod *v1.Pod) (*utils.PatchOption, error) {
 	patchOption := utils.NewPatchOption()
-	if !existVirtualTolerations(pod.Spec.Tolerations) {
-		tolerations := append(pod.Spec.Tolerations, virtualNodeToleration)
-		patchOption.WithTolerations(tolerations)
+	tolerations := e.virtualNode.Tolerations(selector)
+	if !existVirtualTolerations(pod.Spec.Tolerations, tolerations) {
+		patchOption.WithTolerations(appendVirtualTolerations(pod.Spec.Tolerations, tolerations))
 	}
-	patchOption.WithAnnotations(selector.Spec.Effect.Annotations).WithLabels(selector.Spec.Effect.Labels)
+	patchOption.WithAnnotations(effectAnnotations(selector, pod)).WithLabels(effectLabels(selector, pod))
 	return patchOption, nil
 }
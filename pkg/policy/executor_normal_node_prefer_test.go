@@ -79,18 +79,8 @@ func TestNormalNodePreferOnPodUnscheduled(t *testing.T) {
 					},
 				},
 			},
+			// the effect is applied once the pod is scheduled to virtual nodes
 			expect: &utils.PatchOption{
-				Metadata: struct {
-					Annotations map[string]string "json:\"annotations,omitempty\""
-					Labels      map[string]string "json:\"labels,omitempty\""
-				}{
-					Annotations: map[string]string{
-						"foo": "boo",
-					},
-					Labels: map[string]string{
-						"foo": "boo",
-					},
-				},
 				Spec: struct {
 					Tolerations []v1.Toleration "json:\"tolerations,omitempty\""
 				}{
@@ -110,7 +100,7 @@ func TestNormalNodePreferOnPodUnscheduled(t *testing.T) {
 		if test.mutatePodFn != nil {
 			test.mutatePodFn(test.pod)
 		}
-		executor := NewNormalNodePreferExecutor()
+		executor := NewNormalNodePreferExecutor(newTestVirtualNode())
 		actual, err := executor.OnPodUnscheduled(test.selector, test.pod)
 		if err != nil && err != test.expectErr {
 			t.Fatalf("[%s] executor on pod unscheduled failed, err: %v", desc, err)
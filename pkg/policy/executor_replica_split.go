@@ -0,0 +1,242 @@
+package policy
+
+import (
+	"sync"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/utils"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// splitOwnerKinds are the controllers whose replicas are split.
+var splitOwnerKinds = []string{"ReplicaSet", "StatefulSet", "Job"}
+
+// pendingPlacementTTL is how long a placement decided at admission is counted
+// before the pod shows up in the informer, the pod may never be created if
+// the admission fails later.
+const pendingPlacementTTL = time.Minute
+
+// ReplicaSplitExecutor decides at creation whether a pod runs on virtual
+// nodes, by counting the placement of its siblings in the pod informer and
+// the placements decided for the siblings not seen there yet.
+type ReplicaSplitExecutor struct {
+	virtualNode *VirtualNode
+	lister      clusterLister
+	// lock serializes the decisions, so that the concurrent admissions of a
+	// scale-up count each other
+	lock       sync.Mutex
+	placements pendingPlacements
+}
+
+// pendingPlacements are the placements decided at admission for the pods not
+// seen in the informer yet, keyed by the UID of the owner. The placements of
+// an owner are interchangeable, so they are counted rather than keyed by pod,
+// whose name may be generated after admission.
+type pendingPlacements struct {
+	lock   sync.Mutex
+	owners map[types.UID][]pendingPlacement
+}
+
+type pendingPlacement struct {
+	virtual bool
+	expires time.Time
+}
+
+func (p *pendingPlacements) add(owner types.UID, virtual bool, now time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.owners == nil {
+		p.owners = map[types.UID][]pendingPlacement{}
+	}
+	p.owners[owner] = append(p.owners[owner], pendingPlacement{virtual: virtual, expires: now.Add(pendingPlacementTTL)})
+}
+
+// remove forgets the oldest placement of the owner on the same kind of nodes.
+func (p *pendingPlacements) remove(owner types.UID, virtual bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	placements := p.owners[owner]
+	for i := range placements {
+		if placements[i].virtual == virtual {
+			placements = append(placements[:i:i], placements[i+1:]...)
+			break
+		}
+	}
+	if len(placements) == 0 {
+		delete(p.owners, owner)
+		return
+	}
+	p.owners[owner] = placements
+}
+
+// count returns the unexpired placements of the owner on normal and virtual nodes.
+func (p *pendingPlacements) count(owner types.UID, now time.Time) (int, int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var live []pendingPlacement
+	normal, virtual := 0, 0
+	for _, placement := range p.owners[owner] {
+		if now.After(placement.expires) {
+			continue
+		}
+		live = append(live, placement)
+		if placement.virtual {
+			virtual++
+		} else {
+			normal++
+		}
+	}
+	if len(live) == 0 {
+		delete(p.owners, owner)
+	} else {
+		p.owners[owner] = live
+	}
+	return normal, virtual
+}
+
+func NewReplicaSplitExecutor(virtualNode *VirtualNode, lister clusterLister) Executor {
+	return &ReplicaSplitExecutor{virtualNode: virtualNode, lister: lister}
+}
+
+func (e *ReplicaSplitExecutor) OnPodCreating(selector *eciv1.Selector, pod *v1.Pod) ([]PatchInfo, error) {
+	if pod.Spec.NodeName != "" {
+		// the pod is bound to a virtual node already
+		return append(addAnnotations(selector, pod), addLabels(selector, pod)...), nil
+	}
+	nodeSelector, err := mergeNodeSelector(pod.Spec.NodeSelector, e.virtualNode.NodeSelector())
+	if err != nil || checkNodeAffinityConflict(pod.Spec.Affinity, e.virtualNode.NodeSelector()) != nil {
+		// the pod is pinned to normal nodes
+		return nil, nil
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	normal, virtual, err := e.countSiblings(pod)
+	if err != nil {
+		return nil, err
+	}
+	var split *eciv1.ReplicaSplitPolicySource
+	if selector.Spec.Policy != nil {
+		split = selector.Spec.Policy.ReplicaSplit
+	}
+	// the replicas run on normal nodes while all the virtual nodes are suspended
+	placed := placeOnVirtualNode(split, normal, virtual) && !e.virtualNode.IsSuspended()
+	if owner := splitOwner(pod); owner != nil {
+		e.placements.add(owner.UID, placed || e.virtualNode.IsSelectedBy(pod), time.Now())
+	}
+	if !placed {
+		klog.V(3).Infof("pod %s/%s is placed on normal nodes, %d siblings on normal nodes and %d on virtual nodes", pod.Namespace, pod.Name, normal, virtual)
+		return nil, nil
+	}
+	var patchInfos []PatchInfo
+	tolerations := e.virtualNode.Tolerations(selector)
+	if !existVirtualTolerations(pod.Spec.Tolerations, tolerations) {
+		patchInfos = append(patchInfos, addVirtualNodeToleration(pod, tolerations))
+	}
+	if len(nodeSelector) != len(pod.Spec.NodeSelector) {
+		patchInfos = append(patchInfos, addVirtualNodeSelector(nodeSelector))
+	}
+	topology := &topologyResolver{lister: e.lister, virtualNode: e.virtualNode}
+	affinity, err := topology.excludeOpenNodes(nodeSelector, pod.Spec.Affinity)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to exclude the suspended virtual nodes")
+	}
+	if affinity != pod.Spec.Affinity {
+		patchInfos = append(patchInfos, addNodeAffinity(affinity))
+	}
+	patchInfos = append(patchInfos, addAnnotations(selector, pod)...)
+	patchInfos = append(patchInfos, addLabels(selector, pod)...)
+	return patchInfos, nil
+}
+
+// OnPodUnscheduled keeps the placement decided at creation.
+func (e *ReplicaSplitExecutor) OnPodUnscheduled(selector *eciv1.Selector, pod *v1.Pod) (*utils.PatchOption, error) {
+	return nil, nil
+}
+
+func (e *ReplicaSplitExecutor) OnPodScheduled(selector *eciv1.Selector, pod *v1.Pod) (*utils.PatchOption, error) {
+	patchOption := utils.NewPatchOption()
+	patchOption.WithAnnotations(effectAnnotations(selector, pod)).WithLabels(effectLabels(selector, pod))
+	return patchOption, nil
+}
+
+// placeOnVirtualNode decides whether the new replica runs on virtual nodes,
+// given the siblings on normal and virtual nodes.
+func placeOnVirtualNode(split *eciv1.ReplicaSplitPolicySource, normal, virtual int) bool {
+	if split == nil {
+		return true
+	}
+	if split.BaseReplicas != nil && normal < int(*split.BaseReplicas) {
+		return false
+	}
+	if split.MaxVirtualRatio != nil {
+		total := normal + virtual + 1
+		return (virtual+1)*100 <= int(*split.MaxVirtualRatio)*total
+	}
+	return true
+}
+
+// release forgets the placement decided for a pod which isn't created, e.g.
+// on a dry run.
+func (e *ReplicaSplitExecutor) release(pod *v1.Pod, virtual bool) {
+	if owner := splitOwner(pod); owner != nil {
+		e.placements.remove(owner.UID, virtual)
+	}
+}
+
+// observe forgets the placement decided for a pod seen in the informer, which
+// is counted from the informer from now on.
+func (e *ReplicaSplitExecutor) observe(pod *v1.Pod) {
+	if owner := splitOwner(pod); owner != nil {
+		e.placements.remove(owner.UID, e.virtualNode.IsSelectedBy(pod))
+	}
+}
+
+func splitOwner(pod *v1.Pod) *metav1.OwnerReference {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || !containsString(splitOwnerKinds, owner.Kind) {
+		return nil
+	}
+	return owner
+}
+
+// countSiblings counts the live pods of the same controller on normal and
+// virtual nodes, a pod not bound yet is counted by its node selector, and a
+// pod not seen in the informer yet by the placement decided at admission.
+func (e *ReplicaSplitExecutor) countSiblings(pod *v1.Pod) (int, int, error) {
+	owner := splitOwner(pod)
+	if owner == nil {
+		return 0, 0, nil
+	}
+	pods, err := e.lister.ListPods(pod.Namespace)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to list pods")
+	}
+	nodes, err := e.lister.ListNodes()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to list nodes")
+	}
+	virtualNodes := map[string]bool{}
+	for _, node := range nodes {
+		if e.virtualNode.IsVirtualNode(node) {
+			virtualNodes[node.Name] = true
+		}
+	}
+	normal, virtual := e.placements.count(owner.UID, time.Now())
+	for _, sibling := range pods {
+		siblingOwner := metav1.GetControllerOf(sibling)
+		if siblingOwner == nil || siblingOwner.UID != owner.UID || sibling.DeletionTimestamp != nil || isTerminated(sibling) {
+			continue
+		}
+		if virtualNodes[sibling.Spec.NodeName] || (sibling.Spec.NodeName == "" && e.virtualNode.IsSelectedBy(sibling)) {
+			virtual++
+		} else {
+			normal++
+		}
+	}
+	return normal, virtual, nil
+}
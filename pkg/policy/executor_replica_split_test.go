@@ -0,0 +1,210 @@
+package policy
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestPlaceOnVirtualNode(t *testing.T) {
+	for desc, test := range map[string]struct {
+		split   *eciv1.ReplicaSplitPolicySource
+		normal  int
+		virtual int
+		expect  bool
+	}{
+		"test no split": {
+			expect: true,
+		},
+		"test below base replicas": {
+			split:  &eciv1.ReplicaSplitPolicySource{BaseReplicas: int32Ptr(2)},
+			normal: 1,
+			expect: false,
+		},
+		"test base replicas reached": {
+			split:  &eciv1.ReplicaSplitPolicySource{BaseReplicas: int32Ptr(2)},
+			normal: 2,
+			expect: true,
+		},
+		"test within ratio": {
+			split:   &eciv1.ReplicaSplitPolicySource{MaxVirtualRatio: int32Ptr(30)},
+			normal:  7,
+			virtual: 2,
+			expect:  true,
+		},
+		"test beyond ratio": {
+			split:   &eciv1.ReplicaSplitPolicySource{MaxVirtualRatio: int32Ptr(30)},
+			normal:  6,
+			virtual: 3,
+			expect:  false,
+		},
+		"test zero ratio": {
+			split:  &eciv1.ReplicaSplitPolicySource{MaxVirtualRatio: int32Ptr(0)},
+			normal: 10,
+			expect: false,
+		},
+	} {
+		if actual := placeOnVirtualNode(test.split, test.normal, test.virtual); actual != test.expect {
+			t.Errorf("[%s] expect %v, but got %v", desc, test.expect, actual)
+		}
+	}
+}
+
+func TestCountSiblings(t *testing.T) {
+	virtualLabels := map[string]string{"type": "virtual-kubelet"}
+	owner := metav1.OwnerReference{Kind: "ReplicaSet", Name: "web", UID: types.UID("web"), Controller: boolPtr(true)}
+	other := metav1.OwnerReference{Kind: "ReplicaSet", Name: "api", UID: types.UID("api"), Controller: boolPtr(true)}
+	newPod := func(name, nodeName string, ref metav1.OwnerReference, nodeSelector map[string]string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: []metav1.OwnerReference{ref}},
+			Spec:       v1.PodSpec{NodeName: nodeName, NodeSelector: nodeSelector},
+		}
+	}
+	finished := newPod("finished", "node-1", owner, nil)
+	finished.Status.Phase = v1.PodSucceeded
+	lister := &fakeClusterLister{
+		nodes: []*v1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "virtual-node-1", Labels: virtualLabels}},
+		},
+		pods: []*v1.Pod{
+			newPod("normal", "node-1", owner, nil),
+			newPod("pending", "", owner, nil),
+			newPod("virtual", "virtual-node-1", owner, nil),
+			newPod("virtual-pending", "", owner, virtualLabels),
+			newPod("other", "virtual-node-1", other, nil),
+			finished,
+		},
+	}
+	executor := &ReplicaSplitExecutor{virtualNode: NewVirtualNode(virtualLabels, nil), lister: lister}
+	normal, virtual, err := executor.countSiblings(newPod("new", "", owner, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if normal != 2 || virtual != 2 {
+		t.Errorf("expect 2 siblings on normal nodes and 2 on virtual nodes, but got %d and %d", normal, virtual)
+	}
+	normal, virtual, err = executor.countSiblings(newPod("orphan", "", metav1.OwnerReference{Kind: "DaemonSet", UID: types.UID("ds"), Controller: boolPtr(true)}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if normal != 0 || virtual != 0 {
+		t.Errorf("expect no siblings of unsupported owner, but got %d and %d", normal, virtual)
+	}
+}
+
+func TestReplicaSplitConcurrentAdmissions(t *testing.T) {
+	virtualLabels := map[string]string{"type": "virtual-kubelet"}
+	owner := metav1.OwnerReference{Kind: "ReplicaSet", Name: "web", UID: types.UID("web"), Controller: boolPtr(true)}
+	newPod := func(name, nodeName string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: []metav1.OwnerReference{owner}},
+			Spec:       v1.PodSpec{NodeName: nodeName},
+		}
+	}
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "virtual-node-1", Labels: virtualLabels}},
+	}
+	for desc, test := range map[string]struct {
+		split         *eciv1.ReplicaSplitPolicySource
+		normal        int
+		virtual       int
+		admissions    int
+		expectVirtual int
+	}{
+		"test ratio": {
+			split:         &eciv1.ReplicaSplitPolicySource{MaxVirtualRatio: int32Ptr(30)},
+			normal:        7,
+			virtual:       2,
+			admissions:    5,
+			expectVirtual: 2,
+		},
+		"test base replicas burst": {
+			split:         &eciv1.ReplicaSplitPolicySource{BaseReplicas: int32Ptr(10)},
+			admissions:    12,
+			expectVirtual: 2,
+		},
+	} {
+		lister := &fakeClusterLister{nodes: nodes}
+		for i := 0; i < test.normal; i++ {
+			lister.pods = append(lister.pods, newPod(fmt.Sprintf("normal-%d", i), "node-1"))
+		}
+		for i := 0; i < test.virtual; i++ {
+			lister.pods = append(lister.pods, newPod(fmt.Sprintf("virtual-%d", i), "virtual-node-1"))
+		}
+		executor := NewReplicaSplitExecutor(NewVirtualNode(virtualLabels, nil), lister)
+		selector := &eciv1.Selector{Spec: eciv1.SelectorSpec{Policy: &eciv1.PolicySource{ReplicaSplit: test.split}}}
+
+		// the pods are admitted before the informer sees any of them
+		var lock sync.Mutex
+		var wg sync.WaitGroup
+		virtual := 0
+		for i := 0; i < test.admissions; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				patchInfos, err := executor.OnPodCreating(selector, newPod("", ""))
+				if err != nil {
+					t.Errorf("[%s] unexpected error: %v", desc, err)
+				}
+				lock.Lock()
+				defer lock.Unlock()
+				if len(patchInfos) > 0 {
+					virtual++
+				}
+			}()
+		}
+		wg.Wait()
+		if virtual != test.expectVirtual {
+			t.Errorf("[%s] expect %d pods on virtual nodes, but got %d", desc, test.expectVirtual, virtual)
+		}
+	}
+}
+
+func TestReplicaSplitPendingPlacements(t *testing.T) {
+	virtualLabels := map[string]string{"type": "virtual-kubelet"}
+	owner := metav1.OwnerReference{Kind: "ReplicaSet", Name: "web", UID: types.UID("web"), Controller: boolPtr(true)}
+	lister := &fakeClusterLister{}
+	executor := NewReplicaSplitExecutor(NewVirtualNode(virtualLabels, nil), lister).(*ReplicaSplitExecutor)
+	selector := &eciv1.Selector{Spec: eciv1.SelectorSpec{Policy: &eciv1.PolicySource{ReplicaSplit: &eciv1.ReplicaSplitPolicySource{}}}}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", OwnerReferences: []metav1.OwnerReference{owner}}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := executor.OnPodCreating(selector, pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if normal, virtual, _ := executor.countSiblings(pod); normal != 0 || virtual != 2 {
+		t.Fatalf("expect 2 pending pods on virtual nodes, but got %d and %d", normal, virtual)
+	}
+	// one is a dry run, the other shows up in the informer
+	executor.release(pod, true)
+	created := pod.DeepCopy()
+	created.Name = "web-1"
+	created.Spec.NodeSelector = virtualLabels
+	lister.pods = append(lister.pods, created)
+	executor.observe(created)
+	if normal, virtual, _ := executor.countSiblings(pod); normal != 0 || virtual != 1 {
+		t.Errorf("expect only the created pod counted, but got %d and %d", normal, virtual)
+	}
+	// the placements of the pods never created expire
+	executor.placements.add(owner.UID, true, time.Now().Add(-2*pendingPlacementTTL))
+	if normal, virtual, _ := executor.countSiblings(pod); normal != 0 || virtual != 1 {
+		t.Errorf("expect the expired placement not counted, but got %d and %d", normal, virtual)
+	}
+}
@@ -2,50 +2,138 @@ package policy
 
 import (
 	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/resource"
 	"eci.io/eci-profile/pkg/utils"
+	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
 )
 
+// PlacementConflictError reports the node selector or node affinity of a pod
+// which excludes the virtual nodes the VirtualNodeOnly policy requires.
+type PlacementConflictError struct {
+	err error
+}
+
+func (e *PlacementConflictError) Error() string {
+	return e.err.Error()
+}
+
+// IsPlacementConflict reports whether the error is a PlacementConflictError.
+func IsPlacementConflict(err error) bool {
+	_, ok := errors.Cause(err).(*PlacementConflictError)
+	return ok
+}
+
 type VirtualNodeOnlyExecutor struct {
+	virtualNode *VirtualNode
+	topology    *topologyResolver
 }
 
-func NewVirtualNodeOnlyExecutor() Executor {
-	return &VirtualNodeOnlyExecutor{}
+func NewVirtualNodeOnlyExecutor(virtualNode *VirtualNode, rm *resource.Manager) Executor {
+	return &VirtualNodeOnlyExecutor{
+		virtualNode: virtualNode,
+		topology:    &topologyResolver{lister: rm, virtualNode: virtualNode},
+	}
 }
 
 func (e *VirtualNodeOnlyExecutor) OnPodCreating(selector *eciv1.Selector, pod *v1.Pod) ([]PatchInfo, error) {
 	var patchInfos []PatchInfo
-	if !existVirtualTolerations(pod.Spec.Tolerations) {
-		patchInfos = append(patchInfos, addVirtualNodeToleration(pod))
+	tolerations := e.virtualNode.Tolerations(selector)
+	if !existVirtualTolerations(pod.Spec.Tolerations, tolerations) {
+		patchInfos = append(patchInfos, addVirtualNodeToleration(pod, tolerations))
+	}
+	nodeSelector, err := e.checkPlacement(pod)
+	if err != nil {
+		return nil, err
 	}
-	patchInfos = append(patchInfos, addVirtualNodeSelector())
-	if len(selector.Spec.Effect.Annotations) > 0 {
-		patchInfos = append(patchInfos, addAnnotations(selector, pod))
+	if len(nodeSelector) != len(pod.Spec.NodeSelector) {
+		patchInfos = append(patchInfos, addVirtualNodeSelector(nodeSelector))
 	}
-	if len(selector.Spec.Effect.Labels) > 0 {
-		patchInfos = append(patchInfos, addLabels(selector, pod))
+	if pod.Spec.NodeName == "" {
+		// the pod is not bound yet, pin it to the virtual nodes of the preferred topology
+		topology := virtualNodeTopology(selector)
+		required, preferred, err := e.topology.resolve(topology, pod)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to resolve virtual node topology")
+		}
+		affinity := pod.Spec.Affinity
+		if len(required) > 0 || len(preferred) > 0 {
+			affinity = mergeNodeAffinity(affinity, required, preferred)
+		}
+		spread := affinity
+		affinity, err = e.topology.excludeOpenNodes(nodeSelector, affinity)
+		if err != nil {
+			e.topology.release(topology, pod, spread)
+			return nil, errors.Wrap(err, "failed to exclude the suspended virtual nodes")
+		}
+		if affinity != pod.Spec.Affinity {
+			patchInfos = append(patchInfos, addNodeAffinity(affinity))
+		}
+		if err := e.topology.checkVirtualNodes(nodeSelector, affinity); err != nil {
+			e.topology.release(topology, pod, spread)
+			return nil, errors.Wrap(err, "pod conflicts with the VirtualNodeOnly policy")
+		}
 	}
+	patchInfos = append(patchInfos, addAnnotations(selector, pod)...)
+	patchInfos = append(patchInfos, addLabels(selector, pod)...)
 	return patchInfos, nil
 }
 
 func (e *VirtualNodeOnlyExecutor) OnPodUnscheduled(selector *eciv1.Selector, pod *v1.Pod) (*utils.PatchOption, error) {
+	// the node selector is immutable now, a conflicting pod would not be
+	// scheduled to virtual nodes even with the tolerations
+	if _, err := e.checkPlacement(pod); err != nil {
+		return nil, err
+	}
 	patchOption := utils.NewPatchOption()
-	if !existVirtualTolerations(pod.Spec.Tolerations) {
-		tolerations := append(pod.Spec.Tolerations, virtualNodeToleration)
-		patchOption.WithTolerations(tolerations)
+	tolerations := e.virtualNode.Tolerations(selector)
+	if !existVirtualTolerations(pod.Spec.Tolerations, tolerations) {
+		patchOption.WithTolerations(appendVirtualTolerations(pod.Spec.Tolerations, tolerations))
 	}
-	patchOption.WithAnnotations(selector.Spec.Effect.Annotations).
-		WithLabels(selector.Spec.Effect.Labels)
+	patchOption.WithAnnotations(effectAnnotations(selector, pod)).
+		WithLabels(effectLabels(selector, pod))
 	return patchOption, nil
 }
 
 func (e *VirtualNodeOnlyExecutor) OnPodScheduled(selector *eciv1.Selector, pod *v1.Pod) (*utils.PatchOption, error) {
 	patchOption := utils.NewPatchOption()
-	if !existVirtualTolerations(pod.Spec.Tolerations) {
-		tolerations := append(pod.Spec.Tolerations, virtualNodeToleration)
-		patchOption.WithTolerations(tolerations)
+	tolerations := e.virtualNode.Tolerations(selector)
+	if !existVirtualTolerations(pod.Spec.Tolerations, tolerations) {
+		patchOption.WithTolerations(appendVirtualTolerations(pod.Spec.Tolerations, tolerations))
 	}
-	patchOption.WithAnnotations(selector.Spec.Effect.Annotations).
-		WithLabels(selector.Spec.Effect.Labels)
+	patchOption.WithAnnotations(effectAnnotations(selector, pod)).
+		WithLabels(effectLabels(selector, pod))
 	return patchOption, nil
 }
+
+// release forgets the zone given by OnPodCreating to a pod which isn't
+// created with the patches.
+func (e *VirtualNodeOnlyExecutor) release(selector *eciv1.Selector, pod *v1.Pod, patchInfos []PatchInfo) {
+	for _, patchInfo := range patchInfos {
+		if affinity, ok := patchInfo.Value.(*v1.Affinity); ok && patchInfo.Path == "/spec/affinity" {
+			e.topology.release(virtualNodeTopology(selector), pod, affinity)
+			return
+		}
+	}
+}
+
+func virtualNodeTopology(selector *eciv1.Selector) *eciv1.VirtualNodeTopology {
+	if selector.Spec.Policy == nil || selector.Spec.Policy.VirtualNodeOnly == nil {
+		return nil
+	}
+	return selector.Spec.Policy.VirtualNodeOnly.Topology
+}
+
+// checkPlacement merges the virtual node labels into the pod's node selector,
+// and reports the node selector or node affinity which excludes virtual nodes.
+func (e *VirtualNodeOnlyExecutor) checkPlacement(pod *v1.Pod) (map[string]string, error) {
+	nodeLabels := e.virtualNode.NodeSelector()
+	nodeSelector, err := mergeNodeSelector(pod.Spec.NodeSelector, nodeLabels)
+	if err != nil {
+		return nil, &PlacementConflictError{err: errors.Wrap(err, "pod conflicts with the VirtualNodeOnly policy")}
+	}
+	if err := checkNodeAffinityConflict(pod.Spec.Affinity, nodeLabels); err != nil {
+		return nil, &PlacementConflictError{err: errors.Wrap(err, "pod conflicts with the VirtualNodeOnly policy")}
+	}
+	return nodeSelector, nil
+}
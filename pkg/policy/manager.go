@@ -5,6 +5,7 @@ import (
 	"eci.io/eci-profile/pkg/resource"
 	"eci.io/eci-profile/pkg/utils"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
 )
 
 const (
@@ -12,41 +13,176 @@ const (
 	ExecutorNameNormalNodeOnly   = "NormalNodeOnly"
 	ExecutorNameNormalNodePrefer = "NormalNodePrefer"
 	ExecutorNameVirtualNodeOnly  = "VirtualNodeOnly"
+	ExecutorNameReplicaSplit     = "ReplicaSplit"
 )
 
 type Manager struct {
-	executors map[string]Executor
+	virtualNode     *VirtualNode
+	executors       map[string]Executor
+	replicaSplit    *ReplicaSplitExecutor
+	virtualNodeOnly *VirtualNodeOnlyExecutor
 }
 
-func NewManager(rm *resource.Manager) *Manager {
+func NewManager(rm *resource.Manager, virtualNode *VirtualNode) *Manager {
+	replicaSplit := NewReplicaSplitExecutor(virtualNode, rm)
+	virtualNodeOnly := NewVirtualNodeOnlyExecutor(virtualNode, rm)
 	return &Manager{
+		virtualNode: virtualNode,
 		executors: map[string]Executor{
-			ExecutorNameFair:             NewFairExecutor(),
+			ExecutorNameFair:             NewFairExecutor(virtualNode),
 			ExecutorNameNormalNodeOnly:   NewNormalNodeOnlyExecutor(),
-			ExecutorNameNormalNodePrefer: NewNormalNodePreferExecutor(),
-			ExecutorNameVirtualNodeOnly:  NewVirtualNodeOnlyExecutor(),
+			ExecutorNameNormalNodePrefer: NewNormalNodePreferExecutor(virtualNode),
+			ExecutorNameVirtualNodeOnly:  virtualNodeOnly,
+			ExecutorNameReplicaSplit:     replicaSplit,
 		},
+		replicaSplit:    replicaSplit.(*ReplicaSplitExecutor),
+		virtualNodeOnly: virtualNodeOnly.(*VirtualNodeOnlyExecutor),
 	}
 }
 
+func (m *Manager) IsVirtualNode(node *v1.Node) bool {
+	return m.virtualNode.IsVirtualNode(node)
+}
+
+// IsVirtualNodePod reports whether the pod is accounted against the virtual
+// node budgets: it's bound to a virtual node, or not bound yet but tolerates
+// the virtual nodes as the selector which mutated it requires, or selects
+// them. The node is the one the pod is bound to, nil if it isn't found.
+func (m *Manager) IsVirtualNodePod(selector *eciv1.Selector, pod *v1.Pod, node *v1.Node) bool {
+	if pod.DeletionTimestamp != nil || isTerminated(pod) {
+		return false
+	}
+	if pod.Spec.NodeName != "" {
+		return node != nil && m.virtualNode.IsVirtualNode(node)
+	}
+	tolerations := m.virtualNode.Tolerations(selector)
+	if len(tolerations) > 0 && existVirtualTolerations(pod.Spec.Tolerations, tolerations) {
+		return true
+	}
+	return m.virtualNode.IsSelectedBy(pod)
+}
+
+// IsVirtualNodeOnly reports whether the selector places the pod on virtual
+// nodes only.
+func (m *Manager) IsVirtualNodeOnly(selector *eciv1.Selector, pod *v1.Pod) bool {
+	return m.findExecutorName(selector, pod) == ExecutorNameVirtualNodeOnly
+}
+
 func (m *Manager) OnPodCreating(selector *eciv1.Selector, pod *v1.Pod) ([]PatchInfo, error) {
-	executor := m.findExecutor(selector)
-	return executor.OnPodCreating(selector, pod)
+	executorName := m.findExecutorName(selector, pod)
+	if pod.Spec.NodeName == "" && executorName != ExecutorNameVirtualNodeOnly && executorName != ExecutorNameReplicaSplit {
+		// only VirtualNodeOnly and ReplicaSplit pods may be placed on virtual nodes before scheduling
+		return nil, nil
+	}
+	patchInfos, err := m.executors[executorName].OnPodCreating(selector, pod)
+	if err != nil || len(patchInfos) == 0 {
+		return patchInfos, err
+	}
+	trace := newTrace(selector, executorName, PhaseCreating)
+	return AppendAnnotationPatch(pod, patchInfos, eciv1.AnnotationTrace, trace.String()), nil
+}
+
+// ReleasePlacement forgets the placement decided by OnPodCreating for a pod
+// which isn't created with the patches, e.g. on a dry run or when the
+// admission drops them later.
+func (m *Manager) ReleasePlacement(selector *eciv1.Selector, pod *v1.Pod, patchInfos []PatchInfo) {
+	if pod.Spec.NodeName != "" {
+		return
+	}
+	switch m.findExecutorName(selector, pod) {
+	case ExecutorNameReplicaSplit:
+		m.replicaSplit.release(pod, len(patchInfos) > 0 || m.virtualNode.IsSelectedBy(pod))
+	case ExecutorNameVirtualNodeOnly:
+		m.virtualNodeOnly.release(selector, pod, patchInfos)
+	}
+}
+
+// ObservePod forgets the placement and the zone decided at admission for a
+// pod seen in the informer.
+func (m *Manager) ObservePod(pod *v1.Pod) {
+	m.replicaSplit.observe(pod)
+	m.virtualNodeOnly.topology.observe(pod)
 }
 
+// AvoidVirtualNodes returns the patch requiring the pod not bound yet to stay
+// off the virtual nodes, even if it tolerates or selects them, nil if its node
+// affinity excludes them already.
+func (m *Manager) AvoidVirtualNodes(pod *v1.Pod) []PatchInfo {
+	if pod.Spec.NodeName != "" {
+		return nil
+	}
+	affinity := excludeNodeLabels(pod.Spec.Affinity, m.virtualNode.NodeSelector())
+	if affinity == pod.Spec.Affinity {
+		return nil
+	}
+	return []PatchInfo{addNodeAffinity(affinity)}
+}
+
+// OnPodUnscheduled returns nil when the pod has been mutated by the same
+// generation and effect of the selector while it was unscheduled.
 func (m *Manager) OnPodUnscheduled(selector *eciv1.Selector, pod *v1.Pod) (*utils.PatchOption, error) {
-	executor := m.findExecutor(selector)
-	return executor.OnPodUnscheduled(selector, pod)
+	executorName := m.findExecutorName(selector, pod)
+	trace := newTrace(selector, executorName, PhaseUnscheduled)
+	if isTraced(pod, trace) {
+		return nil, nil
+	}
+	patchOption, err := m.executors[executorName].OnPodUnscheduled(selector, pod)
+	return withTrace(patchOption, trace), err
 }
 
 func (m *Manager) OnPodScheduled(selector *eciv1.Selector, pod *v1.Pod) (*utils.PatchOption, error) {
-	executor := m.findExecutor(selector)
-	return executor.OnPodScheduled(selector, pod)
+	executorName := m.findExecutorName(selector, pod)
+	patchOption, err := m.executors[executorName].OnPodScheduled(selector, pod)
+	return withTrace(patchOption, newTrace(selector, executorName, PhaseScheduled)), err
 }
 
-func (m *Manager) findExecutor(selector *eciv1.Selector) Executor {
+// OnPodDrifted returns the patch of the effect annotations and labels missing
+// in the running pod, or nil if the pod doesn't drift from the effect. The
+// existing keys are only overwritten by the Enforce drift policy.
+func (m *Manager) OnPodDrifted(selector *eciv1.Selector, pod *v1.Pod) *utils.PatchOption {
+	effect := selector.Spec.Effect
+	if effect == nil {
+		return nil
+	}
+	mergePolicy := eciv1.EffectMergePolicyIfNotPresent
+	if selector.Spec.DriftPolicy == eciv1.DriftPolicyEnforce {
+		mergePolicy = effect.MergePolicy
+	}
+	patchOption := utils.NewPatchOption().
+		WithAnnotations(effectEntries(mergePolicy, pod.Annotations, effect.Annotations)).
+		WithLabels(effectEntries(mergePolicy, pod.Labels, effect.Labels))
+	if patchOption.IsEmpty() {
+		return nil
+	}
+	return withTrace(patchOption, newTrace(selector, m.findExecutorName(selector, pod), PhaseReconciled))
+}
+
+// isTraced reports whether the trace of the pod equals the given one.
+func isTraced(pod *v1.Pod, trace *Trace) bool {
+	current, err := GetTrace(pod)
+	if err != nil {
+		klog.Warningf("pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		return false
+	}
+	return current != nil && *current == *trace
+}
+
+// withTrace stamps the trace on the patch which mutates the pod.
+func withTrace(patchOption *utils.PatchOption, trace *Trace) *utils.PatchOption {
+	if patchOption == nil || patchOption.IsEmpty() {
+		return patchOption
+	}
+	return patchOption.WithAnnotation(eciv1.AnnotationTrace, trace.String())
+}
+
+// findExecutorName returns the executor of the pod, which depends on the pod
+// only for the StatefulSetOrdinal policy.
+func (m *Manager) findExecutorName(selector *eciv1.Selector, pod *v1.Pod) string {
 	executorName := ExecutorNameVirtualNodeOnly
 	policy := selector.Spec.Policy
+	if policy == nil {
+		return executorName
+	}
 	switch {
 	case policy.Fair != nil:
 		executorName = ExecutorNameFair
@@ -56,6 +192,10 @@ func (m *Manager) findExecutor(selector *eciv1.Selector) Executor {
 		executorName = ExecutorNameNormalNodeOnly
 	case policy.NormalNodePrefer != nil:
 		executorName = ExecutorNameNormalNodePrefer
+	case policy.ReplicaSplit != nil:
+		executorName = ExecutorNameReplicaSplit
+	case policy.StatefulSetOrdinal != nil:
+		executorName = ordinalExecutorName(policy.StatefulSetOrdinal, pod)
 	}
-	return m.executors[executorName]
+	return executorName
 }
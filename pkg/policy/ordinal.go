@@ -0,0 +1,41 @@
+package policy
+
+import (
+	"strconv"
+	"strings"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podIndexLabel is set on the StatefulSet pods since Kubernetes 1.28.
+const podIndexLabel = "apps.kubernetes.io/pod-index"
+
+// podOrdinal returns the StatefulSet ordinal of the pod, parsed from the pod
+// index label or else the suffix of the pod name after the StatefulSet name.
+func podOrdinal(pod *v1.Pod) (int, bool) {
+	if index, ok := pod.Labels[podIndexLabel]; ok {
+		ordinal, err := strconv.Atoi(index)
+		return ordinal, err == nil && ordinal >= 0
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "StatefulSet" || !strings.HasPrefix(pod.Name, owner.Name+"-") {
+		return 0, false
+	}
+	ordinal, err := strconv.Atoi(strings.TrimPrefix(pod.Name, owner.Name+"-"))
+	return ordinal, err == nil && ordinal >= 0
+}
+
+// ordinalExecutorName returns the executor of the pod by its ordinal, the pod
+// of no ordinal is kept on normal nodes.
+func ordinalExecutorName(source *eciv1.StatefulSetOrdinalPolicySource, pod *v1.Pod) string {
+	ordinal, ok := podOrdinal(pod)
+	if !ok || ordinal < int(source.Ordinal) {
+		return ExecutorNameNormalNodeOnly
+	}
+	if source.AboveOrdinal == eciv1.OrdinalPolicyFair {
+		return ExecutorNameFair
+	}
+	return ExecutorNameVirtualNodeOnly
+}
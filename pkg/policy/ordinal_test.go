@@ -0,0 +1,72 @@
+package policy
+
+import (
+	"testing"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newStatefulSetPod(name string, labels map[string]string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            name,
+		Labels:          labels,
+		OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "mysql", Controller: boolPtr(true)}},
+	}}
+}
+
+func TestPodOrdinal(t *testing.T) {
+	for desc, test := range map[string]struct {
+		pod     *v1.Pod
+		ordinal int
+		ok      bool
+	}{
+		"test pod name": {
+			pod:     newStatefulSetPod("mysql-2", nil),
+			ordinal: 2,
+			ok:      true,
+		},
+		"test pod index label": {
+			pod:     newStatefulSetPod("mysql-2", map[string]string{podIndexLabel: "3"}),
+			ordinal: 3,
+			ok:      true,
+		},
+		"test invalid pod index label": {
+			pod: newStatefulSetPod("mysql-2", map[string]string{podIndexLabel: "x"}),
+		},
+		"test pod name of other owner": {
+			pod: newStatefulSetPod("redis-2", nil),
+		},
+		"test no owner": {
+			pod: &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "mysql-2"}},
+		},
+	} {
+		ordinal, ok := podOrdinal(test.pod)
+		if ordinal != test.ordinal || ok != test.ok {
+			t.Errorf("[%s] expect ordinal %d and %v, but got %d and %v", desc, test.ordinal, test.ok, ordinal, ok)
+		}
+	}
+}
+
+func TestFindExecutorNameByOrdinal(t *testing.T) {
+	m := &Manager{}
+	selector := &eciv1.Selector{Spec: eciv1.SelectorSpec{Policy: &eciv1.PolicySource{
+		StatefulSetOrdinal: &eciv1.StatefulSetOrdinalPolicySource{Ordinal: 2},
+	}}}
+	for name, expect := range map[string]string{
+		"mysql-0": ExecutorNameNormalNodeOnly,
+		"mysql-1": ExecutorNameNormalNodeOnly,
+		"mysql-2": ExecutorNameVirtualNodeOnly,
+		"mysql-9": ExecutorNameVirtualNodeOnly,
+		"mysql":   ExecutorNameNormalNodeOnly,
+	} {
+		if actual := m.findExecutorName(selector, newStatefulSetPod(name, nil)); actual != expect {
+			t.Errorf("%s: expect executor %s, but got %s", name, expect, actual)
+		}
+	}
+	selector.Spec.Policy.StatefulSetOrdinal.AboveOrdinal = eciv1.OrdinalPolicyFair
+	if actual := m.findExecutorName(selector, newStatefulSetPod("mysql-2", nil)); actual != ExecutorNameFair {
+		t.Errorf("expect executor %s, but got %s", ExecutorNameFair, actual)
+	}
+}
@@ -0,0 +1,205 @@
+package policy
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// mergeNodeSelector returns the pod's node selector with the virtual node
+// labels added, or an error when the pod selects other values for them.
+func mergeNodeSelector(podNodeSelector, nodeSelector map[string]string) (map[string]string, error) {
+	merged := make(map[string]string, len(podNodeSelector)+len(nodeSelector))
+	for key, value := range podNodeSelector {
+		merged[key] = value
+	}
+	keys := make([]string, 0, len(nodeSelector))
+	for key := range nodeSelector {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value, ok := merged[key]; ok && value != nodeSelector[key] {
+			return nil, fmt.Errorf("nodeSelector %s=%s conflicts with the virtual node label %s=%s", key, value, key, nodeSelector[key])
+		}
+		merged[key] = nodeSelector[key]
+	}
+	return merged, nil
+}
+
+// checkNodeAffinityConflict reports an error when none of the required node
+// affinity terms of the pod allows the virtual node labels.
+func checkNodeAffinityConflict(affinity *v1.Affinity, nodeLabels map[string]string) error {
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) == 0 {
+		return nil
+	}
+	for _, term := range terms {
+		if termAllowsLabels(term, nodeLabels) {
+			return nil
+		}
+	}
+	return fmt.Errorf("required nodeAffinity excludes the virtual node labels %v", nodeLabels)
+}
+
+// termAllowsLabels evaluates the requirements of the term on the given keys
+// only, the requirements on other keys are unknown and regarded as satisfied.
+func termAllowsLabels(term v1.NodeSelectorTerm, nodeLabels map[string]string) bool {
+	for _, requirement := range term.MatchExpressions {
+		if _, ok := nodeLabels[requirement.Key]; !ok {
+			continue
+		}
+		if !matchNodeSelectorRequirement(requirement, nodeLabels) {
+			return false
+		}
+	}
+	return true
+}
+
+// excludeNodes ANDs a requirement excluding the named nodes into every
+// required term of the pod's node affinity.
+func excludeNodes(affinity *v1.Affinity, names []string) *v1.Affinity {
+	if affinity == nil {
+		affinity = &v1.Affinity{}
+	} else {
+		affinity = affinity.DeepCopy()
+	}
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &v1.NodeAffinity{}
+	}
+	nodeAffinity := affinity.NodeAffinity
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil ||
+		len(nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms) == 0 {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{{}},
+		}
+	}
+	requirement := v1.NodeSelectorRequirement{Key: "metadata.name", Operator: v1.NodeSelectorOpNotIn, Values: names}
+	terms := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for i := range terms {
+		terms[i].MatchFields = append(terms[i].MatchFields, requirement)
+	}
+	return affinity
+}
+
+// excludeNodeLabels ANDs the requirements excluding the nodes with any of
+// the labels into every required term of the pod's node affinity, the
+// affinity is returned as is if every term excludes them already.
+func excludeNodeLabels(affinity *v1.Affinity, nodeLabels map[string]string) *v1.Affinity {
+	keys := make([]string, 0, len(nodeLabels))
+	for key := range nodeLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var requirements []v1.NodeSelectorRequirement
+	for _, key := range keys {
+		requirements = append(requirements, v1.NodeSelectorRequirement{Key: key, Operator: v1.NodeSelectorOpNotIn, Values: []string{nodeLabels[key]}})
+	}
+	if affinity != nil && affinity.NodeAffinity != nil && affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		excluded := len(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms) > 0
+		for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			for _, requirement := range requirements {
+				if !containsRequirement(term.MatchExpressions, requirement) {
+					excluded = false
+				}
+			}
+		}
+		if excluded {
+			return affinity
+		}
+	}
+	return mergeNodeAffinity(affinity, requirements, nil)
+}
+
+func containsRequirement(requirements []v1.NodeSelectorRequirement, requirement v1.NodeSelectorRequirement) bool {
+	for _, r := range requirements {
+		if reflect.DeepEqual(r, requirement) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchNodeSelector reports whether the node satisfies the node selector and
+// the required node affinity of the pod.
+func matchNodeSelector(node *v1.Node, nodeSelector map[string]string, affinity *v1.Affinity) bool {
+	for key, value := range nodeSelector {
+		if node.Labels[key] != value {
+			return false
+		}
+	}
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for _, term := range terms {
+		if matchNodeSelectorTerm(term, node) {
+			return true
+		}
+	}
+	return len(terms) == 0
+}
+
+func matchNodeSelectorTerm(term v1.NodeSelectorTerm, node *v1.Node) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+	for _, requirement := range term.MatchExpressions {
+		if !matchNodeSelectorRequirement(requirement, node.Labels) {
+			return false
+		}
+	}
+	fields := map[string]string{"metadata.name": node.Name}
+	for _, requirement := range term.MatchFields {
+		if !matchNodeSelectorRequirement(requirement, fields) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchNodeSelectorRequirement(requirement v1.NodeSelectorRequirement, nodeLabels map[string]string) bool {
+	value, exists := nodeLabels[requirement.Key]
+	switch requirement.Operator {
+	case v1.NodeSelectorOpIn:
+		return exists && containsString(requirement.Values, value)
+	case v1.NodeSelectorOpNotIn:
+		return !exists || !containsString(requirement.Values, value)
+	case v1.NodeSelectorOpExists:
+		return exists
+	case v1.NodeSelectorOpDoesNotExist:
+		return !exists
+	case v1.NodeSelectorOpGt, v1.NodeSelectorOpLt:
+		if !exists || len(requirement.Values) != 1 {
+			return false
+		}
+		actual, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		expect, err := strconv.ParseInt(requirement.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+		if requirement.Operator == v1.NodeSelectorOpGt {
+			return actual > expect
+		}
+		return actual < expect
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVirtualNodeOnlyOnPodCreatingWithNodeSelector(t *testing.T) {
+	vnode := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "vnode",
+		Labels: map[string]string{vnodeNodeSelectorKey: vnodeNodeSelectorVal, v1.LabelArchStable: "amd64"},
+	}}
+	normalNode := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "node",
+		Labels: map[string]string{"node-role": "idc", v1.LabelArchStable: "amd64"},
+	}}
+	selector := &eciv1.Selector{
+		Spec: eciv1.SelectorSpec{
+			Effect: &eciv1.SideEffect{},
+			Policy: &eciv1.PolicySource{VirtualNodeOnly: &eciv1.VirtualNodeOnlyPolicySource{}},
+		},
+	}
+	for desc, test := range map[string]struct {
+		pod         *v1.Pod
+		expect      map[string]string
+		expectPatch bool
+		expectErr   bool
+	}{
+		"test pod without node selector": {
+			pod:         &v1.Pod{},
+			expect:      map[string]string{vnodeNodeSelectorKey: vnodeNodeSelectorVal},
+			expectPatch: true,
+		},
+		"test pod with node selector": {
+			pod:         &v1.Pod{Spec: v1.PodSpec{NodeSelector: map[string]string{v1.LabelArchStable: "amd64"}}},
+			expect:      map[string]string{vnodeNodeSelectorKey: vnodeNodeSelectorVal, v1.LabelArchStable: "amd64"},
+			expectPatch: true,
+		},
+		"test pod with virtual node selector": {
+			pod: &v1.Pod{Spec: v1.PodSpec{NodeSelector: map[string]string{vnodeNodeSelectorKey: vnodeNodeSelectorVal}}},
+		},
+		"test pod with conflicting node selector": {
+			pod:       &v1.Pod{Spec: v1.PodSpec{NodeSelector: map[string]string{vnodeNodeSelectorKey: "false"}}},
+			expectErr: true,
+		},
+		"test pod pinned to normal node label": {
+			pod:       &v1.Pod{Spec: v1.PodSpec{NodeSelector: map[string]string{"node-role": "idc"}}},
+			expectErr: true,
+		},
+		"test pod with conflicting node affinity": {
+			pod: &v1.Pod{Spec: v1.PodSpec{Affinity: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{
+					MatchExpressions: []v1.NodeSelectorRequirement{{Key: vnodeNodeSelectorKey, Operator: v1.NodeSelectorOpDoesNotExist}},
+				}}},
+			}}}},
+			expectErr: true,
+		},
+	} {
+		vn := newTestVirtualNode()
+		executor := &VirtualNodeOnlyExecutor{
+			virtualNode: vn,
+			topology:    &topologyResolver{lister: &fakeClusterLister{nodes: []*v1.Node{vnode, normalNode}}, virtualNode: vn},
+		}
+		patchInfos, err := executor.OnPodCreating(selector, test.pod)
+		if (err != nil) != test.expectErr {
+			t.Fatalf("[%s] executor on pod creating failed, err: %v", desc, err)
+		}
+		var actual map[string]string
+		for _, patchInfo := range patchInfos {
+			if patchInfo.Path == "/spec/nodeSelector" {
+				if patchInfo.Op != "add" {
+					t.Fatalf("[%s] executor on pod creating failed, op: %s", desc, patchInfo.Op)
+				}
+				actual = patchInfo.Value.(map[string]string)
+			}
+		}
+		if (actual != nil) != test.expectPatch || (test.expectPatch && !reflect.DeepEqual(actual, test.expect)) {
+			t.Fatalf("[%s] executor on pod creating failed, actual: %v, expect: %v", desc, actual, test.expect)
+		}
+	}
+}
+
+func TestMatchNodeSelectorRequirement(t *testing.T) {
+	nodeLabels := map[string]string{"foo": "boo", "cpu": "8"}
+	for desc, test := range map[string]struct {
+		requirement v1.NodeSelectorRequirement
+		expect      bool
+	}{
+		"test in":             {v1.NodeSelectorRequirement{Key: "foo", Operator: v1.NodeSelectorOpIn, Values: []string{"boo"}}, true},
+		"test not in":         {v1.NodeSelectorRequirement{Key: "foo", Operator: v1.NodeSelectorOpNotIn, Values: []string{"boo"}}, false},
+		"test not in missing": {v1.NodeSelectorRequirement{Key: "bar", Operator: v1.NodeSelectorOpNotIn, Values: []string{"boo"}}, true},
+		"test exists":         {v1.NodeSelectorRequirement{Key: "foo", Operator: v1.NodeSelectorOpExists}, true},
+		"test does not exist": {v1.NodeSelectorRequirement{Key: "foo", Operator: v1.NodeSelectorOpDoesNotExist}, false},
+		"test gt":             {v1.NodeSelectorRequirement{Key: "cpu", Operator: v1.NodeSelectorOpGt, Values: []string{"4"}}, true},
+		"test lt":             {v1.NodeSelectorRequirement{Key: "cpu", Operator: v1.NodeSelectorOpLt, Values: []string{"4"}}, false},
+	} {
+		if actual := matchNodeSelectorRequirement(test.requirement, nodeLabels); actual != test.expect {
+			t.Fatalf("[%s] match node selector requirement failed, actual: %v, expect: %v", desc, actual, test.expect)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package policy
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	defaultTopologyKey     = v1.LabelTopologyZone
+	spreadPreferenceWeight = 100
+)
+
+// clusterLister lists the objects cached by the resource manager.
+type clusterLister interface {
+	ListNodes() ([]*v1.Node, error)
+	ListPods(namespace string) ([]*v1.Pod, error)
+}
+
+// topologyResolver picks the virtual nodes for a pod according to the zones
+// of the virtual nodes found in the node informer.
+type topologyResolver struct {
+	lister      clusterLister
+	virtualNode *VirtualNode
+	// lock serializes the spreading, so that the concurrent admissions of a
+	// scale-up count the zones given to each other
+	lock  sync.Mutex
+	zones pendingZones
+}
+
+// pendingZones are the zones given at admission to the pods not seen in the
+// informer yet, keyed by the UID of the owner.
+type pendingZones struct {
+	lock   sync.Mutex
+	owners map[types.UID][]pendingZone
+}
+
+type pendingZone struct {
+	topologyKey string
+	zone        string
+	expires     time.Time
+}
+
+func (p *pendingZones) add(owner types.UID, topologyKey, zone string, now time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.owners == nil {
+		p.owners = map[types.UID][]pendingZone{}
+	}
+	p.owners[owner] = append(p.owners[owner], pendingZone{topologyKey: topologyKey, zone: zone, expires: now.Add(pendingPlacementTTL)})
+}
+
+// remove forgets the oldest zone of the owner the affinity prefers.
+func (p *pendingZones) remove(owner types.UID, affinity *v1.Affinity) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	zones := p.owners[owner]
+	for i := range zones {
+		if zones[i].zone == preferredZoneOfAffinity(affinity, zones[i].topologyKey) {
+			zones = append(zones[:i:i], zones[i+1:]...)
+			break
+		}
+	}
+	if len(zones) == 0 {
+		delete(p.owners, owner)
+		return
+	}
+	p.owners[owner] = zones
+}
+
+// count returns the unexpired zones of the owner on the topology key.
+func (p *pendingZones) count(owner types.UID, topologyKey string, now time.Time) map[string]int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var live []pendingZone
+	counts := map[string]int{}
+	for _, zone := range p.owners[owner] {
+		if now.After(zone.expires) {
+			continue
+		}
+		live = append(live, zone)
+		if zone.topologyKey == topologyKey {
+			counts[zone.zone]++
+		}
+	}
+	if len(live) == 0 {
+		delete(p.owners, owner)
+	} else {
+		p.owners[owner] = live
+	}
+	return counts
+}
+
+type weightedZone struct {
+	zone   string
+	weight int32
+}
+
+// resolve returns the node selector requirements the pod must satisfy and the
+// scheduling terms it prefers.
+func (r *topologyResolver) resolve(topology *eciv1.VirtualNodeTopology, pod *v1.Pod) ([]v1.NodeSelectorRequirement, []v1.PreferredSchedulingTerm, error) {
+	if topology == nil {
+		return nil, nil, nil
+	}
+	topologyKey := topologyKeyOf(topology)
+	var required []v1.NodeSelectorRequirement
+	if len(topology.RequiredZones) > 0 {
+		required = append(required, v1.NodeSelectorRequirement{
+			Key:      topologyKey,
+			Operator: v1.NodeSelectorOpIn,
+			Values:   topology.RequiredZones,
+		})
+	}
+
+	zones := preferredZones(topology)
+	if topology.Spread {
+		nodeZones, err := r.virtualNodeZones(topologyKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(zones) == 0 {
+			zones = distinctZones(nodeZones)
+		}
+		zones = filterZones(zones, topology.RequiredZones, nodeZones)
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		counts, err := r.countOwnerPods(pod, topologyKey, nodeZones)
+		if err != nil {
+			return nil, nil, err
+		}
+		if zone := chooseSpreadZone(zones, counts); zone != "" {
+			zones = []weightedZone{{zone: zone, weight: spreadPreferenceWeight}}
+			if owner := metav1.GetControllerOf(pod); owner != nil {
+				r.zones.add(owner.UID, topologyKey, zone, time.Now())
+			}
+		}
+	}
+
+	var preferred []v1.PreferredSchedulingTerm
+	for _, zone := range zones {
+		preferred = append(preferred, v1.PreferredSchedulingTerm{
+			Weight: zone.weight,
+			Preference: v1.NodeSelectorTerm{
+				MatchExpressions: []v1.NodeSelectorRequirement{
+					{Key: topologyKey, Operator: v1.NodeSelectorOpIn, Values: []string{zone.zone}},
+				},
+			},
+		})
+	}
+	return required, preferred, nil
+}
+
+// checkVirtualNodes reports an error when there are virtual nodes but none of
+// them satisfies the node selector and the required node affinity.
+func (r *topologyResolver) checkVirtualNodes(nodeSelector map[string]string, affinity *v1.Affinity) error {
+	nodes, err := r.lister.ListNodes()
+	if err != nil {
+		return errors.Wrap(err, "failed to list nodes")
+	}
+	count := 0
+	for _, node := range nodes {
+		if !r.virtualNode.IsVirtualNode(node) {
+			continue
+		}
+		if matchNodeSelector(node, nodeSelector, affinity) {
+			return nil
+		}
+		count++
+	}
+	if count > 0 {
+		return errors.Errorf("none of the %d virtual nodes matches the nodeSelector and nodeAffinity", count)
+	}
+	return nil
+}
+
+// excludeOpenNodes excludes the virtual nodes whose breakers are open from
+// the pod's required node affinity, unless none of the other virtual nodes
+// matches the pod, which then waits for them to recover.
+func (r *topologyResolver) excludeOpenNodes(nodeSelector map[string]string, affinity *v1.Affinity) (*v1.Affinity, error) {
+	open := r.virtualNode.OpenNodes()
+	if len(open) == 0 {
+		return affinity, nil
+	}
+	nodes, err := r.lister.ListNodes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+	excluded := excludeNodes(affinity, open)
+	for _, node := range nodes {
+		if r.virtualNode.IsVirtualNode(node) && matchNodeSelector(node, nodeSelector, excluded) {
+			return excluded, nil
+		}
+	}
+	return affinity, nil
+}
+
+// release forgets the zone given to a pod which isn't created with the
+// affinity, e.g. on a dry run.
+func (r *topologyResolver) release(topology *eciv1.VirtualNodeTopology, pod *v1.Pod, affinity *v1.Affinity) {
+	if topology == nil || !topology.Spread {
+		return
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		r.zones.remove(owner.UID, affinity)
+	}
+}
+
+// observe forgets the zone given to a pod seen in the informer, which is
+// counted from the informer from now on.
+func (r *topologyResolver) observe(pod *v1.Pod) {
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		r.zones.remove(owner.UID, pod.Spec.Affinity)
+	}
+}
+
+// virtualNodeZones maps the name of every virtual node to its zone.
+func (r *topologyResolver) virtualNodeZones(topologyKey string) (map[string]string, error) {
+	nodes, err := r.lister.ListNodes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+	nodeZones := map[string]string{}
+	for _, node := range nodes {
+		if !r.virtualNode.IsVirtualNode(node) {
+			continue
+		}
+		if zone, ok := node.Labels[topologyKey]; ok {
+			nodeZones[node.Name] = zone
+		}
+	}
+	return nodeZones, nil
+}
+
+// countOwnerPods counts the pods of the same controller on every zone, the
+// pods not bound yet are counted by the zone they were given at creation, and
+// the pods not seen in the informer yet by the zone given at admission, so
+// that a burst of new pods is spread too.
+func (r *topologyResolver) countOwnerPods(pod *v1.Pod, topologyKey string, nodeZones map[string]string) (map[string]int, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return map[string]int{}, nil
+	}
+	counts := r.zones.count(owner.UID, topologyKey, time.Now())
+	pods, err := r.lister.ListPods(pod.Namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+	for _, sibling := range pods {
+		siblingOwner := metav1.GetControllerOf(sibling)
+		if siblingOwner == nil || siblingOwner.UID != owner.UID || sibling.DeletionTimestamp != nil || isTerminated(sibling) {
+			continue
+		}
+		if sibling.Spec.NodeName == "" {
+			if zone := preferredZoneOf(sibling, topologyKey); zone != "" {
+				counts[zone]++
+			}
+			continue
+		}
+		if zone, ok := nodeZones[sibling.Spec.NodeName]; ok {
+			counts[zone]++
+		}
+	}
+	return counts, nil
+}
+
+// preferredZoneOf returns the zone of the heaviest preferred term selecting a
+// single zone, which is the zone chosen by the spreading.
+func preferredZoneOf(pod *v1.Pod, topologyKey string) string {
+	return preferredZoneOfAffinity(pod.Spec.Affinity, topologyKey)
+}
+
+func preferredZoneOfAffinity(affinity *v1.Affinity, topologyKey string) string {
+	if affinity == nil || affinity.NodeAffinity == nil {
+		return ""
+	}
+	zone := ""
+	var weight int32
+	for _, term := range affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		for _, requirement := range term.Preference.MatchExpressions {
+			if requirement.Key != topologyKey || requirement.Operator != v1.NodeSelectorOpIn || len(requirement.Values) != 1 {
+				continue
+			}
+			if zone == "" || term.Weight > weight {
+				zone, weight = requirement.Values[0], term.Weight
+			}
+		}
+	}
+	return zone
+}
+
+func topologyKeyOf(topology *eciv1.VirtualNodeTopology) string {
+	if topology.TopologyKey == "" {
+		return defaultTopologyKey
+	}
+	return topology.TopologyKey
+}
+
+func preferredZones(topology *eciv1.VirtualNodeTopology) []weightedZone {
+	var zones []weightedZone
+	for _, zone := range topology.PreferredZones {
+		weight := zone.Weight
+		if weight < 1 {
+			weight = 1
+		}
+		if weight > 100 {
+			weight = 100
+		}
+		zones = append(zones, weightedZone{zone: zone.Zone, weight: weight})
+	}
+	return zones
+}
+
+func distinctZones(nodeZones map[string]string) []weightedZone {
+	set := map[string]bool{}
+	for _, zone := range nodeZones {
+		set[zone] = true
+	}
+	var zones []weightedZone
+	for zone := range set {
+		zones = append(zones, weightedZone{zone: zone, weight: 1})
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].zone < zones[j].zone })
+	return zones
+}
+
+// filterZones keeps the zones which are required and own virtual nodes.
+func filterZones(zones []weightedZone, requiredZones []string, nodeZones map[string]string) []weightedZone {
+	available := map[string]bool{}
+	for _, zone := range nodeZones {
+		available[zone] = true
+	}
+	required := map[string]bool{}
+	for _, zone := range requiredZones {
+		required[zone] = true
+	}
+	var result []weightedZone
+	for _, zone := range zones {
+		if !available[zone.zone] || (len(required) > 0 && !required[zone.zone]) {
+			continue
+		}
+		result = append(result, zone)
+	}
+	return result
+}
+
+// chooseSpreadZone picks the zone whose pod count lags furthest behind its
+// weight, the first zone wins on a tie.
+func chooseSpreadZone(zones []weightedZone, counts map[string]int) string {
+	chosen := ""
+	var chosenScore float64
+	for _, zone := range zones {
+		score := float64(counts[zone.zone]+1) / float64(zone.weight)
+		if chosen == "" || score < chosenScore {
+			chosen, chosenScore = zone.zone, score
+		}
+	}
+	return chosen
+}
+
+// mergeNodeAffinity ANDs the requirements into every required term of the
+// pod's node affinity and appends the preferred terms.
+func mergeNodeAffinity(affinity *v1.Affinity, required []v1.NodeSelectorRequirement, preferred []v1.PreferredSchedulingTerm) *v1.Affinity {
+	if affinity == nil {
+		affinity = &v1.Affinity{}
+	} else {
+		affinity = affinity.DeepCopy()
+	}
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &v1.NodeAffinity{}
+	}
+	nodeAffinity := affinity.NodeAffinity
+	if len(required) > 0 {
+		if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil ||
+			len(nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms) == 0 {
+			nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{
+				NodeSelectorTerms: []v1.NodeSelectorTerm{{}},
+			}
+		}
+		terms := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+		for i := range terms {
+			terms[i].MatchExpressions = append(terms[i].MatchExpressions, required...)
+		}
+	}
+	nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, preferred...)
+	return affinity
+}
+
+func addNodeAffinity(affinity *v1.Affinity) PatchInfo {
+	return PatchInfo{
+		Op:    "add",
+		Path:  "/spec/affinity",
+		Value: affinity,
+	}
+}
@@ -0,0 +1,271 @@
+package policy
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type fakeClusterLister struct {
+	nodes []*v1.Node
+	pods  []*v1.Pod
+}
+
+func (l *fakeClusterLister) ListNodes() ([]*v1.Node, error) {
+	return l.nodes, nil
+}
+
+func (l *fakeClusterLister) ListPods(namespace string) ([]*v1.Pod, error) {
+	return l.pods, nil
+}
+
+func TestChooseSpreadZone(t *testing.T) {
+	for desc, test := range map[string]struct {
+		zones  []weightedZone
+		counts map[string]int
+		expect string
+	}{
+		"test no zones": {
+			expect: "",
+		},
+		"test equal weights": {
+			zones:  []weightedZone{{zone: "a", weight: 1}, {zone: "b", weight: 1}},
+			counts: map[string]int{"a": 2, "b": 1},
+			expect: "b",
+		},
+		"test tie picks first zone": {
+			zones:  []weightedZone{{zone: "a", weight: 1}, {zone: "b", weight: 1}},
+			counts: map[string]int{},
+			expect: "a",
+		},
+		"test weighted zones": {
+			zones:  []weightedZone{{zone: "a", weight: 3}, {zone: "b", weight: 1}},
+			counts: map[string]int{"a": 2, "b": 0},
+			expect: "a",
+		},
+		"test weighted zones lagging": {
+			zones:  []weightedZone{{zone: "a", weight: 3}, {zone: "b", weight: 1}},
+			counts: map[string]int{"a": 3, "b": 0},
+			expect: "b",
+		},
+	} {
+		if actual := chooseSpreadZone(test.zones, test.counts); actual != test.expect {
+			t.Fatalf("[%s] choose spread zone failed, actual: %s, expect: %s", desc, actual, test.expect)
+		}
+	}
+}
+
+func TestFilterZones(t *testing.T) {
+	zones := []weightedZone{{zone: "a", weight: 1}, {zone: "b", weight: 1}, {zone: "c", weight: 1}}
+	nodeZones := map[string]string{"vnode-a": "a", "vnode-b": "b"}
+	actual := filterZones(zones, []string{"b", "c"}, nodeZones)
+	expect := []weightedZone{{zone: "b", weight: 1}}
+	if !reflect.DeepEqual(actual, expect) {
+		t.Fatalf("filter zones failed, actual: %v, expect: %v", actual, expect)
+	}
+}
+
+func TestResolveSpreadCountsPendingPods(t *testing.T) {
+	vn := newTestVirtualNode()
+	newVirtualNode := func(name, zone string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+			vnodeNodeSelectorKey: vnodeNodeSelectorVal,
+			v1.LabelTopologyZone: zone,
+		}}}
+	}
+	owner := metav1.OwnerReference{Kind: "ReplicaSet", Name: "web", UID: types.UID("web"), Controller: boolPtr(true)}
+	newPod := func(name, nodeName string, affinity *v1.Affinity) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: []metav1.OwnerReference{owner}},
+			Spec:       v1.PodSpec{NodeName: nodeName, Affinity: affinity},
+		}
+	}
+	topology := &eciv1.VirtualNodeTopology{Spread: true}
+	lister := &fakeClusterLister{nodes: []*v1.Node{newVirtualNode("vnode-a", "a"), newVirtualNode("vnode-b", "b")}}
+	resolver := &topologyResolver{lister: lister, virtualNode: vn}
+	// a burst of pods not bound yet, every pod is given the zone lagging behind
+	var zones []string
+	for i := 0; i < 4; i++ {
+		pod := newPod(fmt.Sprintf("web-%d", i), "", nil)
+		_, preferred, err := resolver.resolve(topology, pod)
+		if err != nil {
+			t.Fatalf("resolve topology failed, err: %v", err)
+		}
+		pod.Spec.Affinity = mergeNodeAffinity(nil, nil, preferred)
+		zones = append(zones, preferredZoneOf(pod, v1.LabelTopologyZone))
+		lister.pods = append(lister.pods, pod)
+		resolver.observe(pod)
+	}
+	if expect := []string{"a", "b", "a", "b"}; !reflect.DeepEqual(zones, expect) {
+		t.Fatalf("resolve spread zones failed, actual: %v, expect: %v", zones, expect)
+	}
+
+	// the bound pods are counted by the zone of their nodes
+	lister.pods = []*v1.Pod{newPod("web-0", "vnode-a", nil), newPod("web-1", "vnode-a", nil), lister.pods[1]}
+	counts, err := resolver.countOwnerPods(newPod("web-4", "", nil), v1.LabelTopologyZone, map[string]string{"vnode-a": "a", "vnode-b": "b"})
+	if err != nil {
+		t.Fatalf("count owner pods failed, err: %v", err)
+	}
+	if expect := map[string]int{"a": 2, "b": 1}; !reflect.DeepEqual(counts, expect) {
+		t.Fatalf("count owner pods failed, actual: %v, expect: %v", counts, expect)
+	}
+}
+
+func TestResolveSpreadConcurrentAdmissions(t *testing.T) {
+	vn := newTestVirtualNode()
+	newVirtualNode := func(name, zone string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+			vnodeNodeSelectorKey: vnodeNodeSelectorVal,
+			v1.LabelTopologyZone: zone,
+		}}}
+	}
+	owner := metav1.OwnerReference{Kind: "ReplicaSet", Name: "web", UID: types.UID("web"), Controller: boolPtr(true)}
+	newPod := func() *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", OwnerReferences: []metav1.OwnerReference{owner}}}
+	}
+	topology := &eciv1.VirtualNodeTopology{Spread: true}
+	lister := &fakeClusterLister{nodes: []*v1.Node{newVirtualNode("vnode-a", "a"), newVirtualNode("vnode-b", "b")}}
+	resolver := &topologyResolver{lister: lister, virtualNode: vn}
+
+	// the pods are admitted before the informer sees any of them
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	affinities := map[string][]*v1.Affinity{}
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, preferred, err := resolver.resolve(topology, newPod())
+			if err != nil {
+				t.Errorf("resolve topology failed, err: %v", err)
+			}
+			affinity := mergeNodeAffinity(nil, nil, preferred)
+			lock.Lock()
+			defer lock.Unlock()
+			zone := preferredZoneOfAffinity(affinity, v1.LabelTopologyZone)
+			affinities[zone] = append(affinities[zone], affinity)
+		}()
+	}
+	wg.Wait()
+	if len(affinities["a"]) != 3 || len(affinities["b"]) != 3 {
+		t.Fatalf("expect the pods spread evenly, but got %d in a and %d in b", len(affinities["a"]), len(affinities["b"]))
+	}
+
+	// the zones of the pods not created are released, and the pods seen in the
+	// informer are counted from there
+	resolver.release(topology, newPod(), affinities["a"][0])
+	resolver.release(topology, newPod(), affinities["a"][1])
+	seen := newPod()
+	seen.Spec.Affinity = affinities["b"][0]
+	lister.pods = append(lister.pods, seen)
+	resolver.observe(seen)
+	counts, err := resolver.countOwnerPods(newPod(), v1.LabelTopologyZone, map[string]string{"vnode-a": "a", "vnode-b": "b"})
+	if err != nil {
+		t.Fatalf("count owner pods failed, err: %v", err)
+	}
+	if expect := map[string]int{"a": 1, "b": 3}; !reflect.DeepEqual(counts, expect) {
+		t.Fatalf("count owner pods failed, actual: %v, expect: %v", counts, expect)
+	}
+}
+
+func TestMergeNodeAffinity(t *testing.T) {
+	vnodeRequirement := v1.NodeSelectorRequirement{Key: vnodeNodeSelectorKey, Operator: v1.NodeSelectorOpIn, Values: []string{vnodeNodeSelectorVal}}
+	archRequirement := v1.NodeSelectorRequirement{Key: v1.LabelArchStable, Operator: v1.NodeSelectorOpIn, Values: []string{"amd64"}}
+	preferred := v1.PreferredSchedulingTerm{
+		Weight:     10,
+		Preference: v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"a"}}}},
+	}
+	for desc, test := range map[string]struct {
+		affinity *v1.Affinity
+		expect   *v1.Affinity
+	}{
+		"test nil affinity": {
+			expect: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: []v1.NodeSelectorRequirement{vnodeRequirement}}},
+				},
+				PreferredDuringSchedulingIgnoredDuringExecution: []v1.PreferredSchedulingTerm{preferred},
+			}},
+		},
+		"test existing terms": {
+			affinity: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{
+						{MatchExpressions: []v1.NodeSelectorRequirement{archRequirement}},
+						{},
+					},
+				},
+			}},
+			expect: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{
+						{MatchExpressions: []v1.NodeSelectorRequirement{archRequirement, vnodeRequirement}},
+						{MatchExpressions: []v1.NodeSelectorRequirement{vnodeRequirement}},
+					},
+				},
+				PreferredDuringSchedulingIgnoredDuringExecution: []v1.PreferredSchedulingTerm{preferred},
+			}},
+		},
+	} {
+		origin := test.affinity.DeepCopy()
+		actual := mergeNodeAffinity(test.affinity, []v1.NodeSelectorRequirement{vnodeRequirement}, []v1.PreferredSchedulingTerm{preferred})
+		if !reflect.DeepEqual(actual, test.expect) {
+			t.Fatalf("[%s] merge node affinity failed, actual: %v, expect: %v", desc, actual, test.expect)
+		}
+		if !reflect.DeepEqual(origin, test.affinity) {
+			t.Fatalf("[%s] merge node affinity failed, the pod affinity is modified: %v", desc, test.affinity)
+		}
+	}
+}
+
+func TestVirtualNodeOnlyOnPodCreatingWithTopology(t *testing.T) {
+	selector := &eciv1.Selector{
+		Spec: eciv1.SelectorSpec{
+			Effect: &eciv1.SideEffect{},
+			Policy: &eciv1.PolicySource{
+				VirtualNodeOnly: &eciv1.VirtualNodeOnlyPolicySource{
+					Topology: &eciv1.VirtualNodeTopology{
+						RequiredZones:  []string{"a", "b"},
+						PreferredZones: []eciv1.WeightedZone{{Zone: "a", Weight: 200}},
+					},
+				},
+			},
+		},
+	}
+	vn := newTestVirtualNode()
+	executor := &VirtualNodeOnlyExecutor{
+		virtualNode: vn,
+		topology:    &topologyResolver{lister: &fakeClusterLister{}, virtualNode: vn},
+	}
+	patchInfos, err := executor.OnPodCreating(selector, &v1.Pod{})
+	if err != nil {
+		t.Fatalf("executor on pod creating failed, err: %v", err)
+	}
+	expect := &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: []v1.NodeSelectorRequirement{
+				{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"a", "b"}},
+			}}},
+		},
+		PreferredDuringSchedulingIgnoredDuringExecution: []v1.PreferredSchedulingTerm{{
+			Weight:     100,
+			Preference: v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{{Key: v1.LabelTopologyZone, Operator: v1.NodeSelectorOpIn, Values: []string{"a"}}}},
+		}},
+	}}
+	for _, patchInfo := range patchInfos {
+		if patchInfo.Path != "/spec/affinity" {
+			continue
+		}
+		if !reflect.DeepEqual(patchInfo.Value, expect) {
+			t.Fatalf("executor on pod creating failed, actual: %v, expect: %v", patchInfo.Value, expect)
+		}
+		return
+	}
+	t.Fatalf("executor on pod creating failed, no affinity patch in %v", patchInfos)
+}
@@ -0,0 +1,98 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	PhaseCreating    = "creating"
+	PhaseScheduled   = "scheduled"
+	PhaseUnscheduled = "unscheduled"
+	PhaseReconciled  = "reconciled"
+)
+
+// Trace is the value of the trace annotation stamped on the mutated pods.
+type Trace struct {
+	Selector   string    `json:"selector"`
+	UID        types.UID `json:"uid"`
+	Generation int64     `json:"generation"`
+	Policy     string    `json:"policy"`
+	Phase      string    `json:"phase"`
+	EffectHash string    `json:"effectHash"`
+}
+
+func newTrace(selector *eciv1.Selector, policy, phase string) *Trace {
+	return &Trace{
+		Selector:   selector.Name,
+		UID:        selector.UID,
+		Generation: selector.Generation,
+		Policy:     policy,
+		Phase:      phase,
+		EffectHash: effectHash(selector.Spec.Effect),
+	}
+}
+
+// GetTrace returns the trace of the pod, or nil if the pod isn't traced.
+func GetTrace(pod *v1.Pod) (*Trace, error) {
+	value, ok := pod.Annotations[eciv1.AnnotationTrace]
+	if !ok {
+		return nil, nil
+	}
+	trace := &Trace{}
+	if err := json.Unmarshal([]byte(value), trace); err != nil {
+		return nil, fmt.Errorf("invalid annotation %s: %v", eciv1.AnnotationTrace, err)
+	}
+	return trace, nil
+}
+
+// IsTracedPhase reports whether the pod has been mutated in the phase.
+func IsTracedPhase(pod *v1.Pod, phase string) bool {
+	trace, err := GetTrace(pod)
+	return err == nil && trace != nil && trace.Phase == phase
+}
+
+func (t *Trace) String() string {
+	payload, _ := json.Marshal(t)
+	return string(payload)
+}
+
+// effectHash is a short hash of the rendered effect.
+func effectHash(effect *eciv1.SideEffect) string {
+	if effect == nil {
+		return ""
+	}
+	// the keys of the maps are sorted by the encoder
+	payload, _ := json.Marshal(effect)
+	hash := fnv.New32a()
+	hash.Write(payload)
+	return fmt.Sprintf("%08x", hash.Sum32())
+}
+
+// AppendAnnotationPatch appends the operation setting the annotation to the
+// patches computed against the original pod.
+func AppendAnnotationPatch(pod *v1.Pod, patchInfos []PatchInfo, key, value string) []PatchInfo {
+	annotationsExist := pod.Annotations != nil
+	for _, patchInfo := range patchInfos {
+		if patchInfo.Path == "/metadata/annotations" {
+			annotationsExist = true
+		}
+	}
+	if !annotationsExist {
+		return append(patchInfos, PatchInfo{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: map[string]string{key: value},
+		})
+	}
+	return append(patchInfos, PatchInfo{
+		Op:    "add",
+		Path:  "/metadata/annotations/" + escapeJSONPointer(key),
+		Value: value,
+	})
+}
@@ -0,0 +1,98 @@
+package policy
+
+import (
+	"testing"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTraceSelector(generation int64, annotations map[string]string) *eciv1.Selector {
+	return &eciv1.Selector{
+		ObjectMeta: metav1.ObjectMeta{Name: "prefer", UID: "selector-uid", Generation: generation},
+		Spec: eciv1.SelectorSpec{
+			Effect: &eciv1.SideEffect{Annotations: annotations},
+			Policy: &eciv1.PolicySource{NormalNodePrefer: &eciv1.NormalNodePreferPolicySource{}},
+		},
+	}
+}
+
+func TestTraceIdempotency(t *testing.T) {
+	manager := NewManager(nil, NewVirtualNode(nil, []v1.Toleration{
+		{Key: vnodeNodeSelectorKey, Value: vnodeNodeSelectorVal, Operator: v1.TolerationOpEqual, Effect: v1.TaintEffectNoSchedule},
+	}))
+	selector := newTraceSelector(1, map[string]string{"foo": "bar"})
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"}}
+
+	patchOption, err := manager.OnPodUnscheduled(selector, pod)
+	if err != nil || patchOption == nil {
+		t.Fatalf("expect the pod patched, but got %v, %v", patchOption, err)
+	}
+	pod.Annotations = patchOption.Metadata.Annotations
+	trace, err := GetTrace(pod)
+	if err != nil || trace == nil {
+		t.Fatalf("expect the pod traced, but got %v, %v", trace, err)
+	}
+	expect := Trace{
+		Selector:   "prefer",
+		UID:        "selector-uid",
+		Generation: 1,
+		Policy:     ExecutorNameNormalNodePrefer,
+		Phase:      PhaseUnscheduled,
+		EffectHash: effectHash(selector.Spec.Effect),
+	}
+	if *trace != expect {
+		t.Errorf("expect trace %v, but got %v", expect, trace)
+	}
+
+	// the tolerations are dropped, but the same selector has mutated the pod
+	if patchOption, err := manager.OnPodUnscheduled(selector, pod); err != nil || patchOption != nil {
+		t.Errorf("expect the traced pod skipped, but got %v, %v", patchOption, err)
+	}
+	if !IsTracedPhase(pod, PhaseUnscheduled) || IsTracedPhase(pod, PhaseScheduled) {
+		t.Errorf("expect the pod traced only in the unscheduled phase")
+	}
+
+	// a new generation with another effect mutates the pod again
+	updated := newTraceSelector(2, map[string]string{"foo": "baz"})
+	if effectHash(updated.Spec.Effect) == trace.EffectHash {
+		t.Errorf("expect the effect hash changed")
+	}
+	if patchOption, err := manager.OnPodUnscheduled(updated, pod); err != nil || patchOption == nil {
+		t.Errorf("expect the pod patched by the new generation, but got %v, %v", patchOption, err)
+	}
+}
+
+func TestAppendAnnotationPatch(t *testing.T) {
+	pod := &v1.Pod{}
+	patchInfos := AppendAnnotationPatch(pod, nil, eciv1.AnnotationTrace, "{}")
+	patchInfos = AppendAnnotationPatch(pod, patchInfos, "a/b~c", "value")
+	if len(patchInfos) != 2 || patchInfos[0].Path != "/metadata/annotations" || patchInfos[1].Path != "/metadata/annotations/a~1b~0c" {
+		t.Errorf("unexpected patches: %v", patchInfos)
+	}
+}
+
+func TestOnPodDrifted(t *testing.T) {
+	manager := NewManager(nil, NewVirtualNode(nil, nil))
+	selector := newTraceSelector(1, map[string]string{"foo": "bar"})
+	selector.Spec.Effect.Labels = map[string]string{"app": "nginx"}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "nginx",
+		Namespace:   "default",
+		Annotations: map[string]string{"foo": "bar"},
+	}}
+
+	patchOption := manager.OnPodDrifted(selector, pod)
+	if patchOption == nil || patchOption.Metadata.Labels["app"] != "nginx" || patchOption.Metadata.Annotations["foo"] != "" {
+		t.Fatalf("expect only the missing label patched, but got %v", patchOption)
+	}
+	pod.Labels = patchOption.Metadata.Labels
+	pod.Annotations[eciv1.AnnotationTrace] = patchOption.Metadata.Annotations[eciv1.AnnotationTrace]
+	if !IsTracedPhase(pod, PhaseReconciled) {
+		t.Errorf("expect the pod traced in the reconciled phase")
+	}
+	if patchOption := manager.OnPodDrifted(selector, pod); patchOption != nil {
+		t.Errorf("expect no drift, but got %v", patchOption)
+	}
+}
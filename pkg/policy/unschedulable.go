@@ -0,0 +1,116 @@
+package policy
+
+import (
+	"regexp"
+	"strings"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+)
+
+// DefaultOverflowReasons are the capacity related reasons, which more nodes
+// like the virtual nodes help with.
+var DefaultOverflowReasons = []eciv1.UnschedulableReason{
+	eciv1.UnschedulableReasonInsufficientCPU,
+	eciv1.UnschedulableReasonInsufficientMemory,
+	eciv1.UnschedulableReasonInsufficientPods,
+}
+
+var insufficientPattern = regexp.MustCompile(`insufficient ([^\s,.]+)`)
+
+// unschedulablePatterns are the lowercase fragments of the scheduler messages.
+var unschedulablePatterns = []struct {
+	fragment string
+	reason   eciv1.UnschedulableReason
+}{
+	{"too many pods", eciv1.UnschedulableReasonInsufficientPods},
+	{"untolerated taint", eciv1.UnschedulableReasonTaint},
+	{"had taint", eciv1.UnschedulableReasonTaint},
+	{"node(s) were unschedulable", eciv1.UnschedulableReasonTaint},
+	{"node affinity/selector", eciv1.UnschedulableReasonAffinity},
+	{"pod's node affinity", eciv1.UnschedulableReasonAffinity},
+	{"affinity rules", eciv1.UnschedulableReasonAffinity},
+	{"topology spread constraints", eciv1.UnschedulableReasonAffinity},
+	{"persistentvolumeclaim", eciv1.UnschedulableReasonVolume},
+	{"persistent volume", eciv1.UnschedulableReasonVolume},
+	{"volume node affinity conflict", eciv1.UnschedulableReasonVolume},
+	{"max volume count", eciv1.UnschedulableReasonVolume},
+	{"free ports", eciv1.UnschedulableReasonPort},
+}
+
+// ClassifyUnschedulable returns the reasons in the message of the scheduler,
+// e.g. "0/3 nodes are available: 1 Insufficient cpu, 2 node(s) had untolerated
+// taint {node-role.kubernetes.io/master: }.", the message of no known reason
+// is classified as Other.
+func ClassifyUnschedulable(message string) []eciv1.UnschedulableReason {
+	message = strings.ToLower(message)
+	// the reasons of the preemption are about the victims, not the nodes
+	if index := strings.Index(message, "preemption:"); index >= 0 {
+		message = message[:index]
+	}
+	var reasons []eciv1.UnschedulableReason
+	add := func(reason eciv1.UnschedulableReason) {
+		for _, r := range reasons {
+			if r == reason {
+				return
+			}
+		}
+		reasons = append(reasons, reason)
+	}
+	for _, match := range insufficientPattern.FindAllStringSubmatch(message, -1) {
+		switch match[1] {
+		case "cpu":
+			add(eciv1.UnschedulableReasonInsufficientCPU)
+		case "memory":
+			add(eciv1.UnschedulableReasonInsufficientMemory)
+		case "pods":
+			add(eciv1.UnschedulableReasonInsufficientPods)
+		default:
+			add(eciv1.UnschedulableReasonInsufficientResource)
+		}
+	}
+	for _, pattern := range unschedulablePatterns {
+		if strings.Contains(message, pattern.fragment) {
+			add(pattern.reason)
+		}
+	}
+	if len(reasons) == 0 {
+		add(eciv1.UnschedulableReasonOther)
+	}
+	return reasons
+}
+
+// nodeExcludingReasons only tell the nodes the pod never runs on, e.g. the
+// tainted master nodes, they neither allow nor deny the overflow.
+var nodeExcludingReasons = []eciv1.UnschedulableReason{
+	eciv1.UnschedulableReasonTaint,
+	eciv1.UnschedulableReasonAffinity,
+}
+
+// IsOverflowAllowed reports whether any of the reasons is allowed and none of
+// the others denies the overflow, a pod failing on some nodes for lack of
+// capacity and on the others for e.g. a volume conflict doesn't run on
+// virtual nodes either.
+func IsOverflowAllowed(allowed, reasons []eciv1.UnschedulableReason) bool {
+	if allowed == nil {
+		allowed = DefaultOverflowReasons
+	}
+	anyAllowed := false
+	for _, reason := range reasons {
+		switch {
+		case containsReason(allowed, reason):
+			anyAllowed = true
+		case !containsReason(nodeExcludingReasons, reason):
+			return false
+		}
+	}
+	return anyAllowed
+}
+
+func containsReason(reasons []eciv1.UnschedulableReason, reason eciv1.UnschedulableReason) bool {
+	for _, r := range reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+)
+
+func TestClassifyUnschedulable(t *testing.T) {
+	for message, expect := range map[string][]eciv1.UnschedulableReason{
+		"0/5 nodes are available: 2 Insufficient cpu, 1 Insufficient memory, 2 node(s) had untolerated taint {node-role.kubernetes.io/master: }. preemption: 0/5 nodes are available: 5 No preemption victims found for incoming pod.": {
+			eciv1.UnschedulableReasonInsufficientCPU,
+			eciv1.UnschedulableReasonInsufficientMemory,
+			eciv1.UnschedulableReasonTaint,
+		},
+		"0/3 nodes are available: 3 Too many pods.": {
+			eciv1.UnschedulableReasonInsufficientPods,
+		},
+		"0/3 nodes are available: 3 Insufficient nvidia.com/gpu.": {
+			eciv1.UnschedulableReasonInsufficientResource,
+		},
+		"0/3 nodes are available: 1 node(s) didn't match Pod's node affinity/selector, 2 node(s) didn't match pod anti-affinity rules.": {
+			eciv1.UnschedulableReasonAffinity,
+		},
+		"0/3 nodes are available: 3 node(s) had volume node affinity conflict.": {
+			eciv1.UnschedulableReasonVolume,
+		},
+		`0/3 nodes are available: persistentvolumeclaim "data" not found.`: {
+			eciv1.UnschedulableReasonVolume,
+		},
+		"0/3 nodes are available: 3 node(s) didn't have free ports for the requested pod ports.": {
+			eciv1.UnschedulableReasonPort,
+		},
+		"something unexpected": {
+			eciv1.UnschedulableReasonOther,
+		},
+	} {
+		if actual := ClassifyUnschedulable(message); !reflect.DeepEqual(actual, expect) {
+			t.Errorf("%q: expect %v, but got %v", message, expect, actual)
+		}
+	}
+}
+
+func TestIsOverflowAllowed(t *testing.T) {
+	capacityAndTaint := []eciv1.UnschedulableReason{eciv1.UnschedulableReasonInsufficientCPU, eciv1.UnschedulableReasonTaint}
+	volume := []eciv1.UnschedulableReason{eciv1.UnschedulableReasonVolume}
+	if !IsOverflowAllowed(nil, capacityAndTaint) {
+		t.Errorf("expect the capacity reasons allowed by default")
+	}
+	if IsOverflowAllowed(nil, volume) {
+		t.Errorf("expect the volume reasons not allowed by default")
+	}
+	if !IsOverflowAllowed([]eciv1.UnschedulableReason{eciv1.UnschedulableReasonVolume}, volume) {
+		t.Errorf("expect the configured reasons allowed")
+	}
+	if IsOverflowAllowed([]eciv1.UnschedulableReason{}, capacityAndTaint) {
+		t.Errorf("expect no reason allowed by the empty list")
+	}
+	capacityAndVolume := []eciv1.UnschedulableReason{eciv1.UnschedulableReasonInsufficientCPU, eciv1.UnschedulableReasonVolume}
+	if IsOverflowAllowed(nil, capacityAndVolume) {
+		t.Errorf("expect the overflow denied by the volume reasons")
+	}
+	taintAndAffinity := []eciv1.UnschedulableReason{eciv1.UnschedulableReasonTaint, eciv1.UnschedulableReasonAffinity}
+	if IsOverflowAllowed(nil, taintAndAffinity) {
+		t.Errorf("expect the node excluding reasons not allowed by default")
+	}
+}
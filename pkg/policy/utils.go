@@ -1,6 +1,9 @@
 package policy
 
 import (
+	"sort"
+	"strings"
+
 	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
 	v1 "k8s.io/api/core/v1"
 )
@@ -10,80 +13,126 @@ const (
 	vnodeNodeSelectorVal = "true"
 )
 
-var (
-	virtualNodeToleration = v1.Toleration{
-		Key:      vnodeNodeSelectorKey,
-		Value:    vnodeNodeSelectorVal,
-		Operator: v1.TolerationOpEqual,
-		Effect:   v1.TaintEffectNoSchedule,
-	}
-)
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
 
-func addVirtualNodeToleration(pod *v1.Pod) PatchInfo {
-	tolerations := pod.Spec.Tolerations
-	tolerations = append(tolerations, virtualNodeToleration)
+func addVirtualNodeToleration(pod *v1.Pod, required []v1.Toleration) PatchInfo {
 	return PatchInfo{
 		Op:    "add",
 		Path:  "/spec/tolerations",
-		Value: tolerations,
+		Value: appendVirtualTolerations(pod.Spec.Tolerations, required),
 	}
 }
 
-func addVirtualNodeSelector() PatchInfo {
+// addVirtualNodeSelector sets the merged node selector, the add operation
+// creates the field when the pod has no node selector.
+func addVirtualNodeSelector(nodeSelector map[string]string) PatchInfo {
 	return PatchInfo{
-		Op:   "replace",
-		Path: "/spec/nodeSelector",
-		Value: map[string]string{
-			vnodeNodeSelectorKey: vnodeNodeSelectorVal,
-		},
+		Op:    "add",
+		Path:  "/spec/nodeSelector",
+		Value: nodeSelector,
 	}
 }
 
-func addAnnotations(selector *eciv1.Selector, pod *v1.Pod) PatchInfo {
-	annotations := pod.Annotations
-	if annotations == nil {
-		annotations = map[string]string{}
+func addAnnotations(selector *eciv1.Selector, pod *v1.Pod) []PatchInfo {
+	return addMetadataEntries("/metadata/annotations", pod.Annotations, effectAnnotations(selector, pod))
+}
+
+func addLabels(selector *eciv1.Selector, pod *v1.Pod) []PatchInfo {
+	return addMetadataEntries("/metadata/labels", pod.Labels, effectLabels(selector, pod))
+}
+
+// addMetadataEntries generates one operation for every added or overwritten
+// key, the whole map is only added when the pod doesn't have it yet.
+func addMetadataEntries(path string, existing, entries map[string]string) []PatchInfo {
+	if len(entries) == 0 {
+		return nil
 	}
-	for key, value := range selector.Spec.Effect.Annotations {
-		annotations[key] = value
+	if existing == nil {
+		return []PatchInfo{{Op: "add", Path: path, Value: entries}}
 	}
-	return PatchInfo{
-		Op:    "add",
-		Path:  "/metadata/annotations",
-		Value: annotations,
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	patchInfos := make([]PatchInfo, 0, len(keys))
+	for _, key := range keys {
+		op := "add"
+		if _, ok := existing[key]; ok {
+			op = "replace"
+		}
+		patchInfos = append(patchInfos, PatchInfo{
+			Op:    op,
+			Path:  path + "/" + escapeJSONPointer(key),
+			Value: entries[key],
+		})
 	}
+	return patchInfos
 }
 
-func addLabels(selector *eciv1.Selector, pod *v1.Pod) PatchInfo {
-	labels := pod.Labels
-	if labels == nil {
-		labels = map[string]string{}
+// effectAnnotations returns the effect annotations which change the pod.
+func effectAnnotations(selector *eciv1.Selector, pod *v1.Pod) map[string]string {
+	if selector == nil || selector.Spec.Effect == nil {
+		return nil
 	}
+	return effectEntries(selector.Spec.Effect.MergePolicy, pod.Annotations, selector.Spec.Effect.Annotations)
+}
 
-	for key, value := range selector.Spec.Effect.Labels {
-		labels[key] = value
+// effectLabels returns the effect labels which change the pod.
+func effectLabels(selector *eciv1.Selector, pod *v1.Pod) map[string]string {
+	if selector == nil || selector.Spec.Effect == nil {
+		return nil
 	}
+	return effectEntries(selector.Spec.Effect.MergePolicy, pod.Labels, selector.Spec.Effect.Labels)
+}
 
-	return PatchInfo{
-		Op:    "add",
-		Path:  "/metadata/labels",
-		Value: labels,
+func effectEntries(mergePolicy eciv1.EffectMergePolicy, existing, effect map[string]string) map[string]string {
+	var entries map[string]string
+	for key, value := range effect {
+		current, ok := existing[key]
+		if ok && (current == value || mergePolicy == eciv1.EffectMergePolicyIfNotPresent) {
+			continue
+		}
+		if entries == nil {
+			entries = map[string]string{}
+		}
+		entries[key] = value
 	}
+	return entries
 }
 
-func existVirtualTolerations(tolerations []v1.Toleration) bool {
-	for _, toleration := range tolerations {
-		if toleration.Key == vnodeNodeSelectorKey &&
-			toleration.Value == vnodeNodeSelectorVal &&
-			toleration.Operator == v1.TolerationOpEqual &&
-			toleration.Effect == v1.TaintEffectNoSchedule {
-			return true
+// escapeJSONPointer escapes a reference token as defined by RFC 6901.
+func escapeJSONPointer(token string) string {
+	return jsonPointerEscaper.Replace(token)
+}
+
+// appendVirtualTolerations returns a new slice holding the pod tolerations
+// followed by the required ones which are not tolerated yet.
+func appendVirtualTolerations(tolerations []v1.Toleration, required []v1.Toleration) []v1.Toleration {
+	result := make([]v1.Toleration, 0, len(tolerations)+len(required))
+	result = append(result, tolerations...)
+	for i := range required {
+		if !containsToleration(tolerations, &required[i]) {
+			result = append(result, required[i])
 		}
 	}
+	return result
+}
 
-	return false
+func existVirtualTolerations(tolerations []v1.Toleration, required []v1.Toleration) bool {
+	for i := range required {
+		if !containsToleration(tolerations, &required[i]) {
+			return false
+		}
+	}
+	return true
 }
 
-func IsVirtualNode(node *v1.Node) bool {
-	return node.Labels[vnodeNodeSelectorKey] == vnodeNodeSelectorVal
+func containsToleration(tolerations []v1.Toleration, toleration *v1.Toleration) bool {
+	for i := range tolerations {
+		if tolerations[i].MatchToleration(toleration) {
+			return true
+		}
+	}
+	return false
 }
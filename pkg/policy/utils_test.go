@@ -1,14 +1,17 @@
 package policy
 
 import (
+	"reflect"
 	"testing"
 
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestAddVirtualNodeToleration(t *testing.T) {
 	pod := &v1.Pod{}
-	patchInfo := addVirtualNodeToleration(pod)
+	patchInfo := addVirtualNodeToleration(pod, newTestVirtualNode().Tolerations(nil))
 	if patchInfo.Op != "add" {
 		t.Fatalf("test add virtual node toleration failed, patchInfo's Op is %s", patchInfo.Op)
 	}
@@ -40,8 +43,8 @@ func TestAddVirtualNodeToleration(t *testing.T) {
 	}
 }
 func TestAddVirtualNodeSelector(t *testing.T) {
-	patchInfo := addVirtualNodeSelector()
-	if patchInfo.Op != "replace" {
+	patchInfo := addVirtualNodeSelector(newTestVirtualNode().NodeSelector())
+	if patchInfo.Op != "add" {
 		t.Fatalf("test add virtual node selector failed, patchInfo's Op is %s", patchInfo.Op)
 	}
 	if patchInfo.Path != "/spec/nodeSelector" {
@@ -55,3 +58,47 @@ func TestAddVirtualNodeSelector(t *testing.T) {
 		t.Fatalf("test add virtual node selector failed, nodeSelector is %v", nodeSelector)
 	}
 }
+
+func TestAddAnnotations(t *testing.T) {
+	for desc, test := range map[string]struct {
+		annotations map[string]string
+		effect      *eciv1.SideEffect
+		expect      []PatchInfo
+	}{
+		"test pod without annotations": {
+			effect: &eciv1.SideEffect{Annotations: map[string]string{"k8s.aliyun.com/eci-use-specs": "2-4Gi"}},
+			expect: []PatchInfo{
+				{Op: "add", Path: "/metadata/annotations", Value: map[string]string{"k8s.aliyun.com/eci-use-specs": "2-4Gi"}},
+			},
+		},
+		"test escape and overwrite": {
+			annotations: map[string]string{"foo": "bar", "a~b": "c"},
+			effect:      &eciv1.SideEffect{Annotations: map[string]string{"foo": "boo", "a~b": "c", "k8s.aliyun.com/eci-use-specs": "2-4Gi"}},
+			expect: []PatchInfo{
+				{Op: "replace", Path: "/metadata/annotations/foo", Value: "boo"},
+				{Op: "add", Path: "/metadata/annotations/k8s.aliyun.com~1eci-use-specs", Value: "2-4Gi"},
+			},
+		},
+		"test fill missing only": {
+			annotations: map[string]string{"foo": "bar"},
+			effect: &eciv1.SideEffect{
+				Annotations: map[string]string{"foo": "boo", "a~b": "c"},
+				MergePolicy: eciv1.EffectMergePolicyIfNotPresent,
+			},
+			expect: []PatchInfo{
+				{Op: "add", Path: "/metadata/annotations/a~0b", Value: "c"},
+			},
+		},
+	} {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+		origin := pod.DeepCopy()
+		selector := &eciv1.Selector{Spec: eciv1.SelectorSpec{Effect: test.effect}}
+		actual := addAnnotations(selector, pod)
+		if !reflect.DeepEqual(actual, test.expect) {
+			t.Fatalf("[%s] add annotations failed, actual: %v, expect: %v", desc, actual, test.expect)
+		}
+		if !reflect.DeepEqual(pod, origin) {
+			t.Fatalf("[%s] add annotations failed, the pod is modified: %v", desc, pod.Annotations)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// DefaultVirtualNodeSelector identifies the virtual nodes of ACK/ASK clusters.
+	DefaultVirtualNodeSelector = vnodeNodeSelectorKey + "=" + vnodeNodeSelectorVal
+	// DefaultVirtualNodeTolerations tolerates the taint of the virtual nodes of ACK/ASK clusters.
+	DefaultVirtualNodeTolerations = vnodeNodeSelectorKey + "=" + vnodeNodeSelectorVal + ":" + string(v1.TaintEffectNoSchedule)
+)
+
+// VirtualNode describes how virtual nodes are identified and which
+// tolerations a pod needs to be scheduled onto them.
+type VirtualNode struct {
+	nodeLabels  labels.Set
+	tolerations []v1.Toleration
+	breaker     Breaker
+}
+
+// Breaker suspends the placement on virtual nodes while they are unhealthy.
+type Breaker interface {
+	// IsOpen reports whether the breakers of all the virtual nodes are open.
+	IsOpen() bool
+	// OpenNodes returns the virtual nodes whose breakers are open.
+	OpenNodes() []string
+}
+
+func NewVirtualNode(nodeLabels map[string]string, tolerations []v1.Toleration) *VirtualNode {
+	return &VirtualNode{
+		nodeLabels:  labels.Set(nodeLabels),
+		tolerations: tolerations,
+	}
+}
+
+// SetBreaker sets the breaker suspending the placement on virtual nodes.
+func (vn *VirtualNode) SetBreaker(breaker Breaker) {
+	vn.breaker = breaker
+}
+
+// IsSuspended reports whether the placement on virtual nodes is suspended,
+// the policies overflowing pods to virtual nodes stop adding tolerations.
+func (vn *VirtualNode) IsSuspended() bool {
+	return vn.breaker != nil && vn.breaker.IsOpen()
+}
+
+// OpenNodes returns the virtual nodes whose breakers are open, the pods
+// placed on virtual nodes at creation exclude them.
+func (vn *VirtualNode) OpenNodes() []string {
+	if vn.breaker == nil {
+		return nil
+	}
+	return vn.breaker.OpenNodes()
+}
+
+// IsNodeSuspended reports whether the breaker of the virtual node is open.
+func (vn *VirtualNode) IsNodeSuspended(name string) bool {
+	return containsString(vn.OpenNodes(), name)
+}
+
+// IsVirtualNode reports whether the node carries all the virtual node labels.
+func (vn *VirtualNode) IsVirtualNode(node *v1.Node) bool {
+	if len(vn.nodeLabels) == 0 {
+		return false
+	}
+	return labels.SelectorFromSet(vn.nodeLabels).Matches(labels.Set(node.Labels))
+}
+
+// NodeSelector returns a copy of the labels used to select virtual nodes.
+func (vn *VirtualNode) NodeSelector() map[string]string {
+	nodeSelector := make(map[string]string, len(vn.nodeLabels))
+	for key, value := range vn.nodeLabels {
+		nodeSelector[key] = value
+	}
+	return nodeSelector
+}
+
+// IsSelectedBy reports whether the node selector of the pod only matches
+// virtual nodes.
+func (vn *VirtualNode) IsSelectedBy(pod *v1.Pod) bool {
+	if len(vn.nodeLabels) == 0 {
+		return false
+	}
+	for key, value := range vn.nodeLabels {
+		if pod.Spec.NodeSelector[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Tolerations returns the tolerations required by the virtual nodes, the
+// selector's policy may override the global ones.
+func (vn *VirtualNode) Tolerations(selector *eciv1.Selector) []v1.Toleration {
+	if selector != nil && selector.Spec.Policy != nil && len(selector.Spec.Policy.VirtualNodeTolerations) > 0 {
+		return selector.Spec.Policy.VirtualNodeTolerations
+	}
+	return vn.tolerations
+}
+
+// ParseNodeSelector parses a comma separated list of key=value pairs.
+func ParseNodeSelector(s string) (map[string]string, error) {
+	nodeLabels, err := labels.ConvertSelectorToLabelsMap(s)
+	if err != nil {
+		return nil, err
+	}
+	return nodeLabels, nil
+}
+
+// ParseTolerations parses a comma separated list of tolerations in the form
+// of key[=value][:effect], a toleration without value uses the Exists operator.
+func ParseTolerations(s string) ([]v1.Toleration, error) {
+	var tolerations []v1.Toleration
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		toleration := v1.Toleration{Operator: v1.TolerationOpExists}
+		if i := strings.LastIndex(item, ":"); i >= 0 {
+			toleration.Effect = v1.TaintEffect(item[i+1:])
+			item = item[:i]
+			switch toleration.Effect {
+			case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+			default:
+				return nil, fmt.Errorf("invalid toleration effect %q", toleration.Effect)
+			}
+		}
+		if i := strings.Index(item, "="); i >= 0 {
+			toleration.Operator = v1.TolerationOpEqual
+			toleration.Value = item[i+1:]
+			item = item[:i]
+		}
+		if item == "" {
+			return nil, fmt.Errorf("toleration key must not be empty")
+		}
+		toleration.Key = item
+		tolerations = append(tolerations, toleration)
+	}
+	return tolerations, nil
+}
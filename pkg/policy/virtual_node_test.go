@@ -0,0 +1,207 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestVirtualNode() *VirtualNode {
+	nodeLabels, _ := ParseNodeSelector(DefaultVirtualNodeSelector)
+	tolerations, _ := ParseTolerations(DefaultVirtualNodeTolerations)
+	return NewVirtualNode(nodeLabels, tolerations)
+}
+
+func TestParseTolerations(t *testing.T) {
+	for desc, test := range map[string]struct {
+		value     string
+		expect    []v1.Toleration
+		expectErr bool
+	}{
+		"test default tolerations": {
+			value: DefaultVirtualNodeTolerations,
+			expect: []v1.Toleration{
+				{Key: vnodeNodeSelectorKey, Operator: v1.TolerationOpEqual, Value: vnodeNodeSelectorVal, Effect: v1.TaintEffectNoSchedule},
+			},
+		},
+		"test multiple tolerations": {
+			value: "virtual-kubelet.io/provider:NoSchedule, type=virtual-kubelet",
+			expect: []v1.Toleration{
+				{Key: "virtual-kubelet.io/provider", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule},
+				{Key: "type", Operator: v1.TolerationOpEqual, Value: "virtual-kubelet"},
+			},
+		},
+		"test invalid effect": {
+			value:     "virtual-kubelet.io/provider:Never",
+			expectErr: true,
+		},
+		"test empty key": {
+			value:     "=true:NoSchedule",
+			expectErr: true,
+		},
+	} {
+		actual, err := ParseTolerations(test.value)
+		if (err != nil) != test.expectErr {
+			t.Fatalf("[%s] parse tolerations failed, err: %v", desc, err)
+		}
+		if !reflect.DeepEqual(actual, test.expect) {
+			t.Fatalf("[%s] parse tolerations failed, actual: %v, expect: %v", desc, actual, test.expect)
+		}
+	}
+}
+
+func TestVirtualNode(t *testing.T) {
+	nodeLabels, err := ParseNodeSelector("type=virtual-kubelet")
+	if err != nil {
+		t.Fatalf("parse node selector failed, err: %v", err)
+	}
+	global := []v1.Toleration{{Key: "virtual-kubelet.io/provider", Operator: v1.TolerationOpExists}}
+	vn := NewVirtualNode(nodeLabels, global)
+
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"type": "virtual-kubelet"}}}
+	if !vn.IsVirtualNode(node) {
+		t.Fatalf("test virtual node failed, node %v should be virtual node", node.Labels)
+	}
+	node = &v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{vnodeNodeSelectorKey: vnodeNodeSelectorVal}}}
+	if vn.IsVirtualNode(node) {
+		t.Fatalf("test virtual node failed, node %v should not be virtual node", node.Labels)
+	}
+
+	if !reflect.DeepEqual(vn.Tolerations(nil), global) {
+		t.Fatalf("test virtual node failed, tolerations: %v", vn.Tolerations(nil))
+	}
+	override := []v1.Toleration{{Key: "foo", Operator: v1.TolerationOpEqual, Value: "boo"}}
+	selector := &eciv1.Selector{Spec: eciv1.SelectorSpec{Policy: &eciv1.PolicySource{VirtualNodeTolerations: override}}}
+	if !reflect.DeepEqual(vn.Tolerations(selector), override) {
+		t.Fatalf("test virtual node failed, tolerations: %v", vn.Tolerations(selector))
+	}
+}
+
+func TestIsVirtualNodePod(t *testing.T) {
+	virtualNode := newTestVirtualNode()
+	m := &Manager{virtualNode: virtualNode}
+	virtualNodeLabels := virtualNode.NodeSelector()
+	vnode := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "virtual-node-1", Labels: virtualNodeLabels}}
+	normalNode := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	overridden := []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "eci", Effect: v1.TaintEffectNoSchedule}}
+	selector := &eciv1.Selector{Spec: eciv1.SelectorSpec{Policy: &eciv1.PolicySource{VirtualNodeTolerations: overridden}}}
+	tolerating := &v1.Pod{Spec: v1.PodSpec{Tolerations: virtualNode.Tolerations(nil)}}
+	toleratingOverridden := &v1.Pod{Spec: v1.PodSpec{Tolerations: overridden}}
+	selecting := &v1.Pod{Spec: v1.PodSpec{NodeSelector: virtualNodeLabels}}
+	bound := &v1.Pod{Spec: v1.PodSpec{NodeName: "virtual-node-1"}}
+	finished := bound.DeepCopy()
+	finished.Status.Phase = v1.PodSucceeded
+	boundNormal := tolerating.DeepCopy()
+	boundNormal.Spec.NodeName = "node-1"
+	for desc, test := range map[string]struct {
+		selector *eciv1.Selector
+		pod      *v1.Pod
+		node     *v1.Node
+		expect   bool
+	}{
+		"test tolerating pod":                  {pod: tolerating, expect: true},
+		"test pod tolerating selector's nodes": {selector: selector, pod: toleratingOverridden, expect: true},
+		"test pod tolerating global only":      {selector: selector, pod: tolerating, expect: false},
+		"test selecting pod":                   {pod: selecting, expect: true},
+		"test bound pod":                       {pod: bound, node: vnode, expect: true},
+		"test bound pod of unknown node":       {pod: bound, expect: false},
+		"test finished pod":                    {pod: finished, node: vnode, expect: false},
+		"test pod on normal node":              {pod: boundNormal, node: normalNode, expect: false},
+		"test pod of normal nodes":             {pod: &v1.Pod{}, expect: false},
+	} {
+		if actual := m.IsVirtualNodePod(test.selector, test.pod, test.node); actual != test.expect {
+			t.Errorf("[%s] expect %v, but got %v", desc, test.expect, actual)
+		}
+	}
+}
+
+// fakeBreaker opens the breakers of the nodes, and of all of them if all is true.
+type fakeBreaker struct {
+	all   bool
+	nodes []string
+}
+
+func (b *fakeBreaker) IsOpen() bool {
+	return b.all
+}
+
+func (b *fakeBreaker) OpenNodes() []string {
+	return b.nodes
+}
+
+func TestSuspendedVirtualNode(t *testing.T) {
+	virtualNode := newTestVirtualNode()
+	selector := &eciv1.Selector{}
+	pod := &v1.Pod{}
+	for _, executor := range []Executor{NewFairExecutor(virtualNode), NewNormalNodePreferExecutor(virtualNode)} {
+		virtualNode.SetBreaker(&fakeBreaker{all: true})
+		if patchOption, _ := executor.OnPodUnscheduled(selector, pod); patchOption != nil {
+			t.Errorf("%T: expect no toleration added while the breaker is open", executor)
+		}
+		virtualNode.SetBreaker(&fakeBreaker{})
+		if patchOption, _ := executor.OnPodUnscheduled(selector, pod); patchOption == nil || len(patchOption.Spec.Tolerations) == 0 {
+			t.Errorf("%T: expect the tolerations added while the breaker is closed", executor)
+		}
+	}
+}
+
+func TestExcludeOpenVirtualNodes(t *testing.T) {
+	vn := newTestVirtualNode()
+	newVirtualNode := func(name string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: vn.NodeSelector()}}
+	}
+	lister := &fakeClusterLister{nodes: []*v1.Node{newVirtualNode("vk-a"), newVirtualNode("vk-b")}}
+	selector := &eciv1.Selector{}
+	excluding := func(patchInfos []PatchInfo) []string {
+		for _, patchInfo := range patchInfos {
+			if affinity, ok := patchInfo.Value.(*v1.Affinity); ok && patchInfo.Path == "/spec/affinity" {
+				terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+				return terms[0].MatchFields[0].Values
+			}
+		}
+		return nil
+	}
+	for desc, test := range map[string]struct {
+		breaker       *fakeBreaker
+		expectExclude []string
+	}{
+		"test no breaker open":   {breaker: &fakeBreaker{}},
+		"test one breaker open":  {breaker: &fakeBreaker{nodes: []string{"vk-a"}}, expectExclude: []string{"vk-a"}},
+		"test all breakers open": {breaker: &fakeBreaker{all: true, nodes: []string{"vk-a", "vk-b"}}},
+		"test unknown node open": {breaker: &fakeBreaker{nodes: []string{"vk-c"}}, expectExclude: []string{"vk-c"}},
+		"test both open not all": {breaker: &fakeBreaker{nodes: []string{"vk-a", "vk-b"}}},
+	} {
+		vn.SetBreaker(test.breaker)
+		for _, executor := range []Executor{
+			&VirtualNodeOnlyExecutor{virtualNode: vn, topology: &topologyResolver{lister: lister, virtualNode: vn}},
+			NewReplicaSplitExecutor(vn, lister),
+		} {
+			patchInfos, err := executor.OnPodCreating(selector, &v1.Pod{})
+			if err != nil {
+				t.Errorf("[%s] %T: unexpected error: %v", desc, executor, err)
+				continue
+			}
+			if actual := excluding(patchInfos); !reflect.DeepEqual(actual, test.expectExclude) {
+				t.Errorf("[%s] %T: expect the virtual nodes %v excluded, but got %v", desc, executor, test.expectExclude, actual)
+			}
+		}
+	}
+
+	// the replicas run on normal nodes while all the virtual nodes are suspended
+	vn.SetBreaker(&fakeBreaker{all: true, nodes: []string{"vk-a", "vk-b"}})
+	if patchInfos, _ := NewReplicaSplitExecutor(vn, lister).OnPodCreating(selector, &v1.Pod{}); len(patchInfos) != 0 {
+		t.Errorf("expect the replica placed on normal nodes, but got %v", patchInfos)
+	}
+	// the pod bound to a suspended virtual node is denied
+	fair := NewFairExecutor(vn)
+	if _, err := fair.OnPodCreating(selector, &v1.Pod{Spec: v1.PodSpec{NodeName: "vk-a"}}); err == nil {
+		t.Errorf("expect the pod bound to a suspended virtual node denied")
+	}
+	vn.SetBreaker(&fakeBreaker{nodes: []string{"vk-a"}})
+	if _, err := fair.OnPodCreating(selector, &v1.Pod{Spec: v1.PodSpec{NodeName: "vk-b"}}); err != nil {
+		t.Errorf("expect the pod bound to a healthy virtual node allowed, but got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package profile
+
+import (
+	"context"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// windowSyncPeriod is how often the active windows of the selectors are checked.
+	windowSyncPeriod = 30 * time.Second
+	// statusSyncPeriod is how often the audits and drifts are written to the selector status.
+	statusSyncPeriod = 30 * time.Second
+)
+
+// isSelectorActive reports whether the selector is within its active windows,
+// a selector with invalid windows is never active.
+func (m *Manager) isSelectorActive(selector *eciv1.Selector, now time.Time) bool {
+	windows, err := m.selectors.windows(selector)
+	if err != nil {
+		klog.Errorf("invalid active windows of selector %s: %q", selector.Name, err)
+		return false
+	}
+	active, _ := windowState(windows, now)
+	return active
+}
+
+// runWindowSync keeps the active state of the selector status up to date with
+// the active windows, and re-evaluates the pending pods when any selector is
+// activated or deactivated.
+func (m *Manager) runWindowSync(ctx context.Context) {
+	activeStates := map[types.UID]bool{}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		m.syncWindows(ctx, activeStates)
+	}, windowSyncPeriod)
+}
+
+func (m *Manager) syncWindows(ctx context.Context, activeStates map[types.UID]bool) {
+	selectors, err := m.resourceManager.ListSelectors()
+	if err != nil {
+		klog.Errorf("failed to list selectors: %q", err)
+		return
+	}
+	now := time.Now()
+	transitioned := false
+	seen := map[types.UID]bool{}
+	for _, selector := range selectors {
+		seen[selector.UID] = true
+		windows, err := m.selectors.windows(selector)
+		if err != nil {
+			klog.Errorf("invalid active windows of selector %s: %q", selector.Name, err)
+			continue
+		}
+		active, next := windowState(windows, now)
+		if last, ok := activeStates[selector.UID]; ok && last != active {
+			klog.Infof("selector %s turns active: %v", selector.Name, active)
+			transitioned = true
+		}
+		activeStates[selector.UID] = active
+		var nextActivationTime *metav1.Time
+		if next != nil {
+			t := metav1.NewTime(next.Truncate(time.Second))
+			nextActivationTime = &t
+		}
+		if selector.Status.Active == active && selector.Status.NextActivationTime.Equal(nextActivationTime) {
+			continue
+		}
+		if err := m.updateSelectorStatus(ctx, selector, func(status *eciv1.SelectorStatus) {
+			status.Active = active
+			status.NextActivationTime = nextActivationTime
+		}); err != nil {
+			// retried by the next sync
+			klog.Warningf("failed to update status of selector %s: %v", selector.Name, err)
+		}
+	}
+	for uid := range activeStates {
+		if !seen[uid] {
+			delete(activeStates, uid)
+		}
+	}
+	if transitioned {
+		m.reevaluatePendingPods()
+	}
+}
+
+// updateSelectorStatus writes the status mutated from the selector in the
+// cache, the loops writing the status concurrently retry with the latest
+// selector on conflicts.
+func (m *Manager) updateSelectorStatus(ctx context.Context, selector *eciv1.Selector, mutate func(status *eciv1.SelectorStatus)) error {
+	current := selector
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		updated := current.DeepCopy()
+		mutate(&updated.Status)
+		_, err := m.profileClient.EciV1().Selectors().UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+		if api_errors.IsConflict(err) {
+			latest, getErr := m.profileClient.EciV1().Selectors().Get(ctx, selector.Name, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+			current = latest
+		}
+		return err
+	})
+}
+
+// reevaluatePendingPods queues the pending pods to run the unscheduled policy
+// again, since the selector matching them may have changed.
+func (m *Manager) reevaluatePendingPods() {
+	pods, err := m.resourceManager.ListPods("")
+	if err != nil {
+		klog.Errorf("failed to list pods: %q", err)
+		return
+	}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" || pod.DeletionTimestamp != nil || !isUnscheduledPod(pod) {
+			continue
+		}
+		m.enqueueUnscheduledPod(pod)
+	}
+}
@@ -0,0 +1,78 @@
+package profile
+
+import (
+	"context"
+	"testing"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	profilefake "eci.io/eci-profile/pkg/client/clientset/versioned/fake"
+	v1 "k8s.io/api/core/v1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestSyncStatusOnConflict(t *testing.T) {
+	selector := newTestSelector("foo", eciv1.SelectorSpec{})
+	m := newTestManager(t, nil, []runtime.Object{selector})
+	client := m.profileClient.(*profilefake.Clientset)
+	// the first update of every status conflicts with a concurrent writer
+	conflicted := map[string]bool{}
+	client.PrependReactor("update", "selectors", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		updated := action.(k8stesting.UpdateAction).GetObject().(*eciv1.Selector)
+		kind := "audit"
+		if updated.Status.Drift != nil {
+			kind = "drift"
+		}
+		if action.GetSubresource() != "status" || conflicted[kind] {
+			return false, nil, nil
+		}
+		conflicted[kind] = true
+		return true, nil, api_errors.NewConflict(schema.GroupResource{Group: eciv1.SchemeGroupVersion.Group, Resource: "selectors"}, updated.Name, nil)
+	})
+
+	m.audits.record(selector, &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "pod"}}, "creating", "{}", metav1.Now().Time)
+	m.drifts.record(selector.UID, 2, 1, metav1.Now().Time)
+	m.syncAuditStatus(context.TODO())
+	m.syncDriftStatus(context.TODO())
+
+	updated, err := client.EciV1().Selectors().Get(context.TODO(), selector.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get selector: %v", err)
+	}
+	if !conflicted["audit"] || !conflicted["drift"] {
+		t.Errorf("expect both updates conflicted once, but got %v", conflicted)
+	}
+	if updated.Status.Audit == nil || updated.Status.Audit.AuditedPods != 1 {
+		t.Errorf("expect 1 audited pod in the status, but got %v", updated.Status.Audit)
+	}
+	if updated.Status.Drift == nil || updated.Status.Drift.DriftedPods != 2 {
+		t.Errorf("expect 2 drifted pods in the status, but got %v", updated.Status.Drift)
+	}
+	if m.audits.take(selector.UID) != nil || m.drifts.take(selector.UID) != nil {
+		t.Errorf("expect the written audits and drifts taken")
+	}
+}
+
+func TestReevaluatePendingPods(t *testing.T) {
+	unschedulable := v1.PodStatus{Conditions: []v1.PodCondition{{
+		Type:   v1.PodScheduled,
+		Status: v1.ConditionFalse,
+		Reason: v1.PodReasonUnschedulable,
+	}}}
+	pending := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default"}, Status: unschedulable}
+	bound := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "bound", Namespace: "default"}, Spec: v1.PodSpec{NodeName: "node"}}
+	m := newTestManager(t, []runtime.Object{pending, bound}, nil)
+
+	m.reevaluatePendingPods()
+	if m.overflowQueue.Len() != 1 {
+		t.Fatalf("expect the pending pod queued, but got %d pods", m.overflowQueue.Len())
+	}
+	key, _ := m.overflowQueue.Get()
+	if key != "default/pending" {
+		t.Errorf("expect default/pending queued, but got %v", key)
+	}
+	m.overflowQueue.Done(key)
+}
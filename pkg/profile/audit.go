@@ -0,0 +1,174 @@
+package profile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// EventReasonSelectorAudited is recorded on the pods a selector in Audit
+	// mode would have mutated.
+	EventReasonSelectorAudited = "SelectorAudited"
+
+	maxAuditPatchLength = 1024
+)
+
+func isAuditMode(selector *eciv1.Selector) bool {
+	return selector.Spec.Mode == eciv1.SelectorModeAudit
+}
+
+// auditRecorder accumulates the audits of every selector until they are
+// written to the selector status, and remembers the audited pods so that a
+// pod processed repeatedly is audited only once per phase.
+type auditRecorder struct {
+	lock      sync.Mutex
+	summaries map[types.UID]*eciv1.AuditStatus
+	audited   map[types.UID]map[string]bool
+}
+
+func newAuditRecorder() *auditRecorder {
+	return &auditRecorder{
+		summaries: map[types.UID]*eciv1.AuditStatus{},
+		audited:   map[types.UID]map[string]bool{},
+	}
+}
+
+// record returns false when the pod has been audited by the selector in the phase.
+func (r *auditRecorder) record(selector *eciv1.Selector, pod *v1.Pod, phase, patch string, now time.Time) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// the UID of a creating pod isn't assigned yet, and every admission counts
+	if pod.UID != "" {
+		key := fmt.Sprintf("%s/%d/%s", selector.UID, selector.Generation, phase)
+		if r.audited[pod.UID][key] {
+			return false
+		}
+		if r.audited[pod.UID] == nil {
+			r.audited[pod.UID] = map[string]bool{}
+		}
+		r.audited[pod.UID][key] = true
+	}
+	summary, ok := r.summaries[selector.UID]
+	if !ok {
+		summary = &eciv1.AuditStatus{}
+		r.summaries[selector.UID] = summary
+	}
+	t := metav1.NewTime(now)
+	summary.AuditedPods++
+	summary.LastAuditTime = &t
+	summary.LastPod = podName(pod)
+	summary.LastPhase = phase
+	summary.LastPatch = patch
+	return true
+}
+
+// take removes the accumulated audit of the selector.
+func (r *auditRecorder) take(uid types.UID) *eciv1.AuditStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	summary := r.summaries[uid]
+	delete(r.summaries, uid)
+	return summary
+}
+
+// restore gives back an audit which failed to be written.
+func (r *auditRecorder) restore(uid types.UID, summary *eciv1.AuditStatus) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if current, ok := r.summaries[uid]; ok {
+		current.AuditedPods += summary.AuditedPods
+		return
+	}
+	r.summaries[uid] = summary
+}
+
+func (r *auditRecorder) forgetPod(uid types.UID) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.audited, uid)
+}
+
+// auditPod records what the selector in Audit mode would have applied to the
+// pod, as an Event, a metric and later in the selector status. Nothing is
+// recorded on a dry run.
+func (m *Manager) auditPod(selector *eciv1.Selector, pod *v1.Pod, phase string, patch interface{}, dryRun bool) {
+	if dryRun {
+		return
+	}
+	payload, err := json.Marshal(patch)
+	if err != nil {
+		klog.Errorf("failed to marshal the audited patch of pod %s/%s: %q", pod.Namespace, pod.Name, err)
+		return
+	}
+	audited := string(payload)
+	if len(audited) > maxAuditPatchLength {
+		audited = audited[:maxAuditPatchLength] + "..."
+	}
+	if !m.audits.record(selector, pod, phase, audited, time.Now()) {
+		return
+	}
+	klog.Infof("selector %s in Audit mode would patch pod %s/%s when %s: %s", selector.Name, pod.Namespace, pod.Name, phase, audited)
+	metrics.AuditedPods.WithLabelValues(selector.Name, phase).Inc()
+	message := fmt.Sprintf("selector %s in Audit mode would patch the pod when %s: %s", selector.Name, phase, audited)
+	if pod.Name != "" {
+		m.eventRecorder.Event(pod, v1.EventTypeNormal, EventReasonSelectorAudited, message)
+	} else {
+		m.eventRecorder.Event(selector, v1.EventTypeNormal, EventReasonSelectorAudited, fmt.Sprintf("pod %s: %s", podName(pod), message))
+	}
+}
+
+// runAuditStatusSync periodically writes the accumulated audits to the
+// selector status.
+func (m *Manager) runAuditStatusSync(ctx context.Context) {
+	wait.UntilWithContext(ctx, m.syncAuditStatus, statusSyncPeriod)
+}
+
+func (m *Manager) syncAuditStatus(ctx context.Context) {
+	selectors, err := m.resourceManager.ListSelectors()
+	if err != nil {
+		klog.Errorf("failed to list selectors: %q", err)
+		return
+	}
+	for _, selector := range selectors {
+		summary := m.audits.take(selector.UID)
+		if summary == nil {
+			continue
+		}
+		if err := m.updateSelectorStatus(ctx, selector, func(status *eciv1.SelectorStatus) {
+			status.Audit = mergeAuditStatus(status.Audit, summary)
+		}); err != nil {
+			// retried by the next sync
+			klog.Warningf("failed to update audit status of selector %s: %v", selector.Name, err)
+			m.audits.restore(selector.UID, summary)
+		}
+	}
+}
+
+// mergeAuditStatus adds the accumulated audit to the status of the selector.
+func mergeAuditStatus(status *eciv1.AuditStatus, summary *eciv1.AuditStatus) *eciv1.AuditStatus {
+	merged := summary.DeepCopy()
+	if status != nil {
+		merged.AuditedPods += status.AuditedPods
+	}
+	return merged
+}
+
+// podName returns namespace/name of the pod, or namespace/generateName* when
+// the name isn't generated yet.
+func podName(pod *v1.Pod) string {
+	if pod.Name == "" {
+		return fmt.Sprintf("%s/%s*", pod.Namespace, pod.GenerateName)
+	}
+	return fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+}
@@ -0,0 +1,65 @@
+package profile
+
+import (
+	"testing"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/policy"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAuditRecorder(t *testing.T) {
+	recorder := newAuditRecorder()
+	selector := &eciv1.Selector{ObjectMeta: metav1.ObjectMeta{Name: "audit", UID: "selector-uid", Generation: 1}}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", UID: "pod-uid"}}
+	unnamed := &v1.Pod{ObjectMeta: metav1.ObjectMeta{GenerateName: "nginx-", Namespace: "default"}}
+	now := time.Now()
+
+	if !recorder.record(selector, pod, policy.PhaseUnscheduled, "{}", now) {
+		t.Errorf("expect the first audit of the pod recorded")
+	}
+	if recorder.record(selector, pod, policy.PhaseUnscheduled, "{}", now) {
+		t.Errorf("expect the pod audited once per phase")
+	}
+	if !recorder.record(selector, pod, policy.PhaseScheduled, "{}", now) {
+		t.Errorf("expect the pod audited again in another phase")
+	}
+	// every admission of the creating pods counts
+	recorder.record(selector, unnamed, policy.PhaseCreating, "[]", now)
+	recorder.record(selector, unnamed, policy.PhaseCreating, "[]", now)
+
+	summary := recorder.take(selector.UID)
+	if summary == nil || summary.AuditedPods != 4 {
+		t.Fatalf("expect 4 audited pods, but got %v", summary)
+	}
+	if summary.LastPod != "default/nginx-*" || summary.LastPhase != policy.PhaseCreating || summary.LastPatch != "[]" {
+		t.Errorf("unexpected last audit: %v", summary)
+	}
+	if recorder.take(selector.UID) != nil {
+		t.Errorf("expect the audit taken only once")
+	}
+
+	merged := mergeAuditStatus(&eciv1.AuditStatus{AuditedPods: 10}, summary)
+	if merged.AuditedPods != 14 || merged.LastPod != summary.LastPod {
+		t.Errorf("unexpected merged audit: %v", merged)
+	}
+
+	// a failed status update gives the audit back
+	recorder.restore(selector.UID, summary)
+	recorder.record(selector, unnamed, policy.PhaseCreating, "[]", now)
+	if restored := recorder.take(selector.UID); restored.AuditedPods != 5 {
+		t.Errorf("expect 5 audited pods after restoring, but got %d", restored.AuditedPods)
+	}
+
+	// the pod is audited again once its selector changes
+	selector.Generation++
+	if !recorder.record(selector, pod, policy.PhaseUnscheduled, "{}", now) {
+		t.Errorf("expect the pod audited by the new generation")
+	}
+	recorder.forgetPod(pod.UID)
+	if len(recorder.audited) != 0 {
+		t.Errorf("expect the deleted pod forgotten")
+	}
+}
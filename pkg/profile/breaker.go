@@ -0,0 +1,294 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"eci.io/eci-profile/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// EventReasonBreakerOpened is recorded on the virtual nodes found unhealthy,
+	// EventReasonBreakerHalfOpened once they pass the probe period, and
+	// EventReasonBreakerClosed once a pod runs on them again.
+	EventReasonBreakerOpened     = "VirtualNodeBreakerOpened"
+	EventReasonBreakerHalfOpened = "VirtualNodeBreakerHalfOpened"
+	EventReasonBreakerClosed     = "VirtualNodeBreakerClosed"
+
+	// breakerSyncPeriod is how often the open breakers are probed
+	breakerSyncPeriod = 30 * time.Second
+	// breakerMinSamples is the number of pod outcomes in the window before
+	// the failure ratio opens a breaker
+	breakerMinSamples = 10
+)
+
+type breakerPhase int
+
+const (
+	breakerClosed breakerPhase = iota
+	// breakerOpen excludes the virtual node from the placement
+	breakerOpen
+	// breakerHalfOpen lets the pods on the virtual node again after the probe
+	// period, the outcome of the next pod closes or reopens the breaker
+	breakerHalfOpen
+)
+
+type podOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+// breakerState is the breaker of a virtual node with its recent pod outcomes.
+type breakerState struct {
+	phase    breakerPhase
+	openedAt time.Time
+	outcomes []podOutcome
+}
+
+// virtualNodeBreakers tracks the health of each virtual node. The pods placed
+// on virtual nodes exclude the nodes whose breakers are open, and the
+// placement on virtual nodes is suspended while all of them are open.
+type virtualNodeBreakers struct {
+	lock  sync.Mutex
+	nodes map[string]*breakerState
+
+	window       time.Duration
+	failureRatio float64
+	probePeriod  time.Duration
+}
+
+func newVirtualNodeBreakers(window time.Duration, failureRatio float64, probePeriod time.Duration) *virtualNodeBreakers {
+	return &virtualNodeBreakers{
+		nodes:        map[string]*breakerState{},
+		window:       window,
+		failureRatio: failureRatio,
+		probePeriod:  probePeriod,
+	}
+}
+
+// IsOpen reports whether the breakers of all the known virtual nodes are open.
+func (b *virtualNodeBreakers) IsOpen() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(b.nodes) == 0 {
+		return false
+	}
+	for _, state := range b.nodes {
+		if state.phase != breakerOpen {
+			return false
+		}
+	}
+	return true
+}
+
+// OpenNodes returns the virtual nodes whose breakers are open, sorted by name.
+func (b *virtualNodeBreakers) OpenNodes() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var nodes []string
+	for node, state := range b.nodes {
+		if state.phase == breakerOpen {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+func (b *virtualNodeBreakers) state(node string) *breakerState {
+	state, ok := b.nodes[node]
+	if !ok {
+		state = &breakerState{}
+		b.nodes[node] = state
+	}
+	return state
+}
+
+// observeNode opens the breaker of the virtual node which isn't ready, it
+// returns true if the breaker is opened by the call.
+func (b *virtualNodeBreakers) observeNode(node string, ready bool, now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state := b.state(node)
+	if ready || state.phase == breakerOpen {
+		return false
+	}
+	state.phase, state.openedAt = breakerOpen, now
+	return true
+}
+
+// recordOutcome records whether a pod failed on the virtual node, it returns
+// the failure ratio and the phase the breaker is moved to by the call, or
+// false if the phase isn't changed. A half-open breaker is closed by a pod
+// running and reopened by a pod failed.
+func (b *virtualNodeBreakers) recordOutcome(node string, failed bool, now time.Time) (float64, breakerPhase, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state := b.state(node)
+	if state.phase == breakerHalfOpen {
+		if failed {
+			state.phase, state.openedAt = breakerOpen, now
+			return 1, breakerOpen, true
+		}
+		state.phase = breakerClosed
+		return 0, breakerClosed, true
+	}
+	outcomes := state.outcomes[:0]
+	for _, outcome := range state.outcomes {
+		if now.Sub(outcome.at) < b.window {
+			outcomes = append(outcomes, outcome)
+		}
+	}
+	state.outcomes = append(outcomes, podOutcome{at: now, failed: failed})
+	if state.phase == breakerOpen || b.failureRatio <= 0 || len(state.outcomes) < breakerMinSamples {
+		return 0, state.phase, false
+	}
+	failures := 0
+	for _, outcome := range state.outcomes {
+		if outcome.failed {
+			failures++
+		}
+	}
+	ratio := float64(failures) / float64(len(state.outcomes))
+	if ratio < b.failureRatio {
+		return ratio, state.phase, false
+	}
+	state.phase, state.openedAt = breakerOpen, now
+	return ratio, breakerOpen, true
+}
+
+// probe half-opens the breaker of the ready virtual node open for the probe
+// period, the outcomes before are forgotten. It returns true if the breaker
+// is half-opened by the call.
+func (b *virtualNodeBreakers) probe(node string, ready bool, now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state := b.state(node)
+	if state.phase != breakerOpen || !ready || now.Sub(state.openedAt) < b.probePeriod {
+		return false
+	}
+	state.phase, state.outcomes = breakerHalfOpen, nil
+	return true
+}
+
+func (b *virtualNodeBreakers) forget(node string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.nodes, node)
+}
+
+func isNodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// observeVirtualNode opens the breaker of the virtual node not ready.
+func (m *Manager) observeVirtualNode(node *v1.Node) {
+	if m.breakers == nil || !m.policyManager.IsVirtualNode(node) {
+		return
+	}
+	if m.breakers.observeNode(node.Name, isNodeReady(node), time.Now()) {
+		m.onBreakerOpened(node, "the node is not ready")
+	}
+}
+
+// observePodOutcome records whether the pod bound to a virtual node started
+// running, or failed before.
+func (m *Manager) observePodOutcome(oldPod, newPod *v1.Pod) {
+	if m.breakers == nil || newPod.Spec.NodeName == "" || oldPod.Status.Phase != v1.PodPending {
+		return
+	}
+	var failed bool
+	switch {
+	case newPod.Status.Phase == v1.PodRunning || newPod.Status.Phase == v1.PodSucceeded:
+		failed = false
+	case newPod.Status.Phase == v1.PodFailed:
+		// the failure signature was recorded while the pod was pending
+		if matchFailure(m.failurePatterns, oldPod, nil) != "" {
+			return
+		}
+		failed = true
+	case oldPod.Status.Reason != newPod.Status.Reason && matchFailure(m.failurePatterns, newPod, nil) != "":
+		failed = true
+	default:
+		return
+	}
+	node, err := m.resourceManager.GetNode(newPod.Spec.NodeName)
+	if err != nil || !m.policyManager.IsVirtualNode(node) {
+		return
+	}
+	suspended := m.breakers.IsOpen()
+	ratio, phase, changed := m.breakers.recordOutcome(node.Name, failed, time.Now())
+	switch {
+	case !changed:
+	case phase == breakerOpen:
+		m.onBreakerOpened(node, fmt.Sprintf("%.0f%% of the recent pods failed", ratio*100))
+	case phase == breakerClosed:
+		klog.Infof("breaker of virtual node %s is closed", node.Name)
+		metrics.VirtualNodeBreakerOpen.WithLabelValues(node.Name).Set(0)
+		m.eventRecorder.Event(node, v1.EventTypeNormal, EventReasonBreakerClosed, fmt.Sprintf("Breaker is closed since pod %s/%s is running", newPod.Namespace, newPod.Name))
+	}
+	if suspended && !m.breakers.IsOpen() {
+		// the pending pods may overflow to virtual nodes again
+		m.reevaluatePendingPods()
+	}
+}
+
+func (m *Manager) onBreakerOpened(node *v1.Node, reason string) {
+	klog.Warningf("breaker of virtual node %s is opened: %s", node.Name, reason)
+	metrics.VirtualNodeBreakerOpen.WithLabelValues(node.Name).Set(1)
+	m.eventRecorder.Event(node, v1.EventTypeWarning, EventReasonBreakerOpened,
+		fmt.Sprintf("Breaker is opened since %s, it's probed again in %v", reason, m.breakers.probePeriod))
+}
+
+// runBreakerProbe half-opens the breakers of the virtual nodes ready again.
+func (m *Manager) runBreakerProbe(ctx context.Context) {
+	if m.breakers == nil {
+		klog.Info("virtual node breaker is disabled")
+		return
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		m.probeVirtualNodes(time.Now())
+	}, breakerSyncPeriod)
+}
+
+func (m *Manager) probeVirtualNodes(now time.Time) {
+	nodes, err := m.resourceManager.ListNodes()
+	if err != nil {
+		klog.Errorf("failed to list nodes: %q", err)
+		return
+	}
+	suspended := m.breakers.IsOpen()
+	for _, node := range nodes {
+		if !m.policyManager.IsVirtualNode(node) {
+			continue
+		}
+		if m.breakers.probe(node.Name, isNodeReady(node), now) {
+			klog.Infof("breaker of virtual node %s is half-opened", node.Name)
+			metrics.VirtualNodeBreakerOpen.WithLabelValues(node.Name).Set(0)
+			m.eventRecorder.Event(node, v1.EventTypeNormal, EventReasonBreakerHalfOpened, "Breaker is half-opened after the probe period, the next pod on the node closes or reopens it")
+		}
+	}
+	if suspended && !m.breakers.IsOpen() {
+		// the pending pods may overflow to virtual nodes again
+		m.reevaluatePendingPods()
+	}
+}
+
+func (m *Manager) forgetVirtualNode(node *v1.Node) {
+	if m.breakers == nil {
+		return
+	}
+	m.breakers.forget(node.Name)
+	metrics.VirtualNodeBreakerOpen.DeleteLabelValues(node.Name)
+}
@@ -0,0 +1,125 @@
+package profile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestVirtualNodeBreakers(t *testing.T) {
+	breakers := newVirtualNodeBreakers(10*time.Minute, 0.3, 5*time.Minute)
+	now := time.Now()
+	if breakers.IsOpen() {
+		t.Fatalf("expect no breaker open without virtual nodes")
+	}
+	breakers.observeNode("vk-a", true, now)
+	breakers.observeNode("vk-b", true, now)
+	if !breakers.observeNode("vk-a", false, now) {
+		t.Errorf("expect the breaker of the not ready node opened")
+	}
+	if breakers.IsOpen() {
+		t.Errorf("expect the placement allowed while vk-b is healthy")
+	}
+
+	for i := 0; i < breakerMinSamples-1; i++ {
+		if _, _, opened := breakers.recordOutcome("vk-b", true, now); opened {
+			t.Fatalf("expect the breaker kept closed before %d outcomes", breakerMinSamples)
+		}
+	}
+	// the outcomes out of the window are forgotten
+	if _, _, opened := breakers.recordOutcome("vk-b", true, now.Add(11*time.Minute)); opened {
+		t.Errorf("expect the expired outcomes forgotten")
+	}
+	later := now.Add(12 * time.Minute)
+	for i := 0; i < breakerMinSamples-3; i++ {
+		breakers.recordOutcome("vk-b", false, later)
+	}
+	ratio, _, opened := breakers.recordOutcome("vk-b", true, later)
+	if opened {
+		t.Errorf("expect the breaker kept closed at ratio %v", ratio)
+	}
+	ratio, phase, opened := breakers.recordOutcome("vk-b", true, later)
+	if !opened || phase != breakerOpen || ratio != 0.3 {
+		t.Errorf("expect the breaker opened at ratio 0.3, but got %v, %v", ratio, opened)
+	}
+	if !breakers.IsOpen() {
+		t.Errorf("expect the placement suspended once all breakers open")
+	}
+	if open := breakers.OpenNodes(); !reflect.DeepEqual(open, []string{"vk-a", "vk-b"}) {
+		t.Errorf("expect vk-a and vk-b open, but got %v", open)
+	}
+
+	if breakers.probe("vk-b", true, later.Add(time.Minute)) {
+		t.Errorf("expect the breaker kept open within the probe period")
+	}
+	if breakers.probe("vk-a", false, later.Add(10*time.Minute)) {
+		t.Errorf("expect the breaker of the not ready node kept open")
+	}
+	if !breakers.probe("vk-b", true, later.Add(5*time.Minute)) {
+		t.Errorf("expect the breaker half-opened after the probe period")
+	}
+	if breakers.IsOpen() {
+		t.Errorf("expect the placement allowed again")
+	}
+	breakers.forget("vk-b")
+	if !breakers.IsOpen() {
+		t.Errorf("expect the placement suspended since the only node left is open")
+	}
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	vnode := newVirtualNode("vk-a")
+	vnode.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+	m := newTestManager(t, []runtime.Object{vnode, newVirtualNode("vk-b")}, nil)
+	m.breakers = newVirtualNodeBreakers(10*time.Minute, 0.5, 5*time.Minute)
+	newPod := func(phase v1.PodPhase) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       v1.PodSpec{NodeName: "vk-a"},
+			Status:     v1.PodStatus{Phase: phase},
+		}
+	}
+	pending, running, failed := newPod(v1.PodPending), newPod(v1.PodRunning), newPod(v1.PodFailed)
+	expectPhase := func(step string, expect breakerPhase, reasons ...string) {
+		m.breakers.lock.Lock()
+		actual := m.breakers.state("vk-a").phase
+		m.breakers.lock.Unlock()
+		if actual != expect {
+			t.Errorf("[%s] expect the breaker in phase %v, but got %v", step, expect, actual)
+		}
+		var actualReasons []string
+		for _, event := range recordedEvents(m) {
+			for _, reason := range []string{EventReasonBreakerOpened, EventReasonBreakerHalfOpened, EventReasonBreakerClosed} {
+				if strings.Contains(event, " "+reason+" ") {
+					actualReasons = append(actualReasons, reason)
+				}
+			}
+		}
+		if !reflect.DeepEqual(actualReasons, reasons) {
+			t.Errorf("[%s] expect events %v, but got %v", step, reasons, actualReasons)
+		}
+	}
+
+	for i := 0; i < breakerMinSamples; i++ {
+		m.observePodOutcome(pending, failed)
+	}
+	expectPhase("failed pods", breakerOpen, EventReasonBreakerOpened)
+	m.probeVirtualNodes(time.Now().Add(time.Minute))
+	expectPhase("within the probe period", breakerOpen)
+	m.probeVirtualNodes(time.Now().Add(5 * time.Minute))
+	expectPhase("after the probe period", breakerHalfOpen, EventReasonBreakerHalfOpened)
+	m.observePodOutcome(pending, failed)
+	expectPhase("failed probe", breakerOpen, EventReasonBreakerOpened)
+	m.probeVirtualNodes(time.Now().Add(5 * time.Minute))
+	expectPhase("probed again", breakerHalfOpen, EventReasonBreakerHalfOpened)
+	m.observePodOutcome(pending, running)
+	expectPhase("running pod", breakerClosed, EventReasonBreakerClosed)
+	if open := m.breakers.OpenNodes(); len(open) != 0 {
+		t.Errorf("expect no breaker open, but got %v", open)
+	}
+}
@@ -0,0 +1,365 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/metrics"
+	"eci.io/eci-profile/pkg/utils"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// budgetSyncPeriod is how often the usage of the virtual node budgets is
+// written to their status.
+const budgetSyncPeriod = 30 * time.Second
+
+// budgetReservationTTL is how long the requests of a pod admitted to virtual
+// nodes are reserved before the pod informer accounts it, the pod may never be
+// created if the admission fails later.
+const budgetReservationTTL = time.Minute
+
+// virtualNodeUsage is the resources requested by the pods on virtual nodes,
+// in the whole cluster and by namespace.
+type virtualNodeUsage struct {
+	cluster    v1.ResourceList
+	namespaces map[string]v1.ResourceList
+}
+
+func newVirtualNodeUsage() *virtualNodeUsage {
+	return &virtualNodeUsage{cluster: v1.ResourceList{}, namespaces: map[string]v1.ResourceList{}}
+}
+
+func (u *virtualNodeUsage) of(budget *eciv1.VirtualNodeBudget) v1.ResourceList {
+	if budget.Spec.Namespace == "" {
+		return u.cluster
+	}
+	return u.namespaces[budget.Spec.Namespace]
+}
+
+func (u *virtualNodeUsage) add(namespace string, requests v1.ResourceList) {
+	addResources(u.cluster, requests)
+	if u.namespaces[namespace] == nil {
+		u.namespaces[namespace] = v1.ResourceList{}
+	}
+	addResources(u.namespaces[namespace], requests)
+}
+
+func (u *virtualNodeUsage) sub(namespace string, requests v1.ResourceList) {
+	subResources(u.cluster, requests)
+	if u.namespaces[namespace] != nil {
+		subResources(u.namespaces[namespace], requests)
+	}
+}
+
+func (u *virtualNodeUsage) deepCopy() *virtualNodeUsage {
+	result := &virtualNodeUsage{cluster: u.cluster.DeepCopy(), namespaces: make(map[string]v1.ResourceList, len(u.namespaces))}
+	for namespace, list := range u.namespaces {
+		result.namespaces[namespace] = list.DeepCopy()
+	}
+	return result
+}
+
+// budgetUsage accounts the requests of the pods on virtual nodes as the pod
+// informer sees them, so that checking a budget doesn't walk the cluster pods.
+// The requests of the pods admitted to virtual nodes but not seen by the
+// informer yet are reserved, so that the concurrent admissions can't all take
+// the last of a budget.
+type budgetUsage struct {
+	lock         sync.Mutex
+	usage        *virtualNodeUsage
+	pods         map[types.UID]accountedPod
+	reservations []budgetReservation
+}
+
+type accountedPod struct {
+	namespace string
+	requests  v1.ResourceList
+}
+
+// budgetReservation is keyed by the name of the admitted pod, or its generate
+// name since the name may be generated after admission.
+type budgetReservation struct {
+	namespace string
+	name      string
+	requests  v1.ResourceList
+	expires   time.Time
+}
+
+func newBudgetUsage() *budgetUsage {
+	return &budgetUsage{usage: newVirtualNodeUsage(), pods: map[types.UID]accountedPod{}}
+}
+
+// account updates the requests of the pod in the usage, the reservation made
+// when the pod was admitted is released once the pod is accounted.
+func (b *budgetUsage) account(pod *v1.Pod, virtual bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	accounted, ok := b.pods[pod.UID]
+	if ok {
+		b.usage.sub(accounted.namespace, accounted.requests)
+		delete(b.pods, pod.UID)
+	}
+	if !virtual {
+		return
+	}
+	requests := utils.PodRequests(pod)
+	b.pods[pod.UID] = accountedPod{namespace: pod.Namespace, requests: requests}
+	b.usage.add(pod.Namespace, requests)
+	if !ok {
+		b.releaseLocked(pod)
+	}
+}
+
+// reserve reserves the requests of the pod in the budgets unless any of them
+// is exhausted, which is returned with the message telling why.
+func (b *budgetUsage) reserve(pod *v1.Pod, budgets []*eciv1.VirtualNodeBudget, now time.Time) (*eciv1.VirtualNodeBudget, string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	usage := b.usedLocked(pod, now)
+	requests := utils.PodRequests(pod)
+	for _, budget := range budgets {
+		used := usage.of(budget)
+		if !fitsBudget(budget.Spec.Limits, used, requests) {
+			limits := budget.Spec.Limits
+			return budget, fmt.Sprintf("virtual node budget %s is exhausted, used %s of %s, the pod requests %s",
+				budget.Name, formatResources(limits, used), formatResources(limits, limits), formatResources(limits, requests))
+		}
+	}
+	b.reservations = append(b.reservations, budgetReservation{
+		namespace: pod.Namespace,
+		name:      reservationName(pod),
+		requests:  requests,
+		expires:   now.Add(budgetReservationTTL),
+	})
+	return nil, ""
+}
+
+// release releases the reservation of the pod which isn't placed on virtual
+// nodes as admitted, e.g. the admission is a dry run or the patch failed.
+func (b *budgetUsage) release(pod *v1.Pod) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.releaseLocked(pod)
+}
+
+// releaseLocked releases the oldest reservation of the pod, the reservations
+// sharing a generate name are interchangeable.
+func (b *budgetUsage) releaseLocked(pod *v1.Pod) {
+	for i, reservation := range b.reservations {
+		if reservation.namespace != pod.Namespace {
+			continue
+		}
+		if reservation.name == pod.Name || (pod.GenerateName != "" && reservation.name == pod.GenerateName) {
+			b.reservations = append(b.reservations[:i:i], b.reservations[i+1:]...)
+			return
+		}
+	}
+}
+
+// used returns the usage of the accounted pods and the reservations.
+func (b *budgetUsage) used(now time.Time) *virtualNodeUsage {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.usedLocked(nil, now)
+}
+
+// usedLocked returns the usage except the pod being checked, and drops the
+// expired reservations.
+func (b *budgetUsage) usedLocked(except *v1.Pod, now time.Time) *virtualNodeUsage {
+	usage := b.usage.deepCopy()
+	if except != nil && except.UID != "" {
+		if accounted, ok := b.pods[except.UID]; ok {
+			usage.sub(accounted.namespace, accounted.requests)
+		}
+	}
+	var live []budgetReservation
+	for _, reservation := range b.reservations {
+		if now.After(reservation.expires) {
+			continue
+		}
+		live = append(live, reservation)
+		usage.add(reservation.namespace, reservation.requests)
+	}
+	b.reservations = live
+	return usage
+}
+
+func reservationName(pod *v1.Pod) string {
+	if pod.Name != "" {
+		return pod.Name
+	}
+	return pod.GenerateName
+}
+
+// isVirtualNodePod reports whether the pod is accounted against the virtual
+// node budgets, with the tolerations of the selector which mutated it.
+func (m *Manager) isVirtualNodePod(pod *v1.Pod) bool {
+	var node *v1.Node
+	var selector *eciv1.Selector
+	if pod.Spec.NodeName != "" {
+		// the node not found yet is accounted by the next resync
+		node, _ = m.resourceManager.GetNode(pod.Spec.NodeName)
+	} else {
+		traced, err := m.tracedSelector(pod)
+		if err != nil {
+			klog.V(3).Infof("failed to find the selector of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+		selector = traced
+	}
+	return m.policyManager.IsVirtualNodePod(selector, pod, node)
+}
+
+// reserveBudget reserves the requests of the pod placed on virtual nodes in
+// its budgets, it returns the budget which the pod doesn't fit in and the
+// message telling why. The reservation is released once the pod informer
+// accounts the pod.
+func (m *Manager) reserveBudget(pod *v1.Pod) (*eciv1.VirtualNodeBudget, string, error) {
+	allBudgets, err := m.resourceManager.ListVirtualNodeBudgets()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to list virtual node budgets")
+	}
+	var budgets []*eciv1.VirtualNodeBudget
+	for _, budget := range allBudgets {
+		if budget.Spec.Namespace == "" || budget.Spec.Namespace == pod.Namespace {
+			budgets = append(budgets, budget)
+		}
+	}
+	if len(budgets) == 0 {
+		return nil, "", nil
+	}
+	sort.Slice(budgets, func(i, j int) bool {
+		return budgets[i].Name < budgets[j].Name
+	})
+	budget, message := m.budgetUsage.reserve(pod, budgets, time.Now())
+	return budget, message, nil
+}
+
+// admitBoundPod denies the pod bound to a virtual node at creation once its
+// budgets are exhausted, since it can't run elsewhere.
+func (m *Manager) admitBoundPod(pod *v1.Pod, dryRun bool) error {
+	budget, message, err := m.reserveBudget(pod)
+	if err != nil {
+		return errors.Wrap(err, "failed to check virtual node budgets")
+	}
+	if budget != nil {
+		return errors.New(message)
+	}
+	if dryRun {
+		m.budgetUsage.release(pod)
+	}
+	return nil
+}
+
+// fitsBudget reports whether the requests fit in the limits besides the used
+// resources, nothing fits once any used resource reaches its limit.
+func fitsBudget(limits, used, requests v1.ResourceList) bool {
+	for name, limit := range limits {
+		current := used[name]
+		if current.Cmp(limit) >= 0 {
+			return false
+		}
+		total := current.DeepCopy()
+		total.Add(requests[name])
+		if total.Cmp(limit) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isBudgetExhausted reports whether any used resource reaches its limit.
+func isBudgetExhausted(limits, used v1.ResourceList) bool {
+	return !fitsBudget(limits, used, nil)
+}
+
+// budgetUsed returns the used resources limited by the budget.
+func budgetUsed(limits, used v1.ResourceList) v1.ResourceList {
+	result := v1.ResourceList{}
+	for name := range limits {
+		quantity := used[name]
+		result[name] = quantity.DeepCopy()
+	}
+	return result
+}
+
+// formatResources formats the resources named in the limits, e.g. "cpu=2,memory=4Gi".
+func formatResources(limits, resources v1.ResourceList) string {
+	var names []string
+	for name := range limits {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	items := make([]string, 0, len(names))
+	for _, name := range names {
+		quantity := resources[v1.ResourceName(name)]
+		items = append(items, fmt.Sprintf("%s=%s", name, quantity.String()))
+	}
+	return strings.Join(items, ",")
+}
+
+func addResources(list, added v1.ResourceList) {
+	for name, quantity := range added {
+		value := list[name]
+		value.Add(quantity)
+		list[name] = value
+	}
+}
+
+func subResources(list, removed v1.ResourceList) {
+	for name, quantity := range removed {
+		value := list[name]
+		value.Sub(quantity)
+		list[name] = value
+	}
+}
+
+// runBudgetSync writes the usage of the virtual node budgets to their status.
+func (m *Manager) runBudgetSync(ctx context.Context) {
+	wait.UntilWithContext(ctx, m.syncBudgets, budgetSyncPeriod)
+}
+
+func (m *Manager) syncBudgets(ctx context.Context) {
+	budgets, err := m.resourceManager.ListVirtualNodeBudgets()
+	if err != nil {
+		klog.Errorf("failed to list virtual node budgets: %q", err)
+		return
+	}
+	metrics.VirtualNodeBudgetUsed.Reset()
+	if len(budgets) == 0 {
+		return
+	}
+	usage := m.budgetUsage.used(time.Now())
+	for _, budget := range budgets {
+		used := budgetUsed(budget.Spec.Limits, usage.of(budget))
+		for name, quantity := range used {
+			metrics.VirtualNodeBudgetUsed.WithLabelValues(budget.Name, string(name)).Set(quantity.AsApproximateFloat64())
+		}
+		exhausted := isBudgetExhausted(budget.Spec.Limits, used)
+		if apiequality.Semantic.DeepEqual(budget.Status.Used, used) && budget.Status.Exhausted == exhausted {
+			continue
+		}
+		if exhausted && !budget.Status.Exhausted {
+			klog.Warningf("virtual node budget %s is exhausted, used %s of %s", budget.Name, formatResources(budget.Spec.Limits, used), formatResources(budget.Spec.Limits, budget.Spec.Limits))
+		}
+		now := metav1.Now()
+		updated := budget.DeepCopy()
+		updated.Status.Used = used
+		updated.Status.Exhausted = exhausted
+		updated.Status.LastUpdateTime = &now
+		if _, err := m.profileClient.EciV1().VirtualNodeBudgets().UpdateStatus(ctx, updated, metav1.UpdateOptions{}); err != nil {
+			// retried by the next sync
+			klog.Warningf("failed to update status of virtual node budget %s: %v", budget.Name, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package profile
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/policy"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newResourceList(cpu, memory string) v1.ResourceList {
+	return v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse(cpu),
+		v1.ResourceMemory: resource.MustParse(memory),
+	}
+}
+
+func TestFitsBudget(t *testing.T) {
+	limits := newResourceList("10", "20Gi")
+	for desc, test := range map[string]struct {
+		used     v1.ResourceList
+		requests v1.ResourceList
+		expect   bool
+	}{
+		"test nothing used": {
+			requests: newResourceList("2", "4Gi"),
+			expect:   true,
+		},
+		"test fits exactly": {
+			used:     newResourceList("8", "16Gi"),
+			requests: newResourceList("2", "4Gi"),
+			expect:   true,
+		},
+		"test cpu exceeded": {
+			used:     newResourceList("9", "4Gi"),
+			requests: newResourceList("2", "4Gi"),
+			expect:   false,
+		},
+		"test exhausted": {
+			used:   newResourceList("10", "4Gi"),
+			expect: false,
+		},
+		"test unlimited resource": {
+			used:     v1.ResourceList{"nvidia.com/gpu": resource.MustParse("8")},
+			requests: v1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")},
+			expect:   true,
+		},
+	} {
+		if actual := fitsBudget(limits, test.used, test.requests); actual != test.expect {
+			t.Errorf("[%s] expect %v, but got %v", desc, test.expect, actual)
+		}
+	}
+	if isBudgetExhausted(limits, newResourceList("8", "16Gi")) {
+		t.Errorf("expect the budget not exhausted")
+	}
+	if !isBudgetExhausted(limits, newResourceList("8", "20Gi")) {
+		t.Errorf("expect the budget exhausted once the memory reaches its limit")
+	}
+}
+
+func TestVirtualNodeUsage(t *testing.T) {
+	usage := &virtualNodeUsage{cluster: v1.ResourceList{}, namespaces: map[string]v1.ResourceList{}}
+	addResources(usage.cluster, newResourceList("1", "2Gi"))
+	addResources(usage.cluster, newResourceList("500m", "1Gi"))
+	usage.namespaces["default"] = newResourceList("1", "2Gi")
+
+	cluster := &eciv1.VirtualNodeBudget{Spec: eciv1.VirtualNodeBudgetSpec{Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}}}
+	used := budgetUsed(cluster.Spec.Limits, usage.of(cluster))
+	if actual := formatResources(cluster.Spec.Limits, used); actual != "cpu=1500m" {
+		t.Errorf("expect cluster usage cpu=1500m, but got %s", actual)
+	}
+	namespaced := &eciv1.VirtualNodeBudget{Spec: eciv1.VirtualNodeBudgetSpec{Namespace: "kube-system", Limits: newResourceList("4", "8Gi")}}
+	used = budgetUsed(namespaced.Spec.Limits, usage.of(namespaced))
+	if actual := formatResources(namespaced.Spec.Limits, used); actual != "cpu=0,memory=0" {
+		t.Errorf("expect no usage of namespace kube-system, but got %s", actual)
+	}
+}
+
+func TestReserveBudget(t *testing.T) {
+	budget := &eciv1.VirtualNodeBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+		Spec:       eciv1.VirtualNodeBudgetSpec{Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}},
+	}
+	selector := newTestSelector("vnode-only", eciv1.SelectorSpec{
+		ObjectLabels: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		Policy:       &eciv1.PolicySource{VirtualNodeOnly: &eciv1.VirtualNodeOnlyPolicySource{}},
+	})
+	m := newTestManager(t, []runtime.Object{newVirtualNode("virtual-node-1")}, []runtime.Object{budget, selector})
+	newPod := func(app string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: app + "-", Namespace: "default", Labels: map[string]string{"app": app}},
+			Spec: v1.PodSpec{Containers: []v1.Container{{
+				Name:      "main",
+				Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}},
+			}}},
+		}
+	}
+	usedCPU := func() string {
+		return formatResources(budget.Spec.Limits, m.budgetUsage.used(time.Now()).cluster)
+	}
+	running := newPod("running")
+	running.Name, running.UID, running.Spec.NodeName = "running", "running", "virtual-node-1"
+	m.budgetUsage.account(running, m.isVirtualNodePod(running))
+	if used := usedCPU(); used != "cpu=1" {
+		t.Fatalf("expect the running pod accounted, but got %s", used)
+	}
+
+	// a dry run doesn't keep the reservation
+	if _, _, err := m.onPodCreating(newPod("web"), "", true); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if used := usedCPU(); used != "cpu=1" {
+		t.Errorf("expect nothing reserved by a dry run, but got %s", used)
+	}
+
+	// two admissions race for the last cpu of the budget
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	denied := 0
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := m.onPodCreating(newPod("web"), "", false)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				denied++
+			}
+		}()
+	}
+	wg.Wait()
+	if denied != 1 {
+		t.Errorf("expect one of the racing admissions denied, but got %d", denied)
+	}
+	if used := usedCPU(); used != "cpu=2" {
+		t.Errorf("expect the admitted pod reserved, but got %s", used)
+	}
+
+	// the reservation is released once the informer accounts the pod
+	created := newPod("web")
+	created.Name, created.UID = "web-abcde", "web-abcde"
+	created.Spec.Tolerations, _ = policy.ParseTolerations(policy.DefaultVirtualNodeTolerations)
+	m.budgetUsage.account(created, m.isVirtualNodePod(created))
+	if used := usedCPU(); used != "cpu=2" {
+		t.Errorf("expect the created pod replaces its reservation, but got %s", used)
+	}
+
+	// the pod bound to a virtual node at creation is checked too
+	bound := newPod("bound")
+	bound.Spec.NodeName = "virtual-node-1"
+	if _, _, err := m.onPodCreating(bound, bound.Spec.NodeName, false); err == nil {
+		t.Errorf("expect the pod bound to an exhausted virtual node denied")
+	}
+
+	// the deleted pod frees its requests
+	m.budgetUsage.account(running, false)
+	if used := usedCPU(); used != "cpu=1" {
+		t.Errorf("expect the deleted pod not accounted, but got %s", used)
+	}
+
+	// the reservation of the pod never created expires
+	m.budgetUsage.reserve(newPod("web"), []*eciv1.VirtualNodeBudget{budget}, time.Now().Add(-2*budgetReservationTTL))
+	if used := usedCPU(); used != "cpu=1" {
+		t.Errorf("expect the expired reservation released, but got %s", used)
+	}
+}
@@ -0,0 +1,55 @@
+package profile
+
+import (
+	"fmt"
+	"sync"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// EventReasonPlacementConflict is recorded on the unscheduled pods whose node
+// selector or node affinity excludes the virtual nodes their selector requires.
+const EventReasonPlacementConflict = "VirtualNodePlacementConflict"
+
+// conflictRecorder remembers the pods whose placement conflicts have been
+// reported, so that a pod updated repeatedly is reported only once per
+// generation of the selector.
+type conflictRecorder struct {
+	lock     sync.Mutex
+	reported map[types.UID]string
+}
+
+func newConflictRecorder() *conflictRecorder {
+	return &conflictRecorder{reported: map[types.UID]string{}}
+}
+
+// record returns false when the conflict of the pod with the selector has been reported.
+func (r *conflictRecorder) record(selector *eciv1.Selector, pod *v1.Pod) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	key := fmt.Sprintf("%s/%d", selector.UID, selector.Generation)
+	if r.reported[pod.UID] == key {
+		return false
+	}
+	r.reported[pod.UID] = key
+	return true
+}
+
+func (r *conflictRecorder) forgetPod(uid types.UID) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.reported, uid)
+}
+
+// reportPlacementConflict records a Warning event on the pod which can't be
+// scheduled to virtual nodes as the selector requires, the pod is left as is.
+func (m *Manager) reportPlacementConflict(selector *eciv1.Selector, pod *v1.Pod, err error) {
+	if !m.conflicts.record(selector, pod) {
+		return
+	}
+	klog.Warningf("pod %s/%s can't be scheduled to virtual nodes (matched: %s): %v", pod.Namespace, pod.Name, selector.Name, err)
+	m.eventRecorder.Event(pod, v1.EventTypeWarning, EventReasonPlacementConflict, fmt.Sprintf("selector %s: %v", selector.Name, err))
+}
@@ -0,0 +1,218 @@
+package profile
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"eci.io/eci-profile/pkg/utils"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DeletionCostRankingPrice deletes the most expensive pods on virtual nodes first
+	DeletionCostRankingPrice = "price"
+	// DeletionCostRankingAge deletes the newest pods on virtual nodes first
+	DeletionCostRankingAge = "age"
+
+	deletionCostWorkers    = 2
+	maxDeletionCostRetries = 5
+
+	// cpuPriceWeight is roughly the ratio of the price of one vCPU to one GiB
+	// of memory per second of ECI, used to estimate the price of the pods
+	cpuPriceWeight = 8
+
+	// normalNodeDeletionCost is the lowest cost of the pods on normal nodes,
+	// which are deleted after the pods on virtual nodes and the pending pods
+	normalNodeDeletionCost = 1
+)
+
+func newDeletionCostQueue() workqueue.RateLimitingInterface {
+	return workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "deletion-cost")
+}
+
+// enqueueDeletionCost queues the ReplicaSet of the pod, the key is the
+// namespace and the UID of the ReplicaSet.
+func (m *Manager) enqueueDeletionCost(pod *v1.Pod) {
+	if m.deletionCostRanking == "" {
+		return
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "ReplicaSet" {
+		return
+	}
+	m.deletionCostQueue.Add(pod.Namespace + "/" + string(owner.UID))
+}
+
+// isPlacementChanged reports whether the pod is bound, deleted or terminated.
+func isPlacementChanged(oldPod, newPod *v1.Pod) bool {
+	return oldPod.Spec.NodeName != newPod.Spec.NodeName ||
+		(oldPod.DeletionTimestamp == nil) != (newPod.DeletionTimestamp == nil) ||
+		oldPod.Status.Phase != newPod.Status.Phase
+}
+
+func (m *Manager) runDeletionCostWorkers(ctx context.Context) {
+	if m.deletionCostRanking == "" {
+		klog.Info("deletion cost management is disabled")
+		return
+	}
+	for i := 0; i < deletionCostWorkers; i++ {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			for m.processNextDeletionCost(ctx) {
+			}
+		}, time.Second)
+	}
+	<-ctx.Done()
+	m.deletionCostQueue.ShutDown()
+}
+
+func (m *Manager) processNextDeletionCost(ctx context.Context) bool {
+	key, quit := m.deletionCostQueue.Get()
+	if quit {
+		return false
+	}
+	defer m.deletionCostQueue.Done(key)
+
+	err := m.syncDeletionCost(ctx, key.(string))
+	if err == nil {
+		m.deletionCostQueue.Forget(key)
+		return true
+	}
+	if m.deletionCostQueue.NumRequeues(key) < maxDeletionCostRetries {
+		klog.Warningf("failed to sync deletion cost of pods of ReplicaSet %s, retry it: %q", key, err)
+		m.deletionCostQueue.AddRateLimited(key)
+		return true
+	}
+	klog.Errorf("failed to sync deletion cost of pods of ReplicaSet %s, drop it: %q", key, err)
+	m.deletionCostQueue.Forget(key)
+	return true
+}
+
+// syncDeletionCost ranks the pods of a ReplicaSet having pods on virtual
+// nodes, so that its scale-down removes the pods on virtual nodes first.
+func (m *Manager) syncDeletionCost(ctx context.Context, key string) error {
+	index := strings.Index(key, "/")
+	if index < 0 {
+		return errors.Errorf("invalid key %s", key)
+	}
+	namespace, uid := key[:index], types.UID(key[index+1:])
+	pods, err := m.resourceManager.ListPods(namespace)
+	if err != nil {
+		return errors.Wrap(err, "failed to list pods")
+	}
+	var virtualPods, normalPods []*v1.Pod
+	for _, pod := range pods {
+		owner := metav1.GetControllerOf(pod)
+		if owner == nil || owner.UID != uid || pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil ||
+			pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if m.hasStaticDeletionCost(pod) {
+			continue
+		}
+		node, err := m.resourceManager.GetNode(pod.Spec.NodeName)
+		if err != nil {
+			if api_errors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrap(err, "failed to get node")
+		}
+		if m.policyManager.IsVirtualNode(node) {
+			virtualPods = append(virtualPods, pod)
+		} else {
+			normalPods = append(normalPods, pod)
+		}
+	}
+	if len(virtualPods) == 0 {
+		return nil
+	}
+	costs := rankDeletionCosts(virtualPods, m.deletionCostRanking)
+	for _, pod := range normalPods {
+		// the pods on normal nodes cost more than any pod on virtual nodes
+		if cost, ok := podDeletionCost(pod); !ok || cost < normalNodeDeletionCost {
+			costs[pod] = normalNodeDeletionCost
+		}
+	}
+	for pod, cost := range costs {
+		value := strconv.Itoa(cost)
+		if pod.Annotations[v1.PodDeletionCost] == value {
+			continue
+		}
+		patchOptions := utils.NewPatchOption().WithAnnotation(v1.PodDeletionCost, value)
+		if _, err := utils.PatchPod(ctx, m.k8sClient, pod.Namespace, pod.Name, *patchOptions); err != nil {
+			if api_errors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrapf(err, "failed to patch deletion cost of pod %s", pod.Name)
+		}
+		klog.V(3).Infof("the deletion cost of pod %s/%s is set to %s", pod.Namespace, pod.Name, value)
+	}
+	return nil
+}
+
+// hasStaticDeletionCost reports whether the deletion cost of the pod is set by
+// the effect of the selector which mutated it, it's left as is.
+func (m *Manager) hasStaticDeletionCost(pod *v1.Pod) bool {
+	selector, err := m.tracedSelector(pod)
+	if err != nil {
+		klog.V(3).Infof("failed to find the selector of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		return false
+	}
+	if selector == nil || selector.Spec.Effect == nil {
+		return false
+	}
+	_, ok := selector.Spec.Effect.Annotations[v1.PodDeletionCost]
+	return ok
+}
+
+// rankDeletionCosts assigns negative costs to the pods on virtual nodes, the
+// pod to delete first gets the lowest cost.
+func rankDeletionCosts(pods []*v1.Pod, ranking string) map[*v1.Pod]int {
+	sorted := append([]*v1.Pod{}, pods...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if ranking == DeletionCostRankingPrice {
+			if pi, pj := estimatePrice(sorted[i]), estimatePrice(sorted[j]); pi != pj {
+				return pi > pj
+			}
+		}
+		ti, tj := sorted[i].CreationTimestamp, sorted[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return tj.Before(&ti)
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	costs := make(map[*v1.Pod]int, len(sorted))
+	for i, pod := range sorted {
+		costs[pod] = i - len(sorted)
+	}
+	return costs
+}
+
+// estimatePrice estimates the relative price of the pod on ECI by its requests.
+func estimatePrice(pod *v1.Pod) float64 {
+	requests := utils.PodRequests(pod)
+	cpu := requests[v1.ResourceCPU]
+	memory := requests[v1.ResourceMemory]
+	return float64(cpu.MilliValue())/1000*cpuPriceWeight + float64(memory.Value())/(1<<30)
+}
+
+func podDeletionCost(pod *v1.Pod) (int, bool) {
+	value, ok := pod.Annotations[v1.PodDeletionCost]
+	if !ok {
+		return 0, false
+	}
+	cost, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return cost, true
+}
@@ -0,0 +1,112 @@
+package profile
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/policy"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newDeletionCostPod(name, cpu, memory string, created time.Time) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse(cpu),
+				v1.ResourceMemory: resource.MustParse(memory),
+			}}}},
+		},
+	}
+}
+
+func TestRankDeletionCosts(t *testing.T) {
+	now := time.Now()
+	small := newDeletionCostPod("small", "1", "2Gi", now)
+	large := newDeletionCostPod("large", "4", "8Gi", now.Add(-time.Hour))
+	medium := newDeletionCostPod("medium", "2", "4Gi", now.Add(-2*time.Hour))
+	pods := []*v1.Pod{small, large, medium}
+
+	for ranking, expect := range map[string]map[string]int{
+		DeletionCostRankingPrice: {"large": -3, "medium": -2, "small": -1},
+		DeletionCostRankingAge:   {"small": -3, "large": -2, "medium": -1},
+	} {
+		costs := rankDeletionCosts(pods, ranking)
+		for _, pod := range pods {
+			if costs[pod] != expect[pod.Name] {
+				t.Errorf("%s: expect cost %d of pod %s, but got %d", ranking, expect[pod.Name], pod.Name, costs[pod])
+			}
+		}
+	}
+}
+
+func TestIsPlacementChanged(t *testing.T) {
+	pod := &v1.Pod{Status: v1.PodStatus{Phase: v1.PodPending}}
+	bound := pod.DeepCopy()
+	bound.Spec.NodeName = "node-1"
+	if !isPlacementChanged(pod, bound) {
+		t.Errorf("expect the binding changes the placement")
+	}
+	annotated := bound.DeepCopy()
+	annotated.Annotations = map[string]string{v1.PodDeletionCost: "-1"}
+	if isPlacementChanged(bound, annotated) {
+		t.Errorf("expect the annotation doesn't change the placement")
+	}
+}
+
+func TestSyncDeletionCost(t *testing.T) {
+	isController := true
+	now := time.Now()
+	static := newTestSelector("static", eciv1.SelectorSpec{
+		Effect: &eciv1.SideEffect{Annotations: map[string]string{v1.PodDeletionCost: "-1000"}},
+	})
+	newPod := func(name, nodeName, cost string, created time.Time) *v1.Pod {
+		pod := newDeletionCostPod(name, "1", "1Gi", created)
+		pod.Namespace = "default"
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "nginx", UID: "rs", Controller: &isController}}
+		pod.Spec.NodeName = nodeName
+		pod.Status.Phase = v1.PodRunning
+		if cost != "" {
+			pod.Annotations = map[string]string{v1.PodDeletionCost: cost}
+		}
+		return pod
+	}
+	staticPod := newPod("static", "vnode", "-1000", now)
+	staticPod.Annotations[eciv1.AnnotationTrace] = (&policy.Trace{Selector: static.Name, UID: static.UID}).String()
+	m := newTestManager(t, []runtime.Object{
+		newVirtualNode("vnode"),
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}},
+		newPod("virtual-old", "vnode", "", now.Add(-time.Hour)),
+		newPod("virtual-new", "vnode", "", now),
+		newPod("normal", "node", "", now),
+		newPod("normal-negative", "node", "-3", now),
+		newPod("normal-positive", "node", "5", now),
+		staticPod,
+	}, []runtime.Object{static})
+	m.deletionCostRanking = DeletionCostRankingAge
+
+	if err := m.syncDeletionCost(context.TODO(), "default/rs"); err != nil {
+		t.Fatalf("failed to sync deletion cost: %v", err)
+	}
+	for name, expect := range map[string]string{
+		"virtual-old":     "-1",
+		"virtual-new":     "-2",
+		"normal":          "1",
+		"normal-negative": "1",
+		"normal-positive": "5",
+		"static":          "-1000",
+	} {
+		pod, err := m.k8sClient.CoreV1().Pods("default").Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get pod %s: %v", name, err)
+		}
+		if actual := pod.Annotations[v1.PodDeletionCost]; actual != expect {
+			t.Errorf("[%s] expect deletion cost %s, but got %s", name, expect, actual)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package profile
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/metrics"
+	"eci.io/eci-profile/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// driftRecorder keeps the results of the reconciliations until they are
+// written to the selector status.
+type driftRecorder struct {
+	lock    sync.Mutex
+	results map[types.UID]*eciv1.DriftStatus
+}
+
+func newDriftRecorder() *driftRecorder {
+	return &driftRecorder{results: map[types.UID]*eciv1.DriftStatus{}}
+}
+
+func (r *driftRecorder) record(uid types.UID, drifted int32, reconciled int64, now time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	t := metav1.NewTime(now)
+	result := &eciv1.DriftStatus{DriftedPods: drifted, ReconciledPods: reconciled, LastReconcileTime: &t}
+	if last, ok := r.results[uid]; ok {
+		result.ReconciledPods += last.ReconciledPods
+	}
+	r.results[uid] = result
+}
+
+// take removes the result of the selector.
+func (r *driftRecorder) take(uid types.UID) *eciv1.DriftStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result := r.results[uid]
+	delete(r.results, uid)
+	return result
+}
+
+// restore gives back a result which failed to be written, a newer result
+// replaces it but keeps counting the reconciled pods.
+func (r *driftRecorder) restore(uid types.UID, result *eciv1.DriftStatus) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if current, ok := r.results[uid]; ok {
+		current.ReconciledPods += result.ReconciledPods
+		return
+	}
+	r.results[uid] = result
+}
+
+// mergeDriftStatus adds the result of the reconciliation to the status of the selector.
+func mergeDriftStatus(status *eciv1.DriftStatus, result *eciv1.DriftStatus) *eciv1.DriftStatus {
+	merged := result.DeepCopy()
+	if status != nil {
+		merged.ReconciledPods += status.ReconciledPods
+	}
+	return merged
+}
+
+// runDriftStatusSync periodically writes the results of the drift
+// reconciliation to the selector status.
+func (m *Manager) runDriftStatusSync(ctx context.Context) {
+	if m.driftReconcilePeriod <= 0 {
+		return
+	}
+	wait.UntilWithContext(ctx, m.syncDriftStatus, statusSyncPeriod)
+}
+
+func (m *Manager) syncDriftStatus(ctx context.Context) {
+	selectors, err := m.resourceManager.ListSelectors()
+	if err != nil {
+		klog.Errorf("failed to list selectors: %q", err)
+		return
+	}
+	for _, selector := range selectors {
+		result := m.drifts.take(selector.UID)
+		if result == nil {
+			continue
+		}
+		if err := m.updateSelectorStatus(ctx, selector, func(status *eciv1.SelectorStatus) {
+			status.Drift = mergeDriftStatus(status.Drift, result)
+		}); err != nil {
+			// retried by the next sync
+			klog.Warningf("failed to update drift status of selector %s: %v", selector.Name, err)
+			m.drifts.restore(selector.UID, result)
+		}
+	}
+}
+
+// runDriftReconcile periodically patches the effect annotations and labels
+// missing in the running pods on virtual nodes, for the selectors opting in.
+func (m *Manager) runDriftReconcile(ctx context.Context) {
+	if m.driftReconcilePeriod <= 0 {
+		klog.Info("drift reconciliation is disabled")
+		return
+	}
+	wait.UntilWithContext(ctx, m.reconcileDrift, m.driftReconcilePeriod)
+}
+
+func (m *Manager) reconcileDrift(ctx context.Context) {
+	selectors, err := m.resourceManager.ListSelectors()
+	if err != nil {
+		klog.Errorf("failed to list selectors: %q", err)
+		return
+	}
+	reconciling := map[types.UID]*eciv1.Selector{}
+	for _, selector := range selectors {
+		if selector.Spec.ReconcileDrift && !isAuditMode(selector) {
+			reconciling[selector.UID] = selector
+		}
+	}
+	if len(reconciling) == 0 {
+		return
+	}
+	pods, err := m.resourceManager.ListPods("")
+	if err != nil {
+		klog.Errorf("failed to list pods: %q", err)
+		return
+	}
+	drifted := map[types.UID]int32{}
+	reconciled := map[types.UID]int64{}
+	for _, pod := range pods {
+		if !m.isRunningOnVirtualNode(pod) {
+			continue
+		}
+		selector, _, err := m.matchSelectorForPod(pod)
+		if err != nil {
+			klog.Errorf("failed to match selector for pod %s/%s: %q", pod.Namespace, pod.Name, err)
+			continue
+		}
+		if selector == nil || reconciling[selector.UID] == nil {
+			continue
+		}
+		rendered, errs := m.renderEffect(selector, pod)
+		for _, err := range errs {
+			klog.V(3).Infof("failed to render effect of selector %s for pod %s/%s: %v", selector.Name, pod.Namespace, pod.Name, err)
+		}
+		patchOptions := m.policyManager.OnPodDrifted(rendered, pod)
+		if patchOptions == nil {
+			continue
+		}
+		drifted[selector.UID]++
+		if err := m.driftLimiter.Wait(ctx); err != nil {
+			// the context is done
+			return
+		}
+		if _, err := utils.PatchPod(ctx, m.k8sClient, pod.Namespace, pod.Name, *patchOptions); err != nil {
+			if !api_errors.IsNotFound(err) {
+				klog.Errorf("failed to patch the drifted pod %s/%s(%s): %q", pod.Namespace, pod.Name, pod.UID, err)
+			}
+			continue
+		}
+		reconciled[selector.UID]++
+		klog.Infof("the drifted pod %s/%s is patched (matched: %s)", pod.Namespace, pod.Name, selector.Name)
+	}
+	now := time.Now()
+	for uid, selector := range reconciling {
+		m.drifts.record(uid, drifted[uid], reconciled[uid], now)
+		metrics.DriftedPods.WithLabelValues(selector.Name).Set(float64(drifted[uid]))
+		metrics.ReconciledPods.WithLabelValues(selector.Name).Add(float64(reconciled[uid]))
+	}
+}
+
+func (m *Manager) isRunningOnVirtualNode(pod *v1.Pod) bool {
+	if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil || pod.Status.Phase != v1.PodRunning {
+		return false
+	}
+	node, err := m.resourceManager.GetNode(pod.Spec.NodeName)
+	if err != nil {
+		klog.V(3).Infof("failed to get node %s of pod %s/%s: %v", pod.Spec.NodeName, pod.Namespace, pod.Name, err)
+		return false
+	}
+	return m.policyManager.IsVirtualNode(node)
+}
@@ -0,0 +1,96 @@
+package profile
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/policy"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newVirtualNode returns a virtual node identified by the default selector.
+func newVirtualNode(name string) *v1.Node {
+	labels, _ := policy.ParseNodeSelector(policy.DefaultVirtualNodeSelector)
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func TestDriftRecorder(t *testing.T) {
+	recorder := newDriftRecorder()
+	now := time.Now()
+
+	recorder.record("selector-uid", 3, 2, now)
+	recorder.record("selector-uid", 1, 1, now.Add(time.Minute))
+	result := recorder.take("selector-uid")
+	if result == nil || result.DriftedPods != 1 || result.ReconciledPods != 3 || !result.LastReconcileTime.Time.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expect the last drifted pods and all the reconciled pods, but got %v", result)
+	}
+	if recorder.take("selector-uid") != nil {
+		t.Errorf("expect the result taken only once")
+	}
+
+	merged := mergeDriftStatus(&eciv1.DriftStatus{DriftedPods: 5, ReconciledPods: 10}, result)
+	if merged.DriftedPods != 1 || merged.ReconciledPods != 13 {
+		t.Errorf("unexpected merged drift: %v", merged)
+	}
+
+	// a failed status update gives the result back, a newer result replaces it
+	recorder.restore("selector-uid", result)
+	recorder.record("selector-uid", 0, 0, now.Add(2*time.Minute))
+	if restored := recorder.take("selector-uid"); restored.DriftedPods != 0 || restored.ReconciledPods != 3 {
+		t.Errorf("unexpected restored drift: %v", restored)
+	}
+}
+
+func TestReconcileDrift(t *testing.T) {
+	newDriftSelector := func(app string, driftPolicy eciv1.DriftPolicy) *eciv1.Selector {
+		return newTestSelector(app, eciv1.SelectorSpec{
+			ObjectLabels:   &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+			Effect:         &eciv1.SideEffect{Labels: map[string]string{"team": "a", "cost": "cc-1"}},
+			ReconcileDrift: true,
+			DriftPolicy:    driftPolicy,
+		})
+	}
+	newDriftPod := func(name, app, nodeName string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: "uid-" + types.UID(name), Labels: map[string]string{"app": app, "team": "b"}},
+			Spec:       v1.PodSpec{NodeName: nodeName},
+			Status:     v1.PodStatus{Phase: v1.PodRunning},
+		}
+	}
+	addMissing := newDriftSelector("add-missing", "")
+	enforce := newDriftSelector("enforce", eciv1.DriftPolicyEnforce)
+	m := newTestManager(t, []runtime.Object{
+		newVirtualNode("vnode"),
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}},
+		newDriftPod("add-missing", "add-missing", "vnode"),
+		newDriftPod("enforce", "enforce", "vnode"),
+		newDriftPod("normal", "enforce", "node"),
+	}, []runtime.Object{addMissing, enforce})
+
+	m.reconcileDrift(context.TODO())
+
+	for name, expect := range map[string]map[string]string{
+		"add-missing": {"app": "add-missing", "team": "b", "cost": "cc-1"},
+		"enforce":     {"app": "enforce", "team": "a", "cost": "cc-1"},
+		"normal":      {"app": "enforce", "team": "b"},
+	} {
+		pod, err := m.k8sClient.CoreV1().Pods("default").Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get pod %s: %v", name, err)
+		}
+		if !reflect.DeepEqual(pod.Labels, expect) {
+			t.Errorf("[%s] expect labels %v, but got %v", name, expect, pod.Labels)
+		}
+	}
+	for _, selector := range []*eciv1.Selector{addMissing, enforce} {
+		if result := m.drifts.take(selector.UID); result == nil || result.DriftedPods != 1 || result.ReconciledPods != 1 {
+			t.Errorf("[%s] expect 1 drifted and reconciled pod, but got %v", selector.Name, result)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package profile
+
+import (
+	profilescheme "eci.io/eci-profile/pkg/client/clientset/versioned/scheme"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	kubescheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	eventComponent = "eci-profile"
+
+	// EventReasonEffectRenderFailed is recorded when an effect value fails to
+	// render and the key is skipped.
+	EventReasonEffectRenderFailed = "EffectRenderFailed"
+
+	// EventReasonSelectorInvalid is recorded on the invalid selectors, which
+	// are ignored when matching pods.
+	EventReasonSelectorInvalid = "SelectorInvalid"
+)
+
+func newEventRecorder(k8sClient kubernetes.Interface) record.EventRecorder {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(kubescheme.AddToScheme(scheme))
+	utilruntime.Must(profilescheme.AddToScheme(scheme))
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8sClient.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme, v1.EventSource{Component: eventComponent})
+}
@@ -0,0 +1,78 @@
+package profile
+
+import (
+	"context"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+)
+
+// evictionVersion caches the version of the Eviction API served by the
+// cluster, policy/v1 is only served since Kubernetes 1.22.
+type evictionVersion struct {
+	discovery discovery.DiscoveryInterface
+	lock      sync.Mutex
+	version   string
+}
+
+func newEvictionVersion(discovery discovery.DiscoveryInterface) *evictionVersion {
+	return &evictionVersion{discovery: discovery}
+}
+
+// get returns the served version, policy/v1 is assumed until the discovery
+// succeeds.
+func (e *evictionVersion) get() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.version != "" {
+		return e.version
+	}
+	resources, err := e.discovery.ServerResourcesForGroupVersion("v1")
+	if err != nil {
+		klog.Warningf("failed to discover the version of the Eviction API: %v", err)
+		return policyv1.SchemeGroupVersion.Version
+	}
+	e.version = policyv1.SchemeGroupVersion.Version
+	for _, resource := range resources.APIResources {
+		if resource.Name == "pods/eviction" && resource.Version != "" {
+			e.version = resource.Version
+		}
+	}
+	return e.version
+}
+
+// evictPod evicts the pod through the Eviction API, which refuses the
+// evictions violating the PodDisruptionBudgets with TooManyRequests. The UID
+// precondition keeps a pod recreated with the same name from being evicted.
+func (m *Manager) evictPod(ctx context.Context, pod *v1.Pod) error {
+	objectMeta := metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}
+	deleteOptions := &metav1.DeleteOptions{Preconditions: metav1.NewUIDPreconditions(string(pod.UID))}
+	if m.evictions.get() == policyv1beta1.SchemeGroupVersion.Version {
+		return m.k8sClient.PolicyV1beta1().Evictions(pod.Namespace).Evict(ctx, &policyv1beta1.Eviction{ObjectMeta: objectMeta, DeleteOptions: deleteOptions})
+	}
+	return m.k8sClient.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{ObjectMeta: objectMeta, DeleteOptions: deleteOptions})
+}
+
+// isPodNotFound reports whether the error is about the missing pod, or the
+// pod replaced by another one of the same name which fails the UID
+// precondition, rather than e.g. the Eviction API not served.
+func isPodNotFound(err error, pod *v1.Pod) bool {
+	if api_errors.IsConflict(err) {
+		return true
+	}
+	if !api_errors.IsNotFound(err) {
+		return false
+	}
+	status, ok := err.(api_errors.APIStatus)
+	if !ok {
+		return false
+	}
+	details := status.Status().Details
+	return details != nil && details.Kind == "pods" && details.Name == pod.Name
+}
@@ -0,0 +1,38 @@
+package profile
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestEvictPodPreconditions(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default", UID: "uid-web-0"}}
+	for _, version := range []string{policyv1.SchemeGroupVersion.Version, policyv1beta1.SchemeGroupVersion.Version} {
+		client := fake.NewSimpleClientset()
+		var options *metav1.DeleteOptions
+		client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			switch eviction := action.(k8stesting.CreateAction).GetObject().(type) {
+			case *policyv1.Eviction:
+				options = eviction.DeleteOptions
+			case *policyv1beta1.Eviction:
+				options = eviction.DeleteOptions
+			}
+			return true, nil, nil
+		})
+		m := &Manager{k8sClient: client, evictions: &evictionVersion{version: version}}
+		if err := m.evictPod(context.TODO(), pod); err != nil {
+			t.Fatalf("[%s] failed to evict the pod: %v", version, err)
+		}
+		if options == nil || options.Preconditions == nil || options.Preconditions.UID == nil || *options.Preconditions.UID != pod.UID {
+			t.Errorf("[%s] expect the eviction preconditioned on UID %s, but got %v", version, pod.UID, options)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/metrics"
+	"eci.io/eci-profile/pkg/utils"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultFailurePatterns are the reason and the error codes the ECI
+	// provider reports for the pods it failed to create for lack of stock or
+	// quota, e.g. RecommendEmpty.InstanceTypeNoStock or QuotaExceed.ECI.
+	// The errors of the pod spec aren't matched, the replacement fails anyway.
+	DefaultFailurePatterns = "ProviderFailed,NoStock,QuotaExceed"
+
+	// EventReasonFallback is recorded on the pods failed on ECI, which are
+	// deleted so that their replacements avoid virtual nodes.
+	EventReasonFallback = "FallbackToNormalNode"
+
+	fallbackWorkers    = 2
+	maxFallbackRetries = 5
+
+	// fallbackConfigMapNamespace and fallbackConfigMapName locate the ConfigMap
+	// which persists when the controllers may run on virtual nodes again, keyed
+	// by their UIDs, so that the cooldown outlives a restart.
+	fallbackConfigMapNamespace = "kube-system"
+	fallbackConfigMapName      = "eci-profile-fallback"
+)
+
+// ParseFailurePatterns parses a comma separated list of regular expressions,
+// which match case-insensitively.
+func ParseFailurePatterns(s string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pattern, err := regexp.Compile("(?i)" + item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid failure pattern %q", item)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// fallbackCache remembers the controllers whose pods avoid virtual nodes.
+type fallbackCache struct {
+	lock   sync.Mutex
+	owners map[types.UID]time.Time
+}
+
+func newFallbackCache() *fallbackCache {
+	return &fallbackCache{owners: map[types.UID]time.Time{}}
+}
+
+func (c *fallbackCache) avoid(owner types.UID, until time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.owners[owner] = until
+}
+
+func (c *fallbackCache) avoidUntil(owner types.UID, now time.Time) (time.Time, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	until, ok := c.owners[owner]
+	if !ok {
+		return time.Time{}, false
+	}
+	if !now.Before(until) {
+		delete(c.owners, owner)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// avoidVirtualNodeUntil returns when the pod may run on virtual nodes again,
+// after the pod of the same controller failed on ECI.
+func (m *Manager) avoidVirtualNodeUntil(pod *v1.Pod, now time.Time) (time.Time, bool) {
+	if value := pod.Annotations[eciv1.AnnotationAvoidVirtualNode]; value != "" {
+		if until, err := time.Parse(time.RFC3339, value); err == nil && now.Before(until) {
+			return until, true
+		}
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		return m.fallbacks.avoidUntil(owner.UID, now)
+	}
+	return time.Time{}, false
+}
+
+// matchFailure returns the reason or message of the pod status, or of its
+// warning events, matching any of the patterns.
+func matchFailure(patterns []*regexp.Regexp, pod *v1.Pod, events []v1.Event) string {
+	texts := []string{pod.Status.Reason, pod.Status.Message}
+	for _, event := range events {
+		if event.Type == v1.EventTypeWarning {
+			texts = append(texts, event.Reason, event.Message)
+		}
+	}
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		for _, pattern := range patterns {
+			if pattern.MatchString(text) {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// loadFallbacks restores the controllers avoiding virtual nodes persisted in
+// the ConfigMap before a restart.
+func (m *Manager) loadFallbacks(ctx context.Context) error {
+	if m.fallbackCooldown <= 0 {
+		return nil
+	}
+	configMap, err := m.k8sClient.CoreV1().ConfigMaps(fallbackConfigMapNamespace).Get(ctx, fallbackConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if api_errors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to get fallback configmap")
+	}
+	now := time.Now()
+	for owner, value := range configMap.Data {
+		until, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			klog.Warningf("invalid fallback of controller %s in configmap %s/%s: %q", owner, fallbackConfigMapNamespace, fallbackConfigMapName, value)
+			continue
+		}
+		if now.Before(until) {
+			m.fallbacks.avoid(types.UID(owner), until)
+		}
+	}
+	return nil
+}
+
+// persistFallback records in the ConfigMap until when the controller avoids
+// virtual nodes, and drops the expired records.
+func (m *Manager) persistFallback(ctx context.Context, owner types.UID, until time.Time) error {
+	configMaps := m.k8sClient.CoreV1().ConfigMaps(fallbackConfigMapNamespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(ctx, fallbackConfigMapName, metav1.GetOptions{})
+		if api_errors.IsNotFound(err) {
+			configMap = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: fallbackConfigMapNamespace, Name: fallbackConfigMapName}}
+			configMap.Data = map[string]string{string(owner): until.Format(time.RFC3339)}
+			_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+			if api_errors.IsAlreadyExists(err) {
+				// retried as a conflict
+				return api_errors.NewConflict(v1.Resource("configmaps"), fallbackConfigMapName, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		updated := configMap.DeepCopy()
+		if updated.Data == nil {
+			updated.Data = map[string]string{}
+		}
+		now := time.Now()
+		for key, value := range updated.Data {
+			if expired, err := time.Parse(time.RFC3339, value); err != nil || !now.Before(expired) {
+				delete(updated.Data, key)
+			}
+		}
+		updated.Data[string(owner)] = until.Format(time.RFC3339)
+		_, err = configMaps.Update(ctx, updated, metav1.UpdateOptions{})
+		return err
+	})
+	return errors.Wrap(err, "failed to persist fallback")
+}
+
+func newFallbackQueue() workqueue.RateLimitingInterface {
+	return workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "fallback")
+}
+
+// enqueueFallback queues the pod bound but not running yet, or failed.
+func (m *Manager) enqueueFallback(pod *v1.Pod) {
+	if m.fallbackCooldown <= 0 || pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil {
+		return
+	}
+	if pod.Status.Phase != v1.PodPending && pod.Status.Phase != v1.PodFailed {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(pod)
+	if err != nil {
+		klog.Errorf("failed to get key of pod %s/%s: %q", pod.Namespace, pod.Name, err)
+		return
+	}
+	m.fallbackQueue.Add(key)
+}
+
+func (m *Manager) runFallbackWorkers(ctx context.Context) {
+	if m.fallbackCooldown <= 0 {
+		klog.Info("fallback to normal nodes is disabled")
+		return
+	}
+	for i := 0; i < fallbackWorkers; i++ {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			for m.processNextFallback(ctx) {
+			}
+		}, time.Second)
+	}
+	<-ctx.Done()
+	m.fallbackQueue.ShutDown()
+}
+
+func (m *Manager) processNextFallback(ctx context.Context) bool {
+	key, quit := m.fallbackQueue.Get()
+	if quit {
+		return false
+	}
+	defer m.fallbackQueue.Done(key)
+
+	err := m.syncFallback(ctx, key.(string))
+	if err == nil {
+		m.fallbackQueue.Forget(key)
+		return true
+	}
+	if m.fallbackQueue.NumRequeues(key) < maxFallbackRetries {
+		klog.Warningf("failed to fall back pod %s, retry it: %q", key, err)
+		m.fallbackQueue.AddRateLimited(key)
+		return true
+	}
+	klog.Errorf("failed to fall back pod %s, drop it: %q", key, err)
+	m.fallbackQueue.Forget(key)
+	return true
+}
+
+// syncFallback deletes the pod failed on ECI, so that its controller
+// recreates it and the replacement avoids virtual nodes for the cooldown.
+func (m *Manager) syncFallback(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	pod, err := m.resourceManager.GetPod(namespace, name)
+	if err != nil {
+		if api_errors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to get pod")
+	}
+	if pod.DeletionTimestamp != nil {
+		return nil
+	}
+	node, err := m.resourceManager.GetNode(pod.Spec.NodeName)
+	if err != nil {
+		if api_errors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to get node")
+	}
+	if !m.policyManager.IsVirtualNode(node) {
+		return nil
+	}
+	failure := matchFailure(m.failurePatterns, pod, nil)
+	if failure == "" {
+		events, err := m.podEvents(pod)
+		if err != nil {
+			return err
+		}
+		failure = matchFailure(m.failurePatterns, pod, events)
+	}
+	if failure == "" {
+		return nil
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind == "DaemonSet" {
+		klog.V(3).Infof("pod %s/%s failed on virtual node %s (%s), no controller recreates it", pod.Namespace, pod.Name, pod.Spec.NodeName, failure)
+		return nil
+	}
+
+	until := time.Now().Add(m.fallbackCooldown).Truncate(time.Second)
+	m.fallbacks.avoid(owner.UID, until)
+	if err := m.persistFallback(ctx, owner.UID, until); err != nil {
+		return err
+	}
+	// the mark survives a failed deletion, which is retried
+	if pod.Annotations[eciv1.AnnotationAvoidVirtualNode] == "" {
+		patchOption := utils.NewPatchOption().WithAnnotation(eciv1.AnnotationAvoidVirtualNode, until.Format(time.RFC3339))
+		if _, err := utils.PatchPod(ctx, m.k8sClient, pod.Namespace, pod.Name, *patchOption); err != nil {
+			if api_errors.IsNotFound(err) {
+				return nil
+			}
+			return errors.Wrap(err, "failed to patch pod")
+		}
+		m.eventRecorder.Event(pod, v1.EventTypeWarning, EventReasonFallback,
+			fmt.Sprintf("ECI failed to create the pod on virtual node %s (%s), delete it so that the replacement avoids virtual nodes until %s", pod.Spec.NodeName, failure, until.Format(time.RFC3339)))
+	}
+	err = m.k8sClient.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{Preconditions: metav1.NewUIDPreconditions(string(pod.UID))})
+	if err != nil && !api_errors.IsNotFound(err) && !api_errors.IsConflict(err) {
+		return errors.Wrap(err, "failed to delete pod")
+	}
+	klog.Infof("pod %s/%s failed on virtual node %s (%s), deleted it to fall back to normal nodes", pod.Namespace, pod.Name, pod.Spec.NodeName, failure)
+	metrics.FallbackPods.WithLabelValues(pod.Namespace).Inc()
+	return nil
+}
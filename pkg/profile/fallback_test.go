@@ -0,0 +1,210 @@
+package profile
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/policy"
+	v1 "k8s.io/api/core/v1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMatchFailure(t *testing.T) {
+	patterns, err := ParseFailurePatterns(DefaultFailurePatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFailurePatterns("NoStock,("); err == nil {
+		t.Errorf("expect the invalid pattern rejected")
+	}
+	failed := &v1.Pod{Status: v1.PodStatus{Phase: v1.PodFailed, Reason: "ProviderFailed", Message: "create eci failed"}}
+	if actual := matchFailure(patterns, failed, nil); actual != "ProviderFailed" {
+		t.Errorf("expect the status reason matched, but got %q", actual)
+	}
+	pending := &v1.Pod{Status: v1.PodStatus{Phase: v1.PodPending}}
+	events := []v1.Event{
+		{Type: v1.EventTypeNormal, Reason: "Scheduled", Message: "nostock is not a failure of normal events"},
+		{Type: v1.EventTypeWarning, Reason: "ProviderCreateFailed", Message: "code: RecommendEmpty.InstanceTypeNoStock"},
+	}
+	if actual := matchFailure(patterns, pending, events); actual != events[1].Message {
+		t.Errorf("expect the warning event matched, but got %q", actual)
+	}
+	if actual := matchFailure(patterns, pending, events[:1]); actual != "" {
+		t.Errorf("expect no failure matched, but got %q", actual)
+	}
+	invalid := []v1.Event{{Type: v1.EventTypeWarning, Reason: "ProviderCreateFailed", Message: "code: InvalidParameter.Image"}}
+	if actual := matchFailure(patterns, pending, invalid); actual != "" {
+		t.Errorf("expect the errors of the pod spec not matched, but got %q", actual)
+	}
+}
+
+func TestAvoidVirtualNodeUntil(t *testing.T) {
+	m := &Manager{fallbacks: newFallbackCache()}
+	now := time.Now()
+	isController := true
+	owner := metav1.OwnerReference{Kind: "ReplicaSet", Name: "web", UID: types.UID("web"), Controller: &isController}
+	replacement := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-2", OwnerReferences: []metav1.OwnerReference{owner}}}
+	if _, ok := m.avoidVirtualNodeUntil(replacement, now); ok {
+		t.Errorf("expect the pod allowed on virtual nodes")
+	}
+	m.fallbacks.avoid(owner.UID, now.Add(time.Minute))
+	if until, ok := m.avoidVirtualNodeUntil(replacement, now); !ok || !until.Equal(now.Add(time.Minute)) {
+		t.Errorf("expect the replacement avoids virtual nodes until %v, but got %v, %v", now.Add(time.Minute), until, ok)
+	}
+	if _, ok := m.avoidVirtualNodeUntil(replacement, now.Add(time.Minute)); ok {
+		t.Errorf("expect the cooldown expired")
+	}
+	annotated := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		eciv1.AnnotationAvoidVirtualNode: now.Add(time.Hour).Format(time.RFC3339),
+	}}}
+	if _, ok := m.avoidVirtualNodeUntil(annotated, now); !ok {
+		t.Errorf("expect the annotated pod avoids virtual nodes")
+	}
+	if _, ok := m.avoidVirtualNodeUntil(annotated, now.Add(2*time.Hour)); ok {
+		t.Errorf("expect the annotation expired")
+	}
+}
+
+func TestOnPodCreatingAvoidsVirtualNodes(t *testing.T) {
+	selector := newTestSelector("fair", eciv1.SelectorSpec{
+		ObjectLabels: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+	})
+	m := newTestManager(t, []runtime.Object{&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}}, []runtime.Object{selector})
+	isController := true
+	owner := metav1.OwnerReference{Kind: "ReplicaSet", Name: "web", UID: types.UID("web"), Controller: &isController}
+	m.fallbacks.avoid(owner.UID, time.Now().Add(time.Hour))
+	tolerations, _ := policy.ParseTolerations(policy.DefaultVirtualNodeTolerations)
+	// the template tolerates the virtual nodes already
+	replacement := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "web-", Namespace: "default", Labels: map[string]string{"app": "web"}, OwnerReferences: []metav1.OwnerReference{owner}},
+		Spec:       v1.PodSpec{Tolerations: tolerations},
+	}
+
+	patches, _, err := m.onPodCreating(replacement, "", false)
+	if err != nil {
+		t.Fatalf("admission failed: %v", err)
+	}
+	var affinity *v1.Affinity
+	for _, patch := range patches {
+		if patch.Path == "/spec/affinity" {
+			affinity = patch.Value.(*v1.Affinity)
+		}
+	}
+	if affinity == nil {
+		t.Fatalf("expect the node affinity required, but got %v", patches)
+	}
+	vnode := newVirtualNode("vnode")
+	excluded := false
+	for _, requirement := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions {
+		if requirement.Operator == v1.NodeSelectorOpNotIn && containsString(requirement.Values, vnode.Labels[requirement.Key]) {
+			excluded = true
+		}
+	}
+	if !excluded {
+		t.Errorf("expect the virtual nodes excluded, but got %v", affinity)
+	}
+
+	// the pod excluding the virtual nodes is only marked
+	replacement.Spec.Affinity = affinity
+	patches, _, err = m.onPodCreating(replacement, "", false)
+	if err != nil {
+		t.Fatalf("admission failed: %v", err)
+	}
+	if len(patches) != 1 || patches[0].Path != "/metadata/annotations" {
+		t.Errorf("expect only the avoid mark patched, but got %v", patches)
+	}
+}
+
+func TestSyncFallback(t *testing.T) {
+	isController := true
+	newPod := func(name, nodeName, owner string, reason string) *v1.Pod {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)},
+			Spec:       v1.PodSpec{NodeName: nodeName},
+			Status:     v1.PodStatus{Phase: v1.PodPending, Reason: reason},
+		}
+		if owner != "" {
+			pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: owner, UID: types.UID(owner), Controller: &isController}}
+		}
+		if reason != "" {
+			pod.Status.Phase = v1.PodFailed
+		}
+		return pod
+	}
+	newEvent := func(pod *v1.Pod, message string) *v1.Event {
+		return &v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: pod.Name + ".failed", Namespace: pod.Namespace},
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID},
+			Type:           v1.EventTypeWarning,
+			Reason:         "ProviderCreateFailed",
+			Message:        message,
+		}
+	}
+	failed := newPod("failed", "virtual-node-1", "web", "ProviderFailed")
+	noStock := newPod("no-stock", "virtual-node-1", "api", "")
+	invalid := newPod("invalid", "virtual-node-1", "worker", "")
+	onNormalNode := newPod("on-normal-node", "node-1", "web", "ProviderFailed")
+	orphan := newPod("orphan", "virtual-node-1", "", "ProviderFailed")
+	m := newTestManager(t, []runtime.Object{
+		newVirtualNode("virtual-node-1"), newNormalNode("node-1", "4"),
+		failed, noStock, invalid, onNormalNode, orphan,
+		newEvent(noStock, "code: RecommendEmpty.InstanceTypeNoStock"),
+		newEvent(invalid, "code: InvalidParameter.Image"),
+	}, nil)
+	m.fallbackCooldown = 30 * time.Minute
+	m.failurePatterns, _ = ParseFailurePatterns(DefaultFailurePatterns)
+
+	for _, pod := range []*v1.Pod{failed, noStock, invalid, onNormalNode, orphan} {
+		if err := m.syncFallback(context.TODO(), pod.Namespace+"/"+pod.Name); err != nil {
+			t.Errorf("failed to sync fallback of pod %s: %v", pod.Name, err)
+		}
+	}
+	for desc, test := range map[string]struct {
+		pod           *v1.Pod
+		expectDeleted bool
+	}{
+		"test failed status":            {pod: failed, expectDeleted: true},
+		"test failure event in cache":   {pod: noStock, expectDeleted: true},
+		"test error of the pod spec":    {pod: invalid},
+		"test pod on normal node":       {pod: onNormalNode},
+		"test pod without a controller": {pod: orphan},
+	} {
+		_, err := m.k8sClient.CoreV1().Pods(test.pod.Namespace).Get(context.TODO(), test.pod.Name, metav1.GetOptions{})
+		if deleted := api_errors.IsNotFound(err); deleted != test.expectDeleted {
+			t.Errorf("[%s] expect deleted %v, but got %v", desc, test.expectDeleted, deleted)
+		}
+	}
+	if events := recordedEvents(m); len(events) != 2 {
+		t.Errorf("expect the fallback of 2 pods recorded, but got %v", events)
+	}
+
+	// the cooldown is persisted and restored after a restart
+	configMap, err := m.k8sClient.CoreV1().ConfigMaps(fallbackConfigMapNamespace).Get(context.TODO(), fallbackConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expect the fallbacks persisted, but got %v", err)
+	}
+	var owners []string
+	for owner := range configMap.Data {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	if !reflect.DeepEqual(owners, []string{"api", "web"}) {
+		t.Errorf("expect the fallbacks of api and web persisted, but got %v", owners)
+	}
+	restarted := newTestManager(t, []runtime.Object{configMap}, nil)
+	restarted.fallbackCooldown = m.fallbackCooldown
+	if err := restarted.loadFallbacks(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	replacement := newPod("web-2", "", "web", "")
+	if _, ok := restarted.avoidVirtualNodeUntil(replacement, time.Now()); !ok {
+		t.Errorf("expect the replacement avoids virtual nodes after a restart")
+	}
+}
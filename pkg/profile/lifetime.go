@@ -0,0 +1,158 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/metrics"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// lifetimeSyncPeriod is how often the lifetime of the pods on virtual nodes is checked.
+	lifetimeSyncPeriod = 30 * time.Second
+
+	// EventReasonLifetimeExceeded is recorded on the pods evicted from virtual
+	// nodes since they have run there longer than the max lifetime.
+	EventReasonLifetimeExceeded = "VirtualNodeLifetimeExceeded"
+)
+
+// maxVirtualNodeLifetime returns the max lifetime on virtual nodes of the
+// pods placed by the selector, zero if unlimited.
+func maxVirtualNodeLifetime(selector *eciv1.Selector) time.Duration {
+	policy := selector.Spec.Policy
+	if policy == nil {
+		return 0
+	}
+	var lifetime *metav1.Duration
+	switch {
+	case policy.Fair != nil:
+		lifetime = policy.Fair.MaxVirtualNodeLifetime
+	case policy.VirtualNodeOnly != nil:
+		lifetime = policy.VirtualNodeOnly.MaxVirtualNodeLifetime
+	case policy.NormalNodePrefer != nil:
+		lifetime = policy.NormalNodePrefer.MaxVirtualNodeLifetime
+	case policy.ReplicaSplit != nil:
+		lifetime = policy.ReplicaSplit.MaxVirtualNodeLifetime
+	case policy.StatefulSetOrdinal != nil:
+		lifetime = policy.StatefulSetOrdinal.MaxVirtualNodeLifetime
+	}
+	if lifetime == nil {
+		return 0
+	}
+	return lifetime.Duration
+}
+
+// runLifetimeEnforcer evicts the pods which have run on virtual nodes longer
+// than the max lifetime of their selectors.
+func (m *Manager) runLifetimeEnforcer(ctx context.Context) {
+	wait.UntilWithContext(ctx, m.enforceLifetime, lifetimeSyncPeriod)
+}
+
+func (m *Manager) enforceLifetime(ctx context.Context) {
+	selectors, err := m.resourceManager.ListSelectors()
+	if err != nil {
+		klog.Errorf("failed to list selectors: %q", err)
+		return
+	}
+	limited := false
+	for _, selector := range selectors {
+		if maxVirtualNodeLifetime(selector) > 0 && !isAuditMode(selector) {
+			limited = true
+			break
+		}
+	}
+	if !limited {
+		return
+	}
+	pods, err := m.resourceManager.ListPods("")
+	if err != nil {
+		klog.Errorf("failed to list pods: %q", err)
+		return
+	}
+	now := time.Now()
+	for _, pod := range pods {
+		if !m.isOnVirtualNode(pod) {
+			continue
+		}
+		// the lifetime is limited by the selector which placed the pod
+		selector, err := m.tracedSelector(pod)
+		if err != nil {
+			klog.Errorf("failed to find the selector of pod %s/%s: %q", pod.Namespace, pod.Name, err)
+			continue
+		}
+		if selector == nil || isAuditMode(selector) {
+			continue
+		}
+		lifetime := maxVirtualNodeLifetime(selector)
+		age := now.Sub(scheduledTime(pod))
+		if lifetime <= 0 || age < lifetime {
+			continue
+		}
+		deadline, err := m.hasJobDeadline(pod)
+		if err != nil {
+			klog.Errorf("failed to check the job of pod %s/%s: %q", pod.Namespace, pod.Name, err)
+			continue
+		}
+		if deadline {
+			klog.V(4).Infof("pod %s/%s is limited by the active deadline of its job, skip it", pod.Namespace, pod.Name)
+			continue
+		}
+		if err := m.evictPod(ctx, pod); err != nil {
+			switch {
+			case api_errors.IsTooManyRequests(err):
+				klog.V(3).Infof("eviction of pod %s/%s is blocked by the PodDisruptionBudget: %v", pod.Namespace, pod.Name, err)
+			case isPodNotFound(err, pod):
+			default:
+				klog.Errorf("failed to evict pod %s/%s(%s): %q", pod.Namespace, pod.Name, pod.UID, err)
+			}
+			continue
+		}
+		age = age.Truncate(time.Second)
+		klog.Infof("the pod %s/%s is evicted from virtual node %s, it has run there for %v, longer than %v (matched: %s)", pod.Namespace, pod.Name, pod.Spec.NodeName, age, lifetime, selector.Name)
+		metrics.LifetimeEvictedPods.WithLabelValues(selector.Name).Inc()
+		m.eventRecorder.Event(pod, v1.EventTypeNormal, EventReasonLifetimeExceeded,
+			fmt.Sprintf("evicted from virtual node %s by selector %s since it has run there for %v, longer than the max lifetime %v", pod.Spec.NodeName, selector.Name, age, lifetime))
+	}
+}
+
+// isOnVirtualNode reports whether the pod is bound to a virtual node and not
+// terminated yet.
+func (m *Manager) isOnVirtualNode(pod *v1.Pod) bool {
+	if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil {
+		return false
+	}
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return false
+	}
+	node, err := m.resourceManager.GetNode(pod.Spec.NodeName)
+	if err != nil {
+		klog.V(3).Infof("failed to get node %s of pod %s/%s: %v", pod.Spec.NodeName, pod.Namespace, pod.Name, err)
+		return false
+	}
+	return m.policyManager.IsVirtualNode(node)
+}
+
+// hasJobDeadline reports whether the pod is owned by a job which sets
+// activeDeadlineSeconds.
+func (m *Manager) hasJobDeadline(pod *v1.Pod) (bool, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "Job" {
+		return false, nil
+	}
+	job, err := m.resourceManager.GetJob(pod.Namespace, owner.Name)
+	if err != nil {
+		if api_errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to get job")
+	}
+	return job.UID == owner.UID && job.Spec.ActiveDeadlineSeconds != nil, nil
+}
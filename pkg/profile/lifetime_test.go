@@ -0,0 +1,139 @@
+package profile
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/policy"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMaxVirtualNodeLifetime(t *testing.T) {
+	hour := &metav1.Duration{Duration: time.Hour}
+	for desc, test := range map[string]struct {
+		policy *eciv1.PolicySource
+		expect time.Duration
+	}{
+		"test no policy": {},
+		"test unlimited": {
+			policy: &eciv1.PolicySource{Fair: &eciv1.FairPolicySource{}},
+		},
+		"test fair": {
+			policy: &eciv1.PolicySource{Fair: &eciv1.FairPolicySource{MaxVirtualNodeLifetime: hour}},
+			expect: time.Hour,
+		},
+		"test normal node prefer": {
+			policy: &eciv1.PolicySource{NormalNodePrefer: &eciv1.NormalNodePreferPolicySource{MaxVirtualNodeLifetime: hour}},
+			expect: time.Hour,
+		},
+		"test virtual node only": {
+			policy: &eciv1.PolicySource{VirtualNodeOnly: &eciv1.VirtualNodeOnlyPolicySource{MaxVirtualNodeLifetime: hour}},
+			expect: time.Hour,
+		},
+		"test normal node only": {
+			policy: &eciv1.PolicySource{NormalNodeOnly: &eciv1.NormalNodeOnlyPolicySource{}},
+		},
+	} {
+		selector := &eciv1.Selector{Spec: eciv1.SelectorSpec{Policy: test.policy}}
+		if actual := maxVirtualNodeLifetime(selector); actual != test.expect {
+			t.Errorf("[%s] expect %v, but got %v", desc, test.expect, actual)
+		}
+	}
+}
+
+func TestEnforceLifetime(t *testing.T) {
+	isController := true
+	now := time.Now()
+	selector := newTestSelector("limited", eciv1.SelectorSpec{
+		ObjectLabels: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		Policy: &eciv1.PolicySource{VirtualNodeOnly: &eciv1.VirtualNodeOnlyPolicySource{
+			MaxVirtualNodeLifetime: &metav1.Duration{Duration: time.Hour},
+		}},
+	})
+	// the pods are traced to the selector which placed them, even if their
+	// labels don't match it any longer
+	trace := (&policy.Trace{Selector: selector.Name, UID: selector.UID}).String()
+	newPod := func(name string, age time.Duration, owner *metav1.OwnerReference) *v1.Pod {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				UID:         types.UID(name),
+				Annotations: map[string]string{eciv1.AnnotationTrace: trace},
+			},
+			Spec: v1.PodSpec{NodeName: "vnode"},
+			Status: v1.PodStatus{
+				Phase:      v1.PodRunning,
+				Conditions: []v1.PodCondition{{Type: v1.PodScheduled, Status: v1.ConditionTrue, LastTransitionTime: metav1.NewTime(now.Add(-age))}},
+			},
+		}
+		if owner != nil {
+			pod.OwnerReferences = []metav1.OwnerReference{*owner}
+		}
+		return pod
+	}
+	deadline := int64(600)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "batch", Namespace: "default", UID: "batch"},
+		Spec:       batchv1.JobSpec{ActiveDeadlineSeconds: &deadline},
+	}
+	jobOwner := &metav1.OwnerReference{Kind: "Job", Name: job.Name, UID: job.UID, Controller: &isController}
+	otherJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", UID: "other"}}
+	otherJobOwner := &metav1.OwnerReference{Kind: "Job", Name: otherJob.Name, UID: otherJob.UID, Controller: &isController}
+	succeeded := newPod("succeeded", 2*time.Hour, nil)
+	succeeded.Status.Phase = v1.PodSucceeded
+	untraced := newPod("untraced", 2*time.Hour, nil)
+	untraced.Annotations = nil
+	untraced.Labels = map[string]string{"app": "web"}
+
+	for desc, test := range map[string]struct {
+		pods    []*v1.Pod
+		blocked map[string]bool
+		expect  []string
+	}{
+		"evict the expired pods": {
+			pods:   []*v1.Pod{newPod("expired", 2*time.Hour, nil), newPod("young", time.Minute, nil)},
+			expect: []string{"expired"},
+		},
+		"skip the terminal pods": {
+			pods: []*v1.Pod{succeeded},
+		},
+		"skip the pods of jobs with active deadline": {
+			pods:   []*v1.Pod{newPod("deadline", 2*time.Hour, jobOwner), newPod("no-deadline", 2*time.Hour, otherJobOwner)},
+			expect: []string{"no-deadline"},
+		},
+		"skip the pods not traced to the selector": {
+			pods: []*v1.Pod{untraced},
+		},
+		"blocked by the PodDisruptionBudget": {
+			pods:    []*v1.Pod{newPod("expired", 2*time.Hour, nil), newPod("blocked", 2*time.Hour, nil)},
+			blocked: map[string]bool{"blocked": true},
+			expect:  []string{"expired"},
+		},
+	} {
+		objects := []runtime.Object{newVirtualNode("vnode"), job, otherJob}
+		for _, pod := range test.pods {
+			objects = append(objects, pod)
+		}
+		m := newTestManager(t, objects, []runtime.Object{selector})
+		evicted := evictionRecorder(m.k8sClient.(*fake.Clientset), test.blocked)
+
+		m.enforceLifetime(context.TODO())
+		sort.Strings(*evicted)
+		if !reflect.DeepEqual(*evicted, test.expect) && (len(*evicted) != 0 || len(test.expect) != 0) {
+			t.Errorf("[%s] expect evicted %v, but got %v", desc, test.expect, *evicted)
+		}
+		if events := recordedEvents(m); len(events) != len(test.expect) {
+			t.Errorf("[%s] expect %d lifetime events, but got %v", desc, len(test.expect), events)
+		}
+	}
+}
@@ -3,53 +3,143 @@ package profile
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"reflect"
+	"regexp"
 	"sort"
+	"time"
 
 	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
 	"eci.io/eci-profile/pkg/client/clientset/versioned"
+	"eci.io/eci-profile/pkg/metrics"
 	"eci.io/eci-profile/pkg/policy"
 	"eci.io/eci-profile/pkg/resource"
 	"eci.io/eci-profile/pkg/utils"
 	"eci.io/eci-profile/pkg/webhook"
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 )
 
 type Config struct {
-	K8sClient     *kubernetes.Clientset
-	ProfileClient *versioned.Clientset
+	K8sClient     kubernetes.Interface
+	ProfileClient versioned.Interface
 	CACertPath    string
 	CAKeyPath     string
+	// VirtualNodeLabels identifies the virtual nodes
+	VirtualNodeLabels map[string]string
+	// VirtualNodeTolerations is tolerated by pods allowed to run on virtual nodes
+	VirtualNodeTolerations []v1.Toleration
+	// DriftReconcilePeriod is how often the drifted pods are reconciled, zero disables it
+	DriftReconcilePeriod time.Duration
+	// DriftReconcileQPS limits the patches of the drifted pods
+	DriftReconcileQPS float64
+	// DeletionCostRanking ranks the deletion cost of the pods on virtual nodes
+	// by price or age, empty disables it
+	DeletionCostRanking string
+	// FailurePatterns match the status and events of the pods ECI failed to create
+	FailurePatterns []*regexp.Regexp
+	// FallbackCooldown is how long the replacements of the pods failed on ECI
+	// avoid virtual nodes, zero disables the fallback
+	FallbackCooldown time.Duration
+	// BreakerProbePeriod is how long the breaker of an unhealthy virtual node
+	// stays open before it's half-opened, zero disables the breakers
+	BreakerProbePeriod time.Duration
+	// BreakerWindow is how long the pod outcomes are counted in the failure ratio
+	BreakerWindow time.Duration
+	// BreakerFailureRatio of the pods failed on a virtual node in the window
+	// opens its breaker, zero only opens it when the node is not ready
+	BreakerFailureRatio float64
 }
 
 type Manager struct {
 	resourceManager *resource.Manager
 	policyManager   *policy.Manager
 	webhookServer   *webhook.Server
-	k8sClient       *kubernetes.Clientset
+	k8sClient       kubernetes.Interface
+	profileClient   versioned.Interface
+	scheduledQueue  workqueue.RateLimitingInterface
+	selectors       *selectorCache
+	eventRecorder   record.EventRecorder
+	audits          *auditRecorder
+	drifts          *driftRecorder
+	conflicts       *conflictRecorder
+
+	driftReconcilePeriod time.Duration
+	driftLimiter         flowcontrol.RateLimiter
+
+	deletionCostRanking string
+	deletionCostQueue   workqueue.RateLimitingInterface
+
+	overflowQueue workqueue.RateLimitingInterface
+
+	failurePatterns  []*regexp.Regexp
+	fallbackCooldown time.Duration
+	fallbacks        *fallbackCache
+	fallbackQueue    workqueue.RateLimitingInterface
+
+	breakers *virtualNodeBreakers
+
+	budgetUsage *budgetUsage
+
+	evictions *evictionVersion
 }
 
 func NewManager(config *Config) (*Manager, error) {
 	resourceManager := resource.NewManager(config.K8sClient, config.ProfileClient)
-	policyManager := policy.NewManager(resourceManager)
+	virtualNode := policy.NewVirtualNode(config.VirtualNodeLabels, config.VirtualNodeTolerations)
+	var breakers *virtualNodeBreakers
+	if config.BreakerProbePeriod > 0 {
+		breakers = newVirtualNodeBreakers(config.BreakerWindow, config.BreakerFailureRatio, config.BreakerProbePeriod)
+		virtualNode.SetBreaker(breakers)
+	}
+	policyManager := policy.NewManager(resourceManager, virtualNode)
 	manager := &Manager{
 		resourceManager: resourceManager,
 		policyManager:   policyManager,
 		k8sClient:       config.K8sClient,
+		profileClient:   config.ProfileClient,
+		scheduledQueue:  newScheduledQueue(),
+		selectors:       newSelectorCache(),
+		eventRecorder:   newEventRecorder(config.K8sClient),
+		audits:          newAuditRecorder(),
+		drifts:          newDriftRecorder(),
+		conflicts:       newConflictRecorder(),
+
+		driftReconcilePeriod: config.DriftReconcilePeriod,
+		driftLimiter:         flowcontrol.NewTokenBucketRateLimiter(float32(config.DriftReconcileQPS), 1),
+
+		deletionCostRanking: config.DeletionCostRanking,
+		deletionCostQueue:   newDeletionCostQueue(),
+
+		overflowQueue: newOverflowQueue(),
+
+		failurePatterns:  config.FailurePatterns,
+		fallbackCooldown: config.FallbackCooldown,
+		fallbacks:        newFallbackCache(),
+		fallbackQueue:    newFallbackQueue(),
+
+		breakers: breakers,
+
+		budgetUsage: newBudgetUsage(),
+
+		evictions: newEvictionVersion(config.K8sClient.Discovery()),
 	}
 
 	webhookConfig := &webhook.Config{
-		K8sClient:         config.K8sClient,
-		MutatePodFunc:     manager.onPodCreating,
-		MutateBindingFunc: manager.onPodScheduled,
-		CACertPath:        config.CACertPath,
-		CAKeyPath:         config.CAKeyPath,
+		K8sClient:            config.K8sClient,
+		MutatePodFunc:        manager.onPodCreating,
+		ValidateSelectorFunc: validateSelector,
+		CACertPath:           config.CACertPath,
+		CAKeyPath:            config.CAKeyPath,
 	}
 	webhookServer, err := webhook.NewServer(webhookConfig)
 	if err != nil {
@@ -66,109 +156,221 @@ func (m *Manager) Run(ctx context.Context) error {
 	klog.Info("waiting for resource manager cache syncing")
 	cache.WaitForCacheSync(ctx.Done(), m.resourceManager.HasSynced)
 	klog.Info("resource manager cache has synced")
+	if err := m.loadFallbacks(ctx); err != nil {
+		// the pods already marked still avoid virtual nodes by their annotation
+		klog.Warningf("failed to load fallbacks: %v", err)
+	}
+	go m.runScheduledWorkers(ctx)
+	go m.runWindowSync(ctx)
+	go m.runAuditStatusSync(ctx)
+	go m.runDriftStatusSync(ctx)
+	go m.runDriftReconcile(ctx)
+	go m.runRebalancer(ctx)
+	go m.runDeletionCostWorkers(ctx)
+	go m.runOverflowWorkers(ctx)
+	go m.runBudgetSync(ctx)
+	go m.runFallbackWorkers(ctx)
+	go m.runBreakerProbe(ctx)
+	go m.runLifetimeEnforcer(ctx)
 	return m.webhookServer.Run(ctx)
 }
 
-func (m *Manager) onPodCreating(pod *v1.Pod, nodeName string) ([]policy.PatchInfo, error) {
-	if nodeName == "" {
-		return nil, nil
+// onPodCreating computes the patches of a creating pod, the result of a dry
+// run is returned as usual but nothing is written to the cluster.
+func (m *Manager) onPodCreating(pod *v1.Pod, nodeName string, dryRun bool) ([]policy.PatchInfo, []string, error) {
+	if nodeName != "" {
+		node, err := m.resourceManager.GetNode(nodeName)
+		if err != nil {
+			klog.Warningf("find to check node details of %s for pod %s/%s: %v", pod.Spec.NodeName, pod.Namespace, pod.Name, err)
+			return nil, nil, err
+		}
+		if !m.policyManager.IsVirtualNode(node) {
+			return nil, nil, nil
+		}
 	}
-	node, err := m.resourceManager.GetNode(nodeName)
+	// the pods not named yet are matched with a rollout key persisted below
+	keyedPod, rolloutKey, err := m.withRolloutKey(pod)
 	if err != nil {
-		klog.Warningf("find to check node details of %s for pod %s/%s: %v", pod.Spec.NodeName, pod.Namespace, pod.Name, err)
-		return nil, err
+		return nil, nil, err
 	}
-	if !policy.IsVirtualNode(node) {
-		return nil, nil
-	}
-	// effect selectors for vnode pod
-	selector, err := m.matchSelectorForPod(pod)
+	// effect selectors for vnode pod, or pods not bound yet
+	selector, warnings, err := m.matchSelectorForPod(keyedPod)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to match selector")
+		return nil, nil, errors.Wrap(err, "failed to match selector")
 	}
+	var patchInfos []policy.PatchInfo
 	if selector == nil {
 		klog.V(3).Infof("no selector matched for pod %s/%s, skip it", pod.Namespace, pod.Name)
-		return nil, nil
-	}
-	klog.Infof("pod %s/%s(%s) matched the selector %s(%s)", pod.Namespace, pod.Name, pod.UID, selector.Name, selector.UID)
-	return m.policyManager.OnPodCreating(selector, pod)
-}
-
-func (m *Manager) onPodScheduled(pod *v1.Pod, nodeName string) error {
-	if nodeName == "" {
-		return nil
+		if nodeName != "" {
+			// the pod bound to a virtual node at creation can't run elsewhere
+			if err := m.admitBoundPod(pod, dryRun); err != nil {
+				return nil, warnings, err
+			}
+		}
+	} else {
+		klog.Infof("pod %s/%s(%s) matched the selector %s(%s), dry run: %v", pod.Namespace, pod.Name, pod.UID, selector.Name, selector.UID, dryRun)
+		selector, errs := m.renderEffect(selector, pod)
+		warnings = append(warnings, m.reportRenderErrors(selector, pod, errs, dryRun)...)
+		patchInfos, err = m.policyManager.OnPodCreating(selector, pod)
+		if err != nil {
+			return nil, warnings, err
+		}
+		decided := patchInfos
+		reserved := false
+		if !isAuditMode(selector) && (nodeName != "" || len(patchInfos) > 0 || m.policyManager.IsVirtualNodeOnly(selector, pod)) {
+			budget, message, err := m.reserveBudget(pod)
+			if err != nil {
+				m.policyManager.ReleasePlacement(selector, pod, decided)
+				return nil, warnings, errors.Wrap(err, "failed to check virtual node budgets")
+			}
+			if budget != nil {
+				if nodeName != "" || m.policyManager.IsVirtualNodeOnly(selector, pod) {
+					m.policyManager.ReleasePlacement(selector, pod, decided)
+					return nil, warnings, errors.New(message)
+				}
+				klog.Infof("pod %s/%s isn't allowed to virtual nodes: %s", pod.Namespace, pod.Name, message)
+				warnings = append(warnings, message)
+				patchInfos = nil
+			} else {
+				reserved = true
+			}
+		}
+		if isAuditMode(selector) {
+			m.auditPod(selector, pod, policy.PhaseCreating, patchInfos, dryRun)
+			warnings = append(warnings, fmt.Sprintf("selector %s is in Audit mode, the pod isn't mutated", selector.Name))
+			patchInfos = nil
+		}
+		if dryRun || (len(decided) > 0 && len(patchInfos) == 0) {
+			// the pod isn't created as decided
+			m.policyManager.ReleasePlacement(selector, pod, decided)
+		}
+		if dryRun && reserved {
+			m.budgetUsage.release(pod)
+		}
 	}
-	node, err := m.resourceManager.GetNode(nodeName)
-	if err != nil {
-		klog.Warningf("find to check node details of %s for pod %s/%s: %v", pod.Spec.NodeName, pod.Namespace, pod.Name, err)
-		return err
+	if until, ok := m.avoidVirtualNodeUntil(pod, time.Now()); ok {
+		// the templates tolerating or selecting the virtual nodes are kept off them too
+		patchInfos = append(patchInfos, m.policyManager.AvoidVirtualNodes(pod)...)
+		if pod.Annotations[eciv1.AnnotationAvoidVirtualNode] == "" {
+			// the mark outlives the cache of the failed controllers
+			patchInfos = policy.AppendAnnotationPatch(pod, patchInfos, eciv1.AnnotationAvoidVirtualNode, until.Format(time.RFC3339))
+		}
 	}
-	if !policy.IsVirtualNode(node) {
-		return nil
+	if rolloutKey != "" && !dryRun {
+		patchInfos = appendRolloutKeyPatch(pod, patchInfos, rolloutKey)
 	}
-	// effect selectors for vnode pod
-	selector, err := m.matchSelectorForPod(pod)
+	return patchInfos, warnings, nil
+}
+
+func (m *Manager) onPodUnscheduled(pod *v1.Pod) error {
+	klog.V(3).Infof("pod %s/%s is unscheduled, recheck it", pod.Namespace, pod.Name)
+	selector, warnings, err := m.matchSelectorForPod(pod)
 	if err != nil {
 		return errors.Wrap(err, "failed to match selector")
 	}
+	for _, warning := range warnings {
+		klog.V(3).Infof("pod %s/%s: %s", pod.Namespace, pod.Name, warning)
+	}
 	if selector == nil {
-		klog.V(3).Infof("no selector matched for pod %s/%s, skip it", pod.Namespace, pod.Name)
+		klog.V(3).Infof("no selector matched for pod %s/%s", pod.Namespace, pod.Name)
 		return nil
 	}
+
 	klog.Infof("pod %s/%s(%s) matched the selector %s(%s)", pod.Namespace, pod.Name, pod.UID, selector.Name, selector.UID)
-	patchOptions, err := m.policyManager.OnPodScheduled(selector, pod)
+	allowed, reasons, err := m.allowOverflow(selector, pod)
 	if err != nil {
-		klog.Warningf("execute policy for pod %s/%s failed: %v", pod.Namespace, pod.Name, err)
-		return err
+		return errors.Wrap(err, "failed to classify unschedulable reasons")
 	}
-	if patchOptions != nil {
-		if _, err := utils.PatchPod(context.TODO(), m.k8sClient, pod.Namespace, pod.Name, *patchOptions); err != nil {
-			klog.Errorf("failed to patch the pod %s/%s(%s): %q", pod.Namespace, pod.Name, pod.UID, err)
-			return err
-		}
-		klog.Infof("the pod %s/%s is scheduled to vnode (matched: %s)", pod.Namespace, pod.Name, selector.Name)
+	if !allowed {
+		klog.V(3).Infof("pod %s/%s is unschedulable for %v, which doesn't allow it to overflow (matched: %s)", pod.Namespace, pod.Name, reasons, selector.Name)
+		return nil
 	}
-	return nil
-}
-
-func (m *Manager) onPodUnscheduled(pod *v1.Pod) error {
-	klog.V(3).Infof("pod %s/%s is unscheduled, recheck it", pod.Namespace, pod.Name)
-	selector, err := m.matchSelectorForPod(pod)
+	delay, err := m.delayOverflow(selector, pod, time.Now())
 	if err != nil {
-		return errors.Wrap(err, "failed to match selector")
+		return errors.Wrap(err, "failed to check overflow delay")
 	}
-	if selector == nil {
-		klog.V(3).Infof("no selector matched for pod %s/%s", pod.Namespace, pod.Name)
+	if delay > 0 {
+		klog.V(3).Infof("overflow of pod %s/%s is delayed for %v (matched: %s)", pod.Namespace, pod.Name, delay, selector.Name)
+		m.enqueueDelayedOverflow(pod, delay)
 		return nil
 	}
-
-	klog.Infof("pod %s/%s(%s) matched the selector %s(%s)", pod.Namespace, pod.Name, pod.UID, selector.Name, selector.UID)
+	selector, errs := m.renderEffect(selector, pod)
+	m.reportRenderErrors(selector, pod, errs, false)
 	patchOptions, err := m.policyManager.OnPodUnscheduled(selector, pod)
+	if policy.IsPlacementConflict(err) {
+		// retrying doesn't help, the node selector and node affinity are immutable
+		m.reportPlacementConflict(selector, pod, err)
+		return nil
+	}
 	if err != nil {
 		return errors.Wrap(err, "execute policy failed")
 	}
-	if patchOptions != nil {
-		if _, err := utils.PatchPod(context.TODO(), m.k8sClient, pod.Namespace, pod.Name, *patchOptions); err != nil {
-			klog.Errorf("failed to patch the pod %s/%s(%s): %q", pod.Namespace, pod.Name, pod.UID, err)
-			return errors.Wrap(err, "failed to patch pod")
-		}
-		klog.Infof("the pod %s/%s is allowed to schedule to vnode (matched: %s)", pod.Namespace, pod.Name, selector.Name)
+	if patchOptions == nil || patchOptions.IsEmpty() {
+		return nil
+	}
+	if isAuditMode(selector) {
+		m.auditPod(selector, pod, policy.PhaseUnscheduled, patchOptions, false)
+		return nil
+	}
+	budget, message, err := m.reserveBudget(pod)
+	if err != nil {
+		return errors.Wrap(err, "failed to check virtual node budgets")
+	}
+	if budget != nil {
+		klog.V(3).Infof("pod %s/%s isn't allowed to virtual nodes: %s", pod.Namespace, pod.Name, message)
+		return nil
 	}
+	if _, err := utils.PatchPod(context.TODO(), m.k8sClient, pod.Namespace, pod.Name, *patchOptions); err != nil {
+		m.budgetUsage.release(pod)
+		klog.Errorf("failed to patch the pod %s/%s(%s): %q", pod.Namespace, pod.Name, pod.UID, err)
+		return errors.Wrap(err, "failed to patch pod")
+	}
+	klog.Infof("the pod %s/%s is allowed to schedule to vnode (matched: %s)", pod.Namespace, pod.Name, selector.Name)
 	return nil
 }
 
-func (m *Manager) matchSelectorForPod(pod *v1.Pod) (*eciv1.Selector, error) {
+// matchSelectorForPod returns the matched selector with the highest priority,
+// and the warnings about the selector pinned by the pod annotation.
+func (m *Manager) matchSelectorForPod(pod *v1.Pod) (*eciv1.Selector, []string, error) {
+	optedOut, err := m.isOptedOut(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if optedOut {
+		klog.V(3).Infof("pod %s/%s opted out of selectors", pod.Namespace, pod.Name)
+		return nil, nil, nil
+	}
+	if until, ok := m.avoidVirtualNodeUntil(pod, time.Now()); ok {
+		klog.V(3).Infof("pod %s/%s avoids virtual nodes until %s, since ECI failed to create the pod it replaces", pod.Namespace, pod.Name, until.Format(time.RFC3339))
+		return nil, nil, nil
+	}
 	allSelectors, err := m.resourceManager.ListSelectors()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to list selectors")
+		return nil, nil, errors.Wrap(err, "failed to list selectors")
 	}
+	pinned := pod.Annotations[eciv1.AnnotationSelector]
+	pinnedFound := false
+	now := time.Now()
 	var selectors []eciv1.Selector
 	for _, selector := range allSelectors {
+		if pinned != "" {
+			if selector.Name != pinned {
+				continue
+			}
+			pinnedFound = true
+		}
+		if err := m.selectors.validate(selector); err != nil {
+			klog.V(3).Infof("selector %s is invalid, skip it: %v", selector.Name, err)
+			continue
+		}
+		if !m.isSelectorActive(selector, now) {
+			continue
+		}
 		matched, err := m.matchPod(selector, pod)
 		if err != nil {
-			return nil, errors.Wrap(err, "match pod failed")
+			return nil, nil, errors.Wrap(err, "match pod failed")
 		}
-		if matched {
+		if matched && inRollout(selector, pod) {
 			selectors = append(selectors, *selector)
 		}
 	}
@@ -177,9 +379,60 @@ func (m *Manager) matchSelectorForPod(pod *v1.Pod) (*eciv1.Selector, error) {
 		sort.Sort(SelectorList(selectors))
 		selector = &selectors[0]
 	}
+	var warnings []string
+	switch {
+	case pinned != "" && !pinnedFound:
+		warnings = append(warnings, fmt.Sprintf("selector %q pinned by annotation %s is not found, no selector is applied", pinned, eciv1.AnnotationSelector))
+	case pinned != "" && selector == nil:
+		warnings = append(warnings, fmt.Sprintf("selector %q pinned by annotation %s doesn't match the pod, no selector is applied", pinned, eciv1.AnnotationSelector))
+	}
+	return selector, warnings, nil
+}
+
+// reportInvalidSelector records a Warning event on the selector admitted
+// while the validating webhook was unavailable, it never applies to any pod.
+func (m *Manager) reportInvalidSelector(selector *eciv1.Selector) {
+	if err := m.selectors.validate(selector); err != nil {
+		klog.Errorf("selector %s is invalid: %q", selector.Name, err)
+		m.eventRecorder.Event(selector, v1.EventTypeWarning, EventReasonSelectorInvalid, fmt.Sprintf("selector is invalid and ignored: %v", err))
+	}
+}
+
+// tracedSelector returns the selector which mutated the pod as recorded by its
+// trace, or nil if the pod isn't traced or the selector is recreated since.
+func (m *Manager) tracedSelector(pod *v1.Pod) (*eciv1.Selector, error) {
+	trace, err := policy.GetTrace(pod)
+	if err != nil || trace == nil {
+		return nil, err
+	}
+	selector, err := m.resourceManager.GetSelector(trace.Selector)
+	if err != nil {
+		if api_errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to get selector")
+	}
+	if selector.UID != trace.UID {
+		return nil, nil
+	}
 	return selector, nil
 }
 
+// isOptedOut reports whether the pod or its namespace opts out of all selectors.
+func (m *Manager) isOptedOut(pod *v1.Pod) (bool, error) {
+	if pod.Annotations[eciv1.AnnotationSelectorOptOut] == "true" {
+		return true, nil
+	}
+	namespace, err := m.resourceManager.GetNamespace(pod.Namespace)
+	if err != nil {
+		if api_errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "failed to get namespace")
+	}
+	return namespace.Annotations[eciv1.AnnotationSelectorOptOut] == "true", nil
+}
+
 func (m *Manager) registerPodEventHandler() {
 	m.resourceManager.AddSelectorEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -190,6 +443,7 @@ func (m *Manager) registerPodEventHandler() {
 			klog.Infof("add selector: %s(%s)", selector.Name, selector.UID)
 			payload, _ := json.Marshal(selector)
 			klog.V(5).Infof("selector payload: %s", payload)
+			m.reportInvalidSelector(selector)
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			if reflect.DeepEqual(oldObj, newObj) {
@@ -202,6 +456,7 @@ func (m *Manager) registerPodEventHandler() {
 			klog.Infof("update selector: %s(%s)", selector.Name, selector.UID)
 			payload, _ := json.Marshal(selector)
 			klog.V(5).Infof("selector payload: %s", payload)
+			m.reportInvalidSelector(selector)
 		},
 		DeleteFunc: func(obj interface{}) {
 			selector, ok := obj.(*eciv1.Selector)
@@ -209,6 +464,35 @@ func (m *Manager) registerPodEventHandler() {
 				return
 			}
 			klog.Infof("delete selector: %s(%s)", selector.Name, selector.UID)
+			m.selectors.delete(selector)
+			m.audits.take(selector.UID)
+			m.drifts.take(selector.UID)
+			metrics.DriftedPods.DeleteLabelValues(selector.Name)
+		},
+	})
+	m.resourceManager.AddNodeEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*v1.Node); ok {
+				m.observeVirtualNode(node)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if node, ok := newObj.(*v1.Node); ok {
+				m.observeVirtualNode(node)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			node, ok := obj.(*v1.Node)
+			if !ok {
+				tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					return
+				}
+				if node, ok = tombstone.Obj.(*v1.Node); !ok {
+					return
+				}
+			}
+			m.forgetVirtualNode(node)
 		},
 	})
 	m.resourceManager.AddPodEventHandler(cache.ResourceEventHandlerFuncs{
@@ -217,6 +501,11 @@ func (m *Manager) registerPodEventHandler() {
 			if !ok {
 				return
 			}
+			m.policyManager.ObservePod(pod)
+			m.budgetUsage.account(pod, m.isVirtualNodePod(pod))
+			m.enqueueRecentlyScheduledPod(pod, time.Now())
+			m.enqueueDeletionCost(pod)
+			m.enqueueFallback(pod)
 			if isUnscheduledPod(pod) {
 				if err := m.onPodUnscheduled(pod); err != nil {
 					klog.Errorf("failed to execute unscheduled policy for pod %s/%s: %q", pod.Namespace, pod.Name, err)
@@ -229,6 +518,17 @@ func (m *Manager) registerPodEventHandler() {
 			if !ok {
 				return
 			}
+			if oldPod, ok := oldObj.(*v1.Pod); ok {
+				if oldPod.Spec.NodeName == "" {
+					m.enqueueScheduledPod(pod)
+				}
+				if isPlacementChanged(oldPod, pod) {
+					m.enqueueDeletionCost(pod)
+				}
+				m.observePodOutcome(oldPod, pod)
+			}
+			m.budgetUsage.account(pod, m.isVirtualNodePod(pod))
+			m.enqueueFallback(pod)
 			if isUnscheduledPod(pod) {
 				if err := m.onPodUnscheduled(pod); err != nil {
 					klog.Errorf("failed to execute unscheduled policy for pod %s/%s: %q", pod.Namespace, pod.Name, err)
@@ -237,6 +537,20 @@ func (m *Manager) registerPodEventHandler() {
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
+			pod, ok := obj.(*v1.Pod)
+			if !ok {
+				tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					return
+				}
+				if pod, ok = tombstone.Obj.(*v1.Pod); !ok {
+					return
+				}
+			}
+			m.audits.forgetPod(pod.UID)
+			m.conflicts.forgetPod(pod.UID)
+			m.budgetUsage.account(pod, false)
+			m.enqueueDeletionCost(pod)
 		},
 	})
 }
@@ -266,5 +580,31 @@ func (m *Manager) matchPod(selector *eciv1.Selector, pod *v1.Pod) (bool, error)
 			return false, nil
 		}
 	}
-	return true, nil
+	if !matchPodFields(selector.Spec.PodMatch, pod) {
+		return false, nil
+	}
+	return m.matchCondition(selector, pod)
+}
+
+// matchCondition evaluates the match condition of the selector, a selector
+// whose condition is invalid or fails to evaluate doesn't match any pod.
+func (m *Manager) matchCondition(selector *eciv1.Selector, pod *v1.Pod) (bool, error) {
+	program, err := m.selectors.condition(selector)
+	if err != nil {
+		klog.Errorf("invalid match condition of selector %s: %q", selector.Name, err)
+		return false, nil
+	}
+	if program == nil {
+		return true, nil
+	}
+	namespace, err := m.resourceManager.GetNamespace(pod.Namespace)
+	if err != nil && !api_errors.IsNotFound(err) {
+		return false, errors.Wrap(err, "failed to get namespace")
+	}
+	matched, err := program.EvalBool(pod, namespace)
+	if err != nil {
+		klog.V(3).Infof("match condition of selector %s doesn't apply to pod %s/%s: %v", selector.Name, pod.Namespace, pod.Name, err)
+		return false, nil
+	}
+	return matched, nil
 }
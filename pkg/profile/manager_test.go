@@ -0,0 +1,283 @@
+package profile
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	profilefake "eci.io/eci-profile/pkg/client/clientset/versioned/fake"
+	"eci.io/eci-profile/pkg/metrics"
+	"eci.io/eci-profile/pkg/policy"
+	"eci.io/eci-profile/pkg/resource"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// newTestManager returns a manager backed by the fake clientsets, whose
+// informers have synced the given objects. Its events are recorded by a
+// record.FakeRecorder.
+func newTestManager(t *testing.T, k8sObjects []runtime.Object, profileObjects []runtime.Object) *Manager {
+	k8sClient := fake.NewSimpleClientset(k8sObjects...)
+	profileClient := profilefake.NewSimpleClientset(profileObjects...)
+	resourceManager := resource.NewManager(k8sClient, profileClient)
+	virtualNodeLabels, _ := policy.ParseNodeSelector(policy.DefaultVirtualNodeSelector)
+	tolerations, _ := policy.ParseTolerations(policy.DefaultVirtualNodeTolerations)
+	m := &Manager{
+		resourceManager:   resourceManager,
+		policyManager:     policy.NewManager(resourceManager, policy.NewVirtualNode(virtualNodeLabels, tolerations)),
+		k8sClient:         k8sClient,
+		profileClient:     profileClient,
+		scheduledQueue:    newScheduledQueue(),
+		selectors:         newSelectorCache(),
+		eventRecorder:     record.NewFakeRecorder(100),
+		audits:            newAuditRecorder(),
+		drifts:            newDriftRecorder(),
+		conflicts:         newConflictRecorder(),
+		driftLimiter:      flowcontrol.NewFakeAlwaysRateLimiter(),
+		deletionCostQueue: newDeletionCostQueue(),
+		overflowQueue:     newOverflowQueue(),
+		fallbacks:         newFallbackCache(),
+		fallbackQueue:     newFallbackQueue(),
+		budgetUsage:       newBudgetUsage(),
+		evictions:         newEvictionVersion(k8sClient.Discovery()),
+	}
+	stopCh := make(chan struct{})
+	t.Cleanup(func() {
+		close(stopCh)
+		m.scheduledQueue.ShutDown()
+		m.deletionCostQueue.ShutDown()
+		m.overflowQueue.ShutDown()
+		m.fallbackQueue.ShutDown()
+	})
+	resourceManager.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, resourceManager.HasSynced) {
+		t.Fatalf("failed to sync the informers")
+	}
+	return m
+}
+
+// recordedEvents drains the events recorded by the manager.
+func recordedEvents(m *Manager) []string {
+	recorder := m.eventRecorder.(*record.FakeRecorder)
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func newTestSelector(name string, spec eciv1.SelectorSpec) *eciv1.Selector {
+	selector := &eciv1.Selector{Spec: spec}
+	selector.Name = name
+	selector.UID = types.UID("uid-" + name)
+	selector.Generation = 1
+	return selector
+}
+
+func TestOnPodCreatingDryRun(t *testing.T) {
+	enforced := newTestSelector("enforced", eciv1.SelectorSpec{
+		ObjectLabels: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "enforced"}},
+		Effect: &eciv1.SideEffect{Labels: map[string]string{
+			"team":    "a",
+			"missing": `{{ pod.metadata.annotations["missing"] }}`,
+		}},
+		Policy: &eciv1.PolicySource{VirtualNodeOnly: &eciv1.VirtualNodeOnlyPolicySource{}},
+	})
+	audited := newTestSelector("audited", eciv1.SelectorSpec{
+		ObjectLabels: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "audited"}},
+		Effect:       &eciv1.SideEffect{Labels: map[string]string{"team": "a"}},
+		Mode:         eciv1.SelectorModeAudit,
+	})
+	m := newTestManager(t, nil, []runtime.Object{enforced, audited})
+	newPod := func(app string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			GenerateName: app + "-",
+			Namespace:    "default",
+			Labels:       map[string]string{"app": app},
+		}}
+	}
+
+	// the dry run returns the same patches and warnings, but records nothing
+	dryRunPatches, dryRunWarnings, err := m.onPodCreating(newPod("enforced"), "", true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if events := recordedEvents(m); len(events) != 0 {
+		t.Errorf("expect no events on a dry run, but got %v", events)
+	}
+	patches, warnings, err := m.onPodCreating(newPod("enforced"), "", false)
+	if err != nil {
+		t.Fatalf("admission failed: %v", err)
+	}
+	if len(patches) == 0 || !reflect.DeepEqual(dryRunPatches, patches) || !reflect.DeepEqual(dryRunWarnings, warnings) {
+		t.Errorf("expect the dry run returns %v with warnings %v, but got %v with warnings %v", patches, warnings, dryRunPatches, dryRunWarnings)
+	}
+	if events := recordedEvents(m); len(events) != 1 {
+		t.Errorf("expect the render failure recorded once, but got %v", events)
+	}
+
+	counter := metrics.AuditedPods.WithLabelValues(audited.Name, policy.PhaseCreating)
+	before := testutil.ToFloat64(counter)
+	patches, warnings, err = m.onPodCreating(newPod("audited"), "", true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if len(patches) != 0 || len(warnings) != 1 {
+		t.Errorf("expect no patches and the audit warning, but got %v, %v", patches, warnings)
+	}
+	if summary := m.audits.take(audited.UID); summary != nil {
+		t.Errorf("expect no audits on a dry run, but got %v", summary)
+	}
+	if after := testutil.ToFloat64(counter); after != before {
+		t.Errorf("expect the audit metric unchanged on a dry run, but got %v -> %v", before, after)
+	}
+	if events := recordedEvents(m); len(events) != 0 {
+		t.Errorf("expect no events on a dry run, but got %v", events)
+	}
+}
+
+func TestMatchSelectorForPod(t *testing.T) {
+	priority, highest := int32(10), int32(100)
+	low := newTestSelector("low", eciv1.SelectorSpec{
+		ObjectLabels: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}},
+		Effect:       &eciv1.SideEffect{Labels: map[string]string{"selector": "low"}},
+	})
+	high := newTestSelector("high", eciv1.SelectorSpec{
+		ObjectLabels: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}},
+		Effect:       &eciv1.SideEffect{Labels: map[string]string{"selector": "high"}},
+		Priority:     &priority,
+	})
+	other := newTestSelector("other", eciv1.SelectorSpec{
+		ObjectLabels: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "bar"}},
+		Effect:       &eciv1.SideEffect{Labels: map[string]string{"selector": "other"}},
+	})
+	invalid := newTestSelector("invalid", eciv1.SelectorSpec{
+		ObjectLabels: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}},
+		Effect:       &eciv1.SideEffect{Labels: map[string]string{"selector": "invalid"}},
+		Priority:     &highest,
+		Mode:         "Unknown",
+	})
+	optedOutNamespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "opted-out",
+		Annotations: map[string]string{eciv1.AnnotationSelectorOptOut: "true"},
+	}}
+	m := newTestManager(t, []runtime.Object{optedOutNamespace}, []runtime.Object{low, high, other, invalid})
+
+	for desc, test := range map[string]struct {
+		namespace      string
+		annotations    map[string]string
+		expectSelector string
+		expectWarnings int
+	}{
+		"highest priority": {
+			namespace:      "default",
+			expectSelector: "high",
+		},
+		"pinned": {
+			namespace:      "default",
+			annotations:    map[string]string{eciv1.AnnotationSelector: "low"},
+			expectSelector: "low",
+		},
+		"pinned not matching": {
+			namespace:      "default",
+			annotations:    map[string]string{eciv1.AnnotationSelector: "other"},
+			expectWarnings: 1,
+		},
+		"pinned invalid": {
+			namespace:      "default",
+			annotations:    map[string]string{eciv1.AnnotationSelector: "invalid"},
+			expectWarnings: 1,
+		},
+		"pinned not found": {
+			namespace:      "default",
+			annotations:    map[string]string{eciv1.AnnotationSelector: "missing"},
+			expectWarnings: 1,
+		},
+		"pod opted out": {
+			namespace:   "default",
+			annotations: map[string]string{eciv1.AnnotationSelectorOptOut: "true", eciv1.AnnotationSelector: "missing"},
+		},
+		"namespace opted out": {
+			namespace: "opted-out",
+		},
+	} {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   test.namespace,
+			Labels:      map[string]string{"app": "foo"},
+			Annotations: test.annotations,
+		}}
+		selector, warnings, err := m.matchSelectorForPod(pod)
+		if err != nil {
+			t.Fatalf("[%s] match selector failed: %v", desc, err)
+		}
+		name := ""
+		if selector != nil {
+			name = selector.Name
+		}
+		if name != test.expectSelector || len(warnings) != test.expectWarnings {
+			t.Errorf("[%s] expect selector %q with %d warnings, but got %q with %v", desc, test.expectSelector, test.expectWarnings, name, warnings)
+		}
+
+		// the admission returns the warnings, and mutates nothing without a selector
+		patches, admissionWarnings, err := m.onPodCreating(pod, "", true)
+		if err != nil {
+			t.Fatalf("[%s] admission failed: %v", desc, err)
+		}
+		if !reflect.DeepEqual(admissionWarnings, warnings) {
+			t.Errorf("[%s] expect admission warnings %v, but got %v", desc, warnings, admissionWarnings)
+		}
+		if (len(patches) > 0) != (test.expectSelector != "") {
+			t.Errorf("[%s] unexpected patches %v", desc, patches)
+		}
+	}
+
+	m.reportInvalidSelector(high)
+	m.reportInvalidSelector(invalid)
+	if events := recordedEvents(m); len(events) != 1 {
+		t.Errorf("expect the invalid selector reported once, but got %v", events)
+	}
+}
+
+func TestOnPodUnscheduledPlacementConflict(t *testing.T) {
+	selector := newTestSelector("vnode-only", eciv1.SelectorSpec{
+		ObjectLabels: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		Policy:       &eciv1.PolicySource{VirtualNodeOnly: &eciv1.VirtualNodeOnlyPolicySource{}},
+	})
+	// the pod selects the normal nodes, which excludes the virtual nodes
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default", UID: "web-0", Labels: map[string]string{"app": "web"}},
+		Spec:       v1.PodSpec{NodeSelector: map[string]string{"k8s.aliyun.com/vnode": "false"}},
+	}
+	m := newTestManager(t, []runtime.Object{pod}, []runtime.Object{selector})
+
+	for i := 0; i < 2; i++ {
+		if err := m.onPodUnscheduled(pod); err != nil {
+			t.Fatalf("expect the conflict not returned as an error, but got %v", err)
+		}
+	}
+	events := recordedEvents(m)
+	if len(events) != 1 || !strings.HasPrefix(events[0], "Warning "+EventReasonPlacementConflict) {
+		t.Fatalf("expect the conflict reported once, but got %v", events)
+	}
+	// the conflict is reported again for the new generation of the selector
+	updated := selector.DeepCopy()
+	updated.Generation++
+	m.reportPlacementConflict(updated, pod, errors.New("pod conflicts with the VirtualNodeOnly policy"))
+	if events := recordedEvents(m); len(events) != 1 {
+		t.Errorf("expect the conflict reported for the new generation, but got %v", events)
+	}
+}
@@ -0,0 +1,235 @@
+package profile
+
+import (
+	"context"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/policy"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// eventReasonTriggeredScaleUp is recorded on the pods by the cluster
+	// autoscaler when it adds nodes for them, and eventReasonNotTriggerScaleUp
+	// when no node group helps.
+	eventReasonTriggeredScaleUp  = "TriggeredScaleUp"
+	eventReasonNotTriggerScaleUp = "NotTriggerScaleUp"
+	// eventReasonFailedScheduling is recorded on the pods by the scheduler
+	eventReasonFailedScheduling = "FailedScheduling"
+
+	// scaleUpTimeout is how long a triggered scale-up is waited for, the
+	// default max node provision time of the cluster autoscaler
+	scaleUpTimeout = 15 * time.Minute
+	// scaleUpRecheckPeriod is how often an active scale-up is checked
+	scaleUpRecheckPeriod = 30 * time.Second
+
+	overflowWorkers = 2
+)
+
+func newOverflowQueue() workqueue.RateLimitingInterface {
+	return workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "delayed-overflow")
+}
+
+func normalNodePrefer(selector *eciv1.Selector) *eciv1.NormalNodePreferPolicySource {
+	if selector.Spec.Policy == nil {
+		return nil
+	}
+	return selector.Spec.Policy.NormalNodePrefer
+}
+
+func overflowDelay(selector *eciv1.Selector) time.Duration {
+	prefer := normalNodePrefer(selector)
+	if prefer == nil || prefer.OverflowDelay == nil {
+		return 0
+	}
+	return prefer.OverflowDelay.Duration
+}
+
+// allowOverflow reports whether the pod is unschedulable for the reasons
+// allowing it to overflow to virtual nodes, classified by the message of the
+// PodScheduled condition, or the latest FailedScheduling event if the
+// condition doesn't tell.
+func (m *Manager) allowOverflow(selector *eciv1.Selector, pod *v1.Pod) (bool, []eciv1.UnschedulableReason, error) {
+	prefer := normalNodePrefer(selector)
+	if prefer == nil || policy.IsTracedPhase(pod, policy.PhaseUnscheduled) {
+		return true, nil, nil
+	}
+	var reasons []eciv1.UnschedulableReason
+	if condition := unschedulableCondition(pod); condition != nil && condition.Message != "" {
+		reasons = policy.ClassifyUnschedulable(condition.Message)
+	}
+	if len(reasons) == 0 || (len(reasons) == 1 && reasons[0] == eciv1.UnschedulableReasonOther) {
+		events, err := m.podEvents(pod)
+		if err != nil {
+			return false, nil, err
+		}
+		if event := latestEvent(events, eventReasonFailedScheduling); event != nil {
+			reasons = policy.ClassifyUnschedulable(event.Message)
+		}
+	}
+	return policy.IsOverflowAllowed(prefer.OverflowReasons, reasons), reasons, nil
+}
+
+// delayOverflow returns how long the overflow of the pod to virtual nodes is
+// delayed, until it has been unschedulable for the overflow delay of the
+// selector and no scale-up of the cluster autoscaler is in progress for it.
+func (m *Manager) delayOverflow(selector *eciv1.Selector, pod *v1.Pod, now time.Time) (time.Duration, error) {
+	delay := overflowDelay(selector)
+	if delay <= 0 || policy.IsTracedPhase(pod, policy.PhaseUnscheduled) {
+		// the pod has overflowed already
+		return 0, nil
+	}
+	if since, ok := unschedulableSince(pod); ok {
+		if remaining := since.Add(delay).Sub(now); remaining > 0 {
+			return remaining, nil
+		}
+	}
+	active, err := m.isScaleUpActive(pod, now)
+	if err != nil {
+		return 0, err
+	}
+	if active {
+		return scaleUpRecheckPeriod, nil
+	}
+	return 0, nil
+}
+
+// isScaleUpActive reports whether the cluster autoscaler has triggered a
+// scale-up for the pod, which neither timed out nor was followed by a failure.
+func (m *Manager) isScaleUpActive(pod *v1.Pod, now time.Time) (bool, error) {
+	events, err := m.podEvents(pod)
+	if err != nil {
+		return false, err
+	}
+	return isScaleUpActive(events, now), nil
+}
+
+// podEvents returns the events of the pod cached by the informer.
+func (m *Manager) podEvents(pod *v1.Pod) ([]v1.Event, error) {
+	cached, err := m.resourceManager.ListPodEvents(pod)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list events")
+	}
+	events := make([]v1.Event, 0, len(cached))
+	for _, event := range cached {
+		events = append(events, *event)
+	}
+	return events, nil
+}
+
+// latestEvent returns the event of the reason observed last.
+func latestEvent(events []v1.Event, reason string) *v1.Event {
+	var latest *v1.Event
+	for i := range events {
+		if events[i].Reason != reason {
+			continue
+		}
+		if latest == nil || eventTime(&events[i]).After(eventTime(latest)) {
+			latest = &events[i]
+		}
+	}
+	return latest
+}
+
+func isScaleUpActive(events []v1.Event, now time.Time) bool {
+	var triggered, notTriggered time.Time
+	for i := range events {
+		last := eventTime(&events[i])
+		switch events[i].Reason {
+		case eventReasonTriggeredScaleUp:
+			if last.After(triggered) {
+				triggered = last
+			}
+		case eventReasonNotTriggerScaleUp:
+			if last.After(notTriggered) {
+				notTriggered = last
+			}
+		}
+	}
+	return !triggered.IsZero() && triggered.After(notTriggered) && now.Sub(triggered) < scaleUpTimeout
+}
+
+// eventTime returns when the event was observed last.
+func eventTime(event *v1.Event) time.Time {
+	switch {
+	case event.Series != nil:
+		return event.Series.LastObservedTime.Time
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.FirstTimestamp.Time
+}
+
+// enqueueUnscheduledPod queues the pod to run the unscheduled policy again.
+func (m *Manager) enqueueUnscheduledPod(pod *v1.Pod) {
+	m.enqueueDelayedOverflow(pod, 0)
+}
+
+func (m *Manager) enqueueDelayedOverflow(pod *v1.Pod, delay time.Duration) {
+	key, err := cache.MetaNamespaceKeyFunc(pod)
+	if err != nil {
+		klog.Errorf("failed to get key of pod %s/%s: %q", pod.Namespace, pod.Name, err)
+		return
+	}
+	m.overflowQueue.AddAfter(key, delay)
+}
+
+func (m *Manager) runOverflowWorkers(ctx context.Context) {
+	for i := 0; i < overflowWorkers; i++ {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			for m.processNextDelayedOverflow() {
+			}
+		}, time.Second)
+	}
+	<-ctx.Done()
+	m.overflowQueue.ShutDown()
+}
+
+func (m *Manager) processNextDelayedOverflow() bool {
+	key, quit := m.overflowQueue.Get()
+	if quit {
+		return false
+	}
+	defer m.overflowQueue.Done(key)
+
+	err := m.syncDelayedOverflow(key.(string))
+	if err == nil {
+		m.overflowQueue.Forget(key)
+		return true
+	}
+	if m.overflowQueue.NumRequeues(key) < maxScheduledRetries {
+		klog.Warningf("failed to execute unscheduled policy for pod %s, retry it: %q", key, err)
+		m.overflowQueue.AddRateLimited(key)
+		return true
+	}
+	klog.Errorf("failed to execute unscheduled policy for pod %s, drop it: %q", key, err)
+	m.overflowQueue.Forget(key)
+	return true
+}
+
+func (m *Manager) syncDelayedOverflow(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	pod, err := m.resourceManager.GetPod(namespace, name)
+	if err != nil {
+		if api_errors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to get pod")
+	}
+	if pod.Spec.NodeName != "" || pod.DeletionTimestamp != nil || !isUnscheduledPod(pod) {
+		return nil
+	}
+	return m.onPodUnscheduled(pod)
+}
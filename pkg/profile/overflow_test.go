@@ -0,0 +1,152 @@
+package profile
+
+import (
+	"testing"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestDelayOverflow(t *testing.T) {
+	now := time.Now()
+	selector := &eciv1.Selector{Spec: eciv1.SelectorSpec{Policy: &eciv1.PolicySource{
+		NormalNodePrefer: &eciv1.NormalNodePreferPolicySource{OverflowDelay: &metav1.Duration{Duration: time.Minute}},
+	}}}
+	pod := &v1.Pod{Status: v1.PodStatus{Conditions: []v1.PodCondition{{
+		Type:               v1.PodScheduled,
+		Status:             v1.ConditionFalse,
+		Reason:             v1.PodReasonUnschedulable,
+		LastTransitionTime: metav1.NewTime(now.Add(-20 * time.Second)),
+	}}}}
+
+	m := &Manager{}
+	delay, err := m.delayOverflow(selector, pod, now)
+	if err != nil || delay != 40*time.Second {
+		t.Errorf("expect the overflow delayed for 40s, but got %v, %v", delay, err)
+	}
+	// the selector without overflow delay overflows at once
+	selector.Spec.Policy.NormalNodePrefer.OverflowDelay = nil
+	if delay, err := m.delayOverflow(selector, pod, now); err != nil || delay != 0 {
+		t.Errorf("expect no delay, but got %v, %v", delay, err)
+	}
+}
+
+func TestIsScaleUpActive(t *testing.T) {
+	now := time.Now()
+	newEvent := func(reason string, ago time.Duration) v1.Event {
+		return v1.Event{Reason: reason, LastTimestamp: metav1.NewTime(now.Add(-ago))}
+	}
+	for desc, test := range map[string]struct {
+		events []v1.Event
+		expect bool
+	}{
+		"no events": {},
+		"triggered": {
+			events: []v1.Event{newEvent(eventReasonTriggeredScaleUp, time.Minute)},
+			expect: true,
+		},
+		"timed out": {
+			events: []v1.Event{newEvent(eventReasonTriggeredScaleUp, time.Hour)},
+		},
+		"failed after triggered": {
+			events: []v1.Event{
+				newEvent(eventReasonTriggeredScaleUp, 2*time.Minute),
+				newEvent(eventReasonNotTriggerScaleUp, time.Minute),
+			},
+		},
+		"triggered again": {
+			events: []v1.Event{
+				newEvent(eventReasonNotTriggerScaleUp, 2*time.Minute),
+				newEvent(eventReasonTriggeredScaleUp, time.Minute),
+			},
+			expect: true,
+		},
+	} {
+		if actual := isScaleUpActive(test.events, now); actual != test.expect {
+			t.Errorf("%s: expect %v, but got %v", desc, test.expect, actual)
+		}
+	}
+}
+
+func TestAllowOverflow(t *testing.T) {
+	selector := newTestSelector("prefer", eciv1.SelectorSpec{Policy: &eciv1.PolicySource{
+		NormalNodePrefer: &eciv1.NormalNodePreferPolicySource{},
+	}})
+	newPod := func(name, message string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)},
+			Status: v1.PodStatus{Conditions: []v1.PodCondition{{
+				Type:    v1.PodScheduled,
+				Status:  v1.ConditionFalse,
+				Reason:  v1.PodReasonUnschedulable,
+				Message: message,
+			}}},
+		}
+	}
+	newEvent := func(pod *v1.Pod, message string) *v1.Event {
+		return &v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: pod.Name + ".failed", Namespace: pod.Namespace},
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID},
+			Reason:         eventReasonFailedScheduling,
+			Message:        message,
+		}
+	}
+	capacity := newPod("capacity", "0/3 nodes are available: 2 Insufficient cpu, 1 node(s) had untolerated taint {node-role.kubernetes.io/master: }.")
+	volume := newPod("volume", "0/3 nodes are available: 2 Insufficient cpu, 1 node(s) had volume node affinity conflict.")
+	unknown := newPod("unknown", "0/3 nodes are available.")
+	m := newTestManager(t, []runtime.Object{
+		capacity, volume, unknown,
+		newEvent(unknown, "0/3 nodes are available: 3 Insufficient memory."),
+		newEvent(volume, "0/3 nodes are available: 3 Insufficient memory."),
+	}, nil)
+
+	for pod, expect := range map[*v1.Pod]bool{
+		capacity: true,
+		volume:   false,
+		unknown:  true,
+	} {
+		allowed, reasons, err := m.allowOverflow(selector, pod)
+		if err != nil {
+			t.Fatalf("[%s] failed to classify: %v", pod.Name, err)
+		}
+		if allowed != expect {
+			t.Errorf("[%s] expect allowed %v, but got %v for %v", pod.Name, expect, allowed, reasons)
+		}
+	}
+}
+
+func TestDelayOverflowForScaleUp(t *testing.T) {
+	now := time.Now()
+	selector := newTestSelector("prefer", eciv1.SelectorSpec{Policy: &eciv1.PolicySource{
+		NormalNodePrefer: &eciv1.NormalNodePreferPolicySource{OverflowDelay: &metav1.Duration{Duration: time.Minute}},
+	}})
+	newPod := func(name string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)},
+			Status: v1.PodStatus{Conditions: []v1.PodCondition{{
+				Type:               v1.PodScheduled,
+				Status:             v1.ConditionFalse,
+				Reason:             v1.PodReasonUnschedulable,
+				LastTransitionTime: metav1.NewTime(now.Add(-2 * time.Minute)),
+			}}},
+		}
+	}
+	scalingUp, idle := newPod("scaling-up"), newPod("idle")
+	m := newTestManager(t, []runtime.Object{scalingUp, idle, &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "scaling-up.triggered", Namespace: "default"},
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: scalingUp.Name, UID: scalingUp.UID},
+		Reason:         eventReasonTriggeredScaleUp,
+		LastTimestamp:  metav1.NewTime(now.Add(-time.Minute)),
+	}}, nil)
+
+	if delay, err := m.delayOverflow(selector, scalingUp, now); err != nil || delay != scaleUpRecheckPeriod {
+		t.Errorf("expect the overflow delayed by the scale-up, but got %v, %v", delay, err)
+	}
+	if delay, err := m.delayOverflow(selector, idle, now); err != nil || delay != 0 {
+		t.Errorf("expect no delay, but got %v, %v", delay, err)
+	}
+}
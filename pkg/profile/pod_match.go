@@ -0,0 +1,92 @@
+package profile
+
+import (
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	defaultServiceAccountName = "default"
+	defaultSchedulerName      = v1.DefaultSchedulerName
+)
+
+// matchPodFields reports whether the pod satisfies all the criteria of the
+// pod match, a nil pod match matches every pod.
+func matchPodFields(podMatch *eciv1.PodMatch, pod *v1.Pod) bool {
+	if podMatch == nil {
+		return true
+	}
+	if len(podMatch.OwnerKinds) > 0 || len(podMatch.OwnerNames) > 0 {
+		owner := metav1.GetControllerOf(pod)
+		if owner == nil {
+			return false
+		}
+		if len(podMatch.OwnerKinds) > 0 && !containsString(podMatch.OwnerKinds, owner.Kind) {
+			return false
+		}
+		if len(podMatch.OwnerNames) > 0 && !containsString(podMatch.OwnerNames, owner.Name) {
+			return false
+		}
+	}
+	if len(podMatch.QOSClasses) > 0 {
+		qosClass := utils.PodQOSClass(pod)
+		found := false
+		for _, class := range podMatch.QOSClasses {
+			if class == qosClass {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(podMatch.PriorityClassNames) > 0 && !containsString(podMatch.PriorityClassNames, pod.Spec.PriorityClassName) {
+		return false
+	}
+	if len(podMatch.ServiceAccountNames) > 0 && !containsString(podMatch.ServiceAccountNames, valueOrDefault(pod.Spec.ServiceAccountName, defaultServiceAccountName)) {
+		return false
+	}
+	if len(podMatch.SchedulerNames) > 0 && !containsString(podMatch.SchedulerNames, valueOrDefault(pod.Spec.SchedulerName, defaultSchedulerName)) {
+		return false
+	}
+	if len(podMatch.MinRequests) > 0 || len(podMatch.MaxRequests) > 0 {
+		requests := utils.PodRequests(pod)
+		if !matchResourceRange(requests, podMatch.MinRequests, podMatch.MaxRequests, false) {
+			return false
+		}
+	}
+	if len(podMatch.MinLimits) > 0 || len(podMatch.MaxLimits) > 0 {
+		limits := utils.PodLimits(pod)
+		if !matchResourceRange(limits, podMatch.MinLimits, podMatch.MaxLimits, true) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchResourceRange checks the resources against the thresholds, a missing
+// resource is regarded as zero, or as unbounded for limits.
+func matchResourceRange(resources, min, max v1.ResourceList, unbounded bool) bool {
+	for name, threshold := range min {
+		value, ok := resources[name]
+		if !ok && unbounded {
+			continue
+		}
+		if value.Cmp(threshold) < 0 {
+			return false
+		}
+	}
+	for name, threshold := range max {
+		value, ok := resources[name]
+		if !ok && unbounded {
+			return false
+		}
+		if value.Cmp(threshold) > 0 {
+			return false
+		}
+	}
+	return true
+}
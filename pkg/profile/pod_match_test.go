@@ -0,0 +1,128 @@
+package profile
+
+import (
+	"testing"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newMatchTestPod(requests, limits v1.ResourceList) *v1.Pod {
+	isController := true
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Job", Name: "job-1", Controller: &isController},
+			},
+		},
+		Spec: v1.PodSpec{
+			PriorityClassName: "batch-low",
+			Containers: []v1.Container{
+				{Name: "c", Resources: v1.ResourceRequirements{Requests: requests, Limits: limits}},
+			},
+		},
+	}
+}
+
+func TestMatchPodFields(t *testing.T) {
+	burstable := newMatchTestPod(v1.ResourceList{v1.ResourceCPU: resource.MustParse("10")}, nil)
+	guaranteed := newMatchTestPod(
+		v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")},
+		v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")},
+	)
+	bestEffort := newMatchTestPod(nil, nil)
+	bestEffort.OwnerReferences = nil
+
+	for desc, test := range map[string]struct {
+		podMatch *eciv1.PodMatch
+		pod      *v1.Pod
+		expect   bool
+	}{
+		"nil match": {
+			pod:    bestEffort,
+			expect: true,
+		},
+		"owner kind matched": {
+			podMatch: &eciv1.PodMatch{OwnerKinds: []string{"Job"}},
+			pod:      burstable,
+			expect:   true,
+		},
+		"owner name not matched": {
+			podMatch: &eciv1.PodMatch{OwnerKinds: []string{"Job"}, OwnerNames: []string{"job-2"}},
+			pod:      burstable,
+			expect:   false,
+		},
+		"no owner": {
+			podMatch: &eciv1.PodMatch{OwnerKinds: []string{"Job"}},
+			pod:      bestEffort,
+			expect:   false,
+		},
+		"best effort": {
+			podMatch: &eciv1.PodMatch{QOSClasses: []v1.PodQOSClass{v1.PodQOSBestEffort}},
+			pod:      bestEffort,
+			expect:   true,
+		},
+		"guaranteed": {
+			podMatch: &eciv1.PodMatch{QOSClasses: []v1.PodQOSClass{v1.PodQOSGuaranteed}},
+			pod:      guaranteed,
+			expect:   true,
+		},
+		"burstable isn't guaranteed": {
+			podMatch: &eciv1.PodMatch{QOSClasses: []v1.PodQOSClass{v1.PodQOSGuaranteed}},
+			pod:      burstable,
+			expect:   false,
+		},
+		"priority class": {
+			podMatch: &eciv1.PodMatch{PriorityClassNames: []string{"batch-low"}},
+			pod:      burstable,
+			expect:   true,
+		},
+		"default service account": {
+			podMatch: &eciv1.PodMatch{ServiceAccountNames: []string{"default"}},
+			pod:      burstable,
+			expect:   true,
+		},
+		"default scheduler not matched": {
+			podMatch: &eciv1.PodMatch{SchedulerNames: []string{"volcano"}},
+			pod:      burstable,
+			expect:   false,
+		},
+		"min requests matched": {
+			podMatch: &eciv1.PodMatch{MinRequests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("8")}},
+			pod:      burstable,
+			expect:   true,
+		},
+		"min requests not matched": {
+			podMatch: &eciv1.PodMatch{MinRequests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("8")}},
+			pod:      guaranteed,
+			expect:   false,
+		},
+		"max requests of missing resource": {
+			podMatch: &eciv1.PodMatch{MaxRequests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")}},
+			pod:      burstable,
+			expect:   true,
+		},
+		"max limits of unlimited pod": {
+			podMatch: &eciv1.PodMatch{MaxLimits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}},
+			pod:      burstable,
+			expect:   false,
+		},
+		"all criteria are ANDed": {
+			podMatch: &eciv1.PodMatch{
+				OwnerKinds:  []string{"Job"},
+				MaxLimits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+				MinRequests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("2Gi")},
+			},
+			pod:    guaranteed,
+			expect: false,
+		},
+	} {
+		if actual := matchPodFields(test.podMatch, test.pod); actual != test.expect {
+			t.Errorf("%s: expect %v, but got %v", desc, test.expect, actual)
+		}
+	}
+}
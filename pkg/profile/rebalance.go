@@ -0,0 +1,244 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/metrics"
+	"eci.io/eci-profile/pkg/policy"
+	v1 "k8s.io/api/core/v1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// rebalanceSyncPeriod is how often the overflowed pods are checked.
+	rebalanceSyncPeriod = 30 * time.Second
+
+	defaultRebalanceMaxEvictions      = 1
+	defaultRebalanceInterval          = 5 * time.Minute
+	defaultRebalanceMinVirtualNodeAge = 10 * time.Minute
+
+	// EventReasonRebalanced is recorded on the pods evicted from virtual nodes
+	// since they fit on the normal nodes again.
+	EventReasonRebalanced = "RebalancedToNormalNode"
+)
+
+// rebalanceBudget counts the evictions of a selector in the current interval.
+type rebalanceBudget struct {
+	start     time.Time
+	evictions int32
+}
+
+type rebalanceCandidate struct {
+	pod      *v1.Pod
+	selector *eciv1.Selector
+	age      time.Duration
+}
+
+func rebalancePolicy(selector *eciv1.Selector) *eciv1.RebalancePolicy {
+	if selector.Spec.Policy == nil || selector.Spec.Policy.NormalNodePrefer == nil {
+		return nil
+	}
+	return selector.Spec.Policy.NormalNodePrefer.Rebalance
+}
+
+func rebalanceSettings(rebalance *eciv1.RebalancePolicy) (maxEvictions int32, interval, minAge time.Duration) {
+	maxEvictions, interval, minAge = defaultRebalanceMaxEvictions, defaultRebalanceInterval, defaultRebalanceMinVirtualNodeAge
+	if rebalance.MaxEvictionsPerInterval != nil {
+		maxEvictions = *rebalance.MaxEvictionsPerInterval
+	}
+	if rebalance.Interval != nil {
+		interval = rebalance.Interval.Duration
+	}
+	if rebalance.MinVirtualNodeAge != nil {
+		minAge = rebalance.MinVirtualNodeAge.Duration
+	}
+	return maxEvictions, interval, minAge
+}
+
+// runRebalancer evicts the pods overflowed to virtual nodes by the
+// NormalNodePrefer selectors opting in, once they fit on the normal nodes again.
+// The replacements created by their controllers prefer the normal nodes.
+func (m *Manager) runRebalancer(ctx context.Context) {
+	budgets := map[types.UID]*rebalanceBudget{}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		m.rebalance(ctx, budgets)
+	}, rebalanceSyncPeriod)
+}
+
+func (m *Manager) rebalance(ctx context.Context, budgets map[types.UID]*rebalanceBudget) {
+	selectors, err := m.resourceManager.ListSelectors()
+	if err != nil {
+		klog.Errorf("failed to list selectors: %q", err)
+		return
+	}
+	now := time.Now()
+	rebalancing := map[types.UID]*eciv1.Selector{}
+	for _, selector := range selectors {
+		rebalance := rebalancePolicy(selector)
+		if rebalance == nil || isAuditMode(selector) {
+			continue
+		}
+		rebalancing[selector.UID] = selector
+		_, interval, _ := rebalanceSettings(rebalance)
+		if budget, ok := budgets[selector.UID]; !ok || now.Sub(budget.start) >= interval {
+			budgets[selector.UID] = &rebalanceBudget{start: now}
+		}
+	}
+	for uid := range budgets {
+		if rebalancing[uid] == nil {
+			delete(budgets, uid)
+		}
+	}
+	if len(rebalancing) == 0 {
+		return
+	}
+
+	capacities, err := m.normalNodeCapacities()
+	if err != nil {
+		klog.Errorf("failed to compute the capacity of normal nodes: %q", err)
+		return
+	}
+	if len(capacities) == 0 {
+		return
+	}
+	candidates, err := m.rebalanceCandidates(rebalancing, budgets, now)
+	if err != nil {
+		klog.Errorf("failed to find the pods to rebalance: %q", err)
+		return
+	}
+	for _, candidate := range candidates {
+		selector, pod := candidate.selector, candidate.pod
+		budget := budgets[selector.UID]
+		maxEvictions, _, _ := rebalanceSettings(rebalancePolicy(selector))
+		if budget.evictions >= maxEvictions {
+			continue
+		}
+		capacity := findNodeCapacity(capacities, pod)
+		if capacity == nil {
+			continue
+		}
+		if err := m.evictPod(ctx, pod); err != nil {
+			switch {
+			case api_errors.IsTooManyRequests(err):
+				klog.V(3).Infof("eviction of pod %s/%s is blocked by the PodDisruptionBudget: %v", pod.Namespace, pod.Name, err)
+			case isPodNotFound(err, pod):
+			default:
+				klog.Errorf("failed to evict pod %s/%s(%s): %q", pod.Namespace, pod.Name, pod.UID, err)
+			}
+			continue
+		}
+		capacity.Reserve(pod)
+		budget.evictions++
+		klog.Infof("the pod %s/%s is evicted from virtual node %s, it fits on node %s (matched: %s)", pod.Namespace, pod.Name, pod.Spec.NodeName, capacity.Node.Name, selector.Name)
+		metrics.RebalancedPods.WithLabelValues(selector.Name).Inc()
+		m.eventRecorder.Event(pod, v1.EventTypeNormal, EventReasonRebalanced,
+			fmt.Sprintf("evicted from virtual node %s by selector %s since it fits on the normal nodes", pod.Spec.NodeName, selector.Name))
+	}
+}
+
+// normalNodeCapacities returns the free resources of the schedulable normal
+// nodes, less the requests of the pending pods fitting on them. The pending
+// pods are scheduled before the replacements of the evicted pods, so their
+// capacity isn't freed for rebalancing.
+func (m *Manager) normalNodeCapacities() ([]*policy.NodeCapacity, error) {
+	nodes, err := m.resourceManager.ListNodes()
+	if err != nil {
+		return nil, err
+	}
+	pods, err := m.resourceManager.ListPods("")
+	if err != nil {
+		return nil, err
+	}
+	podsByNode := map[string][]*v1.Pod{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" {
+			podsByNode[pod.Spec.NodeName] = append(podsByNode[pod.Spec.NodeName], pod)
+		}
+	}
+	var capacities []*policy.NodeCapacity
+	for _, node := range nodes {
+		if m.policyManager.IsVirtualNode(node) || !policy.IsSchedulable(node) {
+			continue
+		}
+		capacities = append(capacities, policy.NewNodeCapacity(node, podsByNode[node.Name]))
+	}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" || pod.DeletionTimestamp != nil || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if capacity := findNodeCapacity(capacities, pod); capacity != nil {
+			capacity.Reserve(pod)
+		}
+	}
+	return capacities, nil
+}
+
+// rebalanceCandidates returns the running pods on virtual nodes matched by the
+// rebalancing selectors with budget left, the oldest first.
+func (m *Manager) rebalanceCandidates(rebalancing map[types.UID]*eciv1.Selector, budgets map[types.UID]*rebalanceBudget, now time.Time) ([]rebalanceCandidate, error) {
+	pods, err := m.resourceManager.ListPods("")
+	if err != nil {
+		return nil, err
+	}
+	var candidates []rebalanceCandidate
+	for _, pod := range pods {
+		if !isEvictable(pod) || !m.isRunningOnVirtualNode(pod) {
+			continue
+		}
+		selector, _, err := m.matchSelectorForPod(pod)
+		if err != nil {
+			klog.Errorf("failed to match selector for pod %s/%s: %q", pod.Namespace, pod.Name, err)
+			continue
+		}
+		if selector == nil || rebalancing[selector.UID] == nil {
+			continue
+		}
+		maxEvictions, _, minAge := rebalanceSettings(rebalancePolicy(selector))
+		age := now.Sub(scheduledTime(pod))
+		if age < minAge || budgets[selector.UID].evictions >= maxEvictions {
+			continue
+		}
+		candidates = append(candidates, rebalanceCandidate{pod: pod, selector: selector, age: age})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].age > candidates[j].age
+	})
+	return candidates, nil
+}
+
+// isEvictable reports whether the pod is recreated by a controller once it's
+// evicted, the pods of DaemonSets are bound to their nodes.
+func isEvictable(pod *v1.Pod) bool {
+	owner := metav1.GetControllerOf(pod)
+	return owner != nil && owner.Kind != "DaemonSet"
+}
+
+// scheduledTime returns when the pod was bound to its node.
+func scheduledTime(pod *v1.Pod) time.Time {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionTrue && !condition.LastTransitionTime.IsZero() {
+			return condition.LastTransitionTime.Time
+		}
+	}
+	if pod.Status.StartTime != nil {
+		return pod.Status.StartTime.Time
+	}
+	return pod.CreationTimestamp.Time
+}
+
+func findNodeCapacity(capacities []*policy.NodeCapacity, pod *v1.Pod) *policy.NodeCapacity {
+	for _, capacity := range capacities {
+		if capacity.Fits(pod) {
+			return capacity
+		}
+	}
+	return nil
+}
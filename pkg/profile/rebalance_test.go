@@ -0,0 +1,238 @@
+package profile
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRebalanceSettings(t *testing.T) {
+	maxEvictions, interval, minAge := rebalanceSettings(&eciv1.RebalancePolicy{})
+	if maxEvictions != defaultRebalanceMaxEvictions || interval != defaultRebalanceInterval || minAge != defaultRebalanceMinVirtualNodeAge {
+		t.Errorf("expect the default settings, but got %d, %v, %v", maxEvictions, interval, minAge)
+	}
+	three := int32(3)
+	maxEvictions, interval, minAge = rebalanceSettings(&eciv1.RebalancePolicy{
+		MaxEvictionsPerInterval: &three,
+		Interval:                &metav1.Duration{Duration: time.Minute},
+		MinVirtualNodeAge:       &metav1.Duration{Duration: time.Hour},
+	})
+	if maxEvictions != 3 || interval != time.Minute || minAge != time.Hour {
+		t.Errorf("unexpected settings: %d, %v, %v", maxEvictions, interval, minAge)
+	}
+}
+
+func TestIsEvictable(t *testing.T) {
+	isController := true
+	for desc, test := range map[string]struct {
+		owners []metav1.OwnerReference
+		expect bool
+	}{
+		"bare pod": {},
+		"replicaset": {
+			owners: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "nginx", Controller: &isController}},
+			expect: true,
+		},
+		"daemonset": {
+			owners: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "agent", Controller: &isController}},
+		},
+	} {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: test.owners}}
+		if actual := isEvictable(pod); actual != test.expect {
+			t.Errorf("%s: expect %v, but got %v", desc, test.expect, actual)
+		}
+	}
+}
+
+func TestScheduledTime(t *testing.T) {
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	scheduled := created.Add(time.Minute)
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)}}
+	if actual := scheduledTime(pod); !actual.Equal(created) {
+		t.Errorf("expect the creation time, but got %v", actual)
+	}
+	pod.Status.Conditions = []v1.PodCondition{
+		{Type: v1.PodScheduled, Status: v1.ConditionTrue, LastTransitionTime: metav1.NewTime(scheduled)},
+	}
+	if actual := scheduledTime(pod); !actual.Equal(scheduled) {
+		t.Errorf("expect the scheduled time, but got %v", actual)
+	}
+}
+
+// newNormalNode returns a ready normal node with the allocatable CPU.
+func newNormalNode(name, cpu string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu), v1.ResourcePods: resource.MustParse("110")},
+			Conditions:  []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+		},
+	}
+}
+
+// evictionRecorder records the pods evicted through the fake clientset, and
+// refuses the evictions of the blocked pods with TooManyRequests.
+func evictionRecorder(client *fake.Clientset, blocked map[string]bool) *[]string {
+	var evicted []string
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		object := action.(k8stesting.CreateAction).GetObject()
+		name := object.(metav1.Object).GetName()
+		if blocked[name] {
+			return true, nil, api_errors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 10)
+		}
+		if _, ok := object.(*policyv1beta1.Eviction); ok {
+			name = "v1beta1/" + name
+		}
+		evicted = append(evicted, name)
+		return true, nil, nil
+	})
+	return &evicted
+}
+
+func TestRebalance(t *testing.T) {
+	isController := true
+	now := time.Now()
+	newPod := func(name, cpu, nodeName string, age time.Duration) *v1.Pod {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				UID:               types.UID(name),
+				Labels:            map[string]string{"app": "nginx"},
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				OwnerReferences:   []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "nginx", Controller: &isController}},
+			},
+			Spec: v1.PodSpec{
+				NodeName: nodeName,
+				Containers: []v1.Container{{Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu)},
+				}}},
+			},
+			Status: v1.PodStatus{Phase: v1.PodRunning},
+		}
+		if nodeName == "" {
+			pod.Status = v1.PodStatus{Phase: v1.PodPending}
+		}
+		return pod
+	}
+	two := int32(2)
+	selector := newTestSelector("prefer", eciv1.SelectorSpec{
+		ObjectLabels: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}},
+		Policy: &eciv1.PolicySource{NormalNodePrefer: &eciv1.NormalNodePreferPolicySource{
+			Rebalance: &eciv1.RebalancePolicy{
+				MaxEvictionsPerInterval: &two,
+				MinVirtualNodeAge:       &metav1.Duration{Duration: time.Minute},
+			},
+		}},
+	})
+
+	for desc, test := range map[string]struct {
+		pods            []*v1.Pod
+		blocked         map[string]bool
+		evictionV1beta1 bool
+		expect          []string
+	}{
+		"evict the oldest pods fitting on normal nodes": {
+			pods: []*v1.Pod{
+				newPod("old", "2", "vnode", time.Hour),
+				newPod("older", "2", "vnode", 2*time.Hour),
+				newPod("oldest", "8", "vnode", 3*time.Hour),
+				newPod("young", "1", "vnode", 0),
+			},
+			expect: []string{"old", "older"},
+		},
+		"the pending pods take the free capacity first": {
+			pods: []*v1.Pod{
+				newPod("old", "2", "vnode", time.Hour),
+				newPod("older", "2", "vnode", 2*time.Hour),
+				newPod("pending", "3", "", 0),
+			},
+		},
+		"the pending pods not fitting take nothing": {
+			pods: []*v1.Pod{
+				newPod("old", "2", "vnode", time.Hour),
+				newPod("pending", "5", "", 0),
+			},
+			expect: []string{"old"},
+		},
+		"blocked by the PodDisruptionBudget": {
+			pods: []*v1.Pod{
+				newPod("old", "2", "vnode", time.Hour),
+				newPod("older", "2", "vnode", 2*time.Hour),
+			},
+			blocked: map[string]bool{"older": true},
+			expect:  []string{"old"},
+		},
+		"policy/v1 not served": {
+			pods:            []*v1.Pod{newPod("old", "2", "vnode", time.Hour)},
+			evictionV1beta1: true,
+			expect:          []string{"v1beta1/old"},
+		},
+	} {
+		objects := []runtime.Object{newVirtualNode("vnode"), newNormalNode("node", "4")}
+		for _, pod := range test.pods {
+			objects = append(objects, pod)
+		}
+		m := newTestManager(t, objects, []runtime.Object{selector})
+		client := m.k8sClient.(*fake.Clientset)
+		if test.evictionV1beta1 {
+			client.Resources = []*metav1.APIResourceList{{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{
+					{Name: "pods", Namespaced: true, Kind: "Pod"},
+					{Name: "pods/eviction", Namespaced: true, Group: "policy", Version: "v1beta1", Kind: "Eviction"},
+				},
+			}}
+		}
+		evicted := evictionRecorder(client, test.blocked)
+
+		m.rebalance(context.TODO(), map[types.UID]*rebalanceBudget{})
+		sort.Strings(*evicted)
+		if !reflect.DeepEqual(*evicted, test.expect) && (len(*evicted) != 0 || len(test.expect) != 0) {
+			t.Errorf("[%s] expect evicted %v, but got %v", desc, test.expect, *evicted)
+		}
+	}
+}
+
+func TestIsPodNotFound(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	for desc, test := range map[string]struct {
+		err    error
+		expect bool
+	}{
+		"pod not found": {
+			err:    api_errors.NewNotFound(v1.Resource("pods"), "foo"),
+			expect: true,
+		},
+		"another pod not found": {
+			err: api_errors.NewNotFound(v1.Resource("pods"), "bar"),
+		},
+		"eviction not served": {
+			err: api_errors.NewNotFound(schema.GroupResource{Group: "policy", Resource: "evictions"}, ""),
+		},
+		"blocked": {
+			err: api_errors.NewTooManyRequests("blocked", 10),
+		},
+	} {
+		if actual := isPodNotFound(test.err, pod); actual != test.expect {
+			t.Errorf("[%s] expect %v, but got %v", desc, test.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package profile
+
+import (
+	"hash/fnv"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/policy"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+)
+
+const rolloutKeyLength = 10
+
+// inRollout reports whether the pod is in the rollout cohort of the selector.
+// The cohort is chosen by a stable hash of the owner UID and the pod name, so
+// the same pods stay in it while the percentage is unchanged or raised.
+func inRollout(selector *eciv1.Selector, pod *v1.Pod) bool {
+	percent := selector.Spec.RolloutPercent
+	if percent == nil || *percent >= 100 {
+		return true
+	}
+	if *percent <= 0 {
+		return false
+	}
+	return rolloutBucket(pod) < uint32(*percent)
+}
+
+// rolloutBucket maps the pod into [0, 100).
+func rolloutBucket(pod *v1.Pod) uint32 {
+	key := pod.Annotations[eciv1.AnnotationRolloutKey]
+	if key == "" {
+		key = pod.Name
+	}
+	owner := pod.Namespace
+	if ref := metav1.GetControllerOf(pod); ref != nil {
+		owner = string(ref.UID)
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(owner))
+	hash.Write([]byte{'/'})
+	hash.Write([]byte(key))
+	return hash.Sum32() % 100
+}
+
+// withRolloutKey returns a copy of the pod holding a random rollout key when
+// the pod isn't named yet and matches any selector rolling out partially, the
+// key must be persisted so that the later phases see the same cohort.
+func (m *Manager) withRolloutKey(pod *v1.Pod) (*v1.Pod, string, error) {
+	if pod.Name != "" || pod.Annotations[eciv1.AnnotationRolloutKey] != "" {
+		return pod, "", nil
+	}
+	partial, err := m.matchPartialRollout(pod)
+	if err != nil || !partial {
+		return pod, "", err
+	}
+	key := utilrand.String(rolloutKeyLength)
+	keyed := pod.DeepCopy()
+	if keyed.Annotations == nil {
+		keyed.Annotations = map[string]string{}
+	}
+	keyed.Annotations[eciv1.AnnotationRolloutKey] = key
+	return keyed, key, nil
+}
+
+// matchPartialRollout reports whether the pod matches any selector rolling out
+// partially, regardless of the cohort which isn't known before the key.
+func (m *Manager) matchPartialRollout(pod *v1.Pod) (bool, error) {
+	selectors, err := m.resourceManager.ListSelectors()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to list selectors")
+	}
+	pinned := pod.Annotations[eciv1.AnnotationSelector]
+	now := time.Now()
+	for _, selector := range selectors {
+		percent := selector.Spec.RolloutPercent
+		if percent == nil || *percent <= 0 || *percent >= 100 {
+			continue
+		}
+		if pinned != "" && selector.Name != pinned {
+			continue
+		}
+		if m.selectors.validate(selector) != nil || !m.isSelectorActive(selector, now) {
+			continue
+		}
+		matched, err := m.matchPod(selector, pod)
+		if err != nil {
+			return false, errors.Wrap(err, "match pod failed")
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// appendRolloutKeyPatch appends the operation persisting the rollout key to
+// the patches computed against the original pod.
+func appendRolloutKeyPatch(pod *v1.Pod, patchInfos []policy.PatchInfo, key string) []policy.PatchInfo {
+	return policy.AppendAnnotationPatch(pod, patchInfos, eciv1.AnnotationRolloutKey, key)
+}
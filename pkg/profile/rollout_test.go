@@ -0,0 +1,128 @@
+package profile
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/policy"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// rolloutKeyPath is the escaped JSON pointer of the rollout key annotation
+const rolloutKeyPath = "/metadata/annotations/eci.aliyun.com~1rollout-key"
+
+func newRolloutSelector(percent *int32) *eciv1.Selector {
+	return &eciv1.Selector{Spec: eciv1.SelectorSpec{RolloutPercent: percent}}
+}
+
+func newRolloutPod(name string) *v1.Pod {
+	isController := true
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      name,
+		Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{
+			{Kind: "ReplicaSet", Name: "nginx", UID: "owner-uid", Controller: &isController},
+		},
+	}}
+}
+
+func TestInRollout(t *testing.T) {
+	int0, int30, int60, int100 := int32(0), int32(30), int32(60), int32(100)
+	pod := newRolloutPod("nginx-abcde")
+	if !inRollout(newRolloutSelector(nil), pod) || !inRollout(newRolloutSelector(&int100), pod) {
+		t.Errorf("expect every pod in the full rollout")
+	}
+	if inRollout(newRolloutSelector(&int0), pod) {
+		t.Errorf("expect no pod in the empty rollout")
+	}
+
+	selected := 0
+	for i := 0; i < 1000; i++ {
+		pod := newRolloutPod(fmt.Sprintf("nginx-%d", i))
+		in30 := inRollout(newRolloutSelector(&int30), pod)
+		if in30 != inRollout(newRolloutSelector(&int30), pod) {
+			t.Fatalf("expect the same cohort of pod %s", pod.Name)
+		}
+		if in30 && !inRollout(newRolloutSelector(&int60), pod) {
+			t.Errorf("expect pod %s to stay in the cohort when the percentage is raised", pod.Name)
+		}
+		if in30 {
+			selected++
+		}
+	}
+	if selected < 230 || selected > 370 {
+		t.Errorf("expect about 300 of 1000 pods in the 30%% rollout, but got %d", selected)
+	}
+
+	// the rollout key takes the place of the name not generated yet
+	keyed := newRolloutPod("")
+	keyed.Annotations = map[string]string{eciv1.AnnotationRolloutKey: "nginx-abcde"}
+	if rolloutBucket(keyed) != rolloutBucket(pod) {
+		t.Errorf("expect the rollout key to be hashed as the pod name")
+	}
+}
+
+func TestAppendRolloutKeyPatch(t *testing.T) {
+	addAnnotations := policy.PatchInfo{Op: "add", Path: "/metadata/annotations", Value: map[string]string{"foo": "bar"}}
+	for desc, test := range map[string]struct {
+		annotations map[string]string
+		patchInfos  []policy.PatchInfo
+		expect      policy.PatchInfo
+	}{
+		"no annotations": {
+			expect: policy.PatchInfo{Op: "add", Path: "/metadata/annotations", Value: map[string]string{eciv1.AnnotationRolloutKey: "key"}},
+		},
+		"annotations added by effect": {
+			patchInfos: []policy.PatchInfo{addAnnotations},
+			expect:     policy.PatchInfo{Op: "add", Path: rolloutKeyPath, Value: "key"},
+		},
+		"existing annotations": {
+			annotations: map[string]string{"foo": "bar"},
+			expect:      policy.PatchInfo{Op: "add", Path: rolloutKeyPath, Value: "key"},
+		},
+	} {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+		patchInfos := appendRolloutKeyPatch(pod, test.patchInfos, "key")
+		if actual := patchInfos[len(patchInfos)-1]; !reflect.DeepEqual(actual, test.expect) {
+			t.Errorf("%s: expect %v, but got %v", desc, test.expect, actual)
+		}
+	}
+}
+
+func TestWithRolloutKey(t *testing.T) {
+	int30 := int32(30)
+	selector := newTestSelector("partial", eciv1.SelectorSpec{
+		ObjectLabels:   &metav1.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}},
+		RolloutPercent: &int30,
+	})
+	m := newTestManager(t, nil, []runtime.Object{selector})
+
+	for desc, test := range map[string]struct {
+		labels map[string]string
+		expect bool
+	}{
+		"matched pod":   {labels: map[string]string{"app": "nginx"}, expect: true},
+		"unmatched pod": {labels: map[string]string{"app": "redis"}, expect: false},
+	} {
+		pod := newRolloutPod("")
+		pod.GenerateName = "nginx-"
+		pod.Labels = test.labels
+		keyed, key, err := m.withRolloutKey(pod)
+		if err != nil {
+			t.Fatalf("[%s] failed to key the pod: %v", desc, err)
+		}
+		if (key != "") != test.expect {
+			t.Errorf("[%s] expect keyed %v, but got key %q", desc, test.expect, key)
+		}
+		if !test.expect && keyed != pod {
+			t.Errorf("[%s] expect the pod unchanged, but got %v", desc, keyed.Annotations)
+		}
+		if test.expect && keyed.Annotations[eciv1.AnnotationRolloutKey] != key {
+			t.Errorf("[%s] expect the key %q annotated, but got %v", desc, key, keyed.Annotations)
+		}
+	}
+}
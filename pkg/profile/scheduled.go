@@ -0,0 +1,151 @@
+package profile
+
+import (
+	"context"
+	"time"
+
+	"eci.io/eci-profile/pkg/policy"
+	"eci.io/eci-profile/pkg/utils"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	scheduledWorkers    = 4
+	maxScheduledRetries = 5
+	// recentScheduleWindow bounds the pods picked up on startup to those bound
+	// while eci-profile may have been down, older pods are left as they are.
+	recentScheduleWindow = 2 * time.Minute
+)
+
+func newScheduledQueue() workqueue.RateLimitingInterface {
+	return workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "scheduled-pods")
+}
+
+// enqueueScheduledPod queues the pods bound to a node, the effect is applied
+// after the binding has succeeded rather than while it is admitted. The pods
+// traced in the scheduled phase have been mutated already.
+func (m *Manager) enqueueScheduledPod(pod *v1.Pod) {
+	if pod.Spec.NodeName == "" || policy.IsTracedPhase(pod, policy.PhaseScheduled) {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(pod)
+	if err != nil {
+		klog.Errorf("failed to get key of pod %s/%s: %q", pod.Namespace, pod.Name, err)
+		return
+	}
+	m.scheduledQueue.Add(key)
+}
+
+// enqueueRecentlyScheduledPod queues the pods found bound to a node by the
+// informer, only if they were bound within the recent schedule window, so the
+// bindings missed on restart are applied without backfilling running pods.
+func (m *Manager) enqueueRecentlyScheduledPod(pod *v1.Pod, now time.Time) {
+	if pod.Spec.NodeName == "" || now.Sub(scheduledTime(pod)) > recentScheduleWindow {
+		return
+	}
+	m.enqueueScheduledPod(pod)
+}
+
+func (m *Manager) runScheduledWorkers(ctx context.Context) {
+	for i := 0; i < scheduledWorkers; i++ {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			for m.processNextScheduledPod(ctx) {
+			}
+		}, time.Second)
+	}
+	<-ctx.Done()
+	m.scheduledQueue.ShutDown()
+}
+
+func (m *Manager) processNextScheduledPod(ctx context.Context) bool {
+	key, quit := m.scheduledQueue.Get()
+	if quit {
+		return false
+	}
+	defer m.scheduledQueue.Done(key)
+
+	err := m.syncScheduledPod(ctx, key.(string))
+	if err == nil {
+		m.scheduledQueue.Forget(key)
+		return true
+	}
+	if m.scheduledQueue.NumRequeues(key) < maxScheduledRetries {
+		klog.Warningf("failed to execute scheduled policy for pod %s, retry it: %q", key, err)
+		m.scheduledQueue.AddRateLimited(key)
+		return true
+	}
+	klog.Errorf("failed to execute scheduled policy for pod %s, drop it: %q", key, err)
+	m.scheduledQueue.Forget(key)
+	return true
+}
+
+func (m *Manager) syncScheduledPod(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	pod, err := m.resourceManager.GetPod(namespace, name)
+	if err != nil {
+		if api_errors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to get pod")
+	}
+	if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil || policy.IsTracedPhase(pod, policy.PhaseScheduled) {
+		return nil
+	}
+	return m.onPodScheduled(ctx, pod)
+}
+
+func (m *Manager) onPodScheduled(ctx context.Context, pod *v1.Pod) error {
+	node, err := m.resourceManager.GetNode(pod.Spec.NodeName)
+	if err != nil {
+		klog.Warningf("find to check node details of %s for pod %s/%s: %v", pod.Spec.NodeName, pod.Namespace, pod.Name, err)
+		return err
+	}
+	if !m.policyManager.IsVirtualNode(node) {
+		return nil
+	}
+	// effect selectors for vnode pod
+	selector, warnings, err := m.matchSelectorForPod(pod)
+	if err != nil {
+		return errors.Wrap(err, "failed to match selector")
+	}
+	for _, warning := range warnings {
+		klog.V(3).Infof("pod %s/%s: %s", pod.Namespace, pod.Name, warning)
+	}
+	if selector == nil {
+		klog.V(3).Infof("no selector matched for pod %s/%s, skip it", pod.Namespace, pod.Name)
+		return nil
+	}
+	klog.Infof("pod %s/%s(%s) matched the selector %s(%s)", pod.Namespace, pod.Name, pod.UID, selector.Name, selector.UID)
+	selector, errs := m.renderEffect(selector, pod)
+	m.reportRenderErrors(selector, pod, errs, false)
+	patchOptions, err := m.policyManager.OnPodScheduled(selector, pod)
+	if err != nil {
+		klog.Warningf("execute policy for pod %s/%s failed: %v", pod.Namespace, pod.Name, err)
+		return err
+	}
+	if patchOptions == nil || patchOptions.IsEmpty() {
+		return nil
+	}
+	if isAuditMode(selector) {
+		m.auditPod(selector, pod, policy.PhaseScheduled, patchOptions, false)
+		return nil
+	}
+	if _, err := utils.PatchPod(ctx, m.k8sClient, pod.Namespace, pod.Name, *patchOptions); err != nil {
+		if api_errors.IsNotFound(err) {
+			return nil
+		}
+		klog.Errorf("failed to patch the pod %s/%s(%s): %q", pod.Namespace, pod.Name, pod.UID, err)
+		return err
+	}
+	klog.Infof("the pod %s/%s is scheduled to vnode (matched: %s)", pod.Namespace, pod.Name, selector.Name)
+	return nil
+}
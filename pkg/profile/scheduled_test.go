@@ -0,0 +1,36 @@
+package profile
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEnqueueRecentlyScheduledPod(t *testing.T) {
+	now := time.Now()
+	newPod := func(name, nodeName string, age time.Duration) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", CreationTimestamp: metav1.NewTime(now.Add(-age))},
+			Spec:       v1.PodSpec{NodeName: nodeName},
+			Status: v1.PodStatus{Conditions: []v1.PodCondition{{
+				Type:               v1.PodScheduled,
+				Status:             v1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(now.Add(-age)),
+			}}},
+		}
+	}
+	m := &Manager{scheduledQueue: newScheduledQueue()}
+	defer m.scheduledQueue.ShutDown()
+
+	m.enqueueRecentlyScheduledPod(newPod("running", "vnode", time.Hour), now)
+	m.enqueueRecentlyScheduledPod(newPod("pending", "", time.Second), now)
+	m.enqueueRecentlyScheduledPod(newPod("bound", "vnode", 10*time.Second), now)
+	if m.scheduledQueue.Len() != 1 {
+		t.Fatalf("expect only the recently bound pod queued, but got %d", m.scheduledQueue.Len())
+	}
+	if key, _ := m.scheduledQueue.Get(); key != "default/bound" {
+		t.Errorf("expect default/bound queued, but got %v", key)
+	}
+}
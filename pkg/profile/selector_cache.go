@@ -0,0 +1,130 @@
+package profile
+
+import (
+	"sync"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/expression"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// selectorCache caches what is compiled from the selectors, an entry is
+// rebuilt only when the generation of the selector changes.
+type selectorCache struct {
+	lock    sync.Mutex
+	entries map[types.UID]*selectorEntry
+}
+
+type selectorEntry struct {
+	generation   int64
+	condition    *expression.Program
+	conditionErr error
+	windows      []*activeWindow
+	windowsErr   error
+	invalid      error
+	// templates are parsed on demand and keyed by the effect value
+	templates    map[string]*expression.Template
+	templateErrs map[string]error
+}
+
+func newSelectorCache() *selectorCache {
+	return &selectorCache{entries: map[types.UID]*selectorEntry{}}
+}
+
+// entry must be called with the lock held.
+func (c *selectorCache) entry(selector *eciv1.Selector) *selectorEntry {
+	if entry, ok := c.entries[selector.UID]; ok && entry.generation == selector.Generation {
+		return entry
+	}
+	entry := &selectorEntry{
+		generation:   selector.Generation,
+		templates:    map[string]*expression.Template{},
+		templateErrs: map[string]error{},
+	}
+	if selector.Spec.MatchCondition != "" {
+		entry.condition, entry.conditionErr = expression.CompileBool(selector.Spec.MatchCondition)
+	}
+	entry.windows, entry.windowsErr = parseActiveWindows(selector.Spec.ActiveWindows)
+	entry.invalid = validateSelector(selector)
+	c.entries[selector.UID] = entry
+	return entry
+}
+
+// condition returns the compiled match condition of the selector, or nil when
+// the selector has no condition.
+func (c *selectorCache) condition(selector *eciv1.Selector) (*expression.Program, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry := c.entry(selector)
+	return entry.condition, entry.conditionErr
+}
+
+// windows returns the parsed active windows of the selector.
+func (c *selectorCache) windows(selector *eciv1.Selector) ([]*activeWindow, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry := c.entry(selector)
+	return entry.windows, entry.windowsErr
+}
+
+// validate returns the errors of the selector, the validating webhook ignores
+// its failures so that the selectors are validated again here.
+func (c *selectorCache) validate(selector *eciv1.Selector) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.entry(selector).invalid
+}
+
+// template returns the parsed template of an effect value of the selector.
+func (c *selectorCache) template(selector *eciv1.Selector, value string) (*expression.Template, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry := c.entry(selector)
+	if template, ok := entry.templates[value]; ok {
+		return template, nil
+	}
+	if err, ok := entry.templateErrs[value]; ok {
+		return nil, err
+	}
+	template, err := expression.ParseTemplate(value)
+	if err != nil {
+		entry.templateErrs[value] = err
+		return nil, err
+	}
+	entry.templates[value] = template
+	return template, nil
+}
+
+func (c *selectorCache) delete(selector *eciv1.Selector) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.entries, selector.UID)
+}
+
+// validateSelector reports the errors of the selector which would otherwise
+// only show up when a pod is admitted.
+func validateSelector(selector *eciv1.Selector) error {
+	if selector.Spec.MatchCondition != "" {
+		if _, err := expression.CompileBool(selector.Spec.MatchCondition); err != nil {
+			return err
+		}
+	}
+	if _, err := parseActiveWindows(selector.Spec.ActiveWindows); err != nil {
+		return err
+	}
+	if percent := selector.Spec.RolloutPercent; percent != nil && (*percent < 0 || *percent > 100) {
+		return errors.Errorf("rolloutPercent %d is out of [0, 100]", *percent)
+	}
+	switch selector.Spec.Mode {
+	case "", eciv1.SelectorModeEnforce, eciv1.SelectorModeAudit:
+	default:
+		return errors.Errorf("unknown mode %q", selector.Spec.Mode)
+	}
+	switch selector.Spec.DriftPolicy {
+	case "", eciv1.DriftPolicyAddMissing, eciv1.DriftPolicyEnforce:
+	default:
+		return errors.Errorf("unknown drift policy %q", selector.Spec.DriftPolicy)
+	}
+	return validateEffectTemplates(selector.Spec.Effect)
+}
@@ -0,0 +1,50 @@
+package profile
+
+import (
+	"testing"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSelectorCache(t *testing.T) {
+	cache := newSelectorCache()
+	selector := &eciv1.Selector{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: "uid", Generation: 1},
+		Spec: eciv1.SelectorSpec{
+			MatchCondition: `pod.metadata.name == "foo"`,
+			ActiveWindows:  []eciv1.ActiveWindow{{Start: "09:00", End: "18:00"}},
+		},
+	}
+	first, err := cache.condition(selector)
+	if err != nil || first == nil {
+		t.Fatalf("expect compiled condition, but got %v, %v", first, err)
+	}
+	second, _ := cache.condition(selector)
+	if first != second {
+		t.Errorf("expect the cached condition of the same generation")
+	}
+	if windows, err := cache.windows(selector); err != nil || len(windows) != 1 {
+		t.Errorf("expect 1 window, but got %v, %v", windows, err)
+	}
+
+	updated := selector.DeepCopy()
+	updated.Generation = 2
+	updated.Spec.MatchCondition = `pod.metadata.name ==`
+	updated.Spec.ActiveWindows = []eciv1.ActiveWindow{{Schedule: "0 9 * * *", Duration: &metav1.Duration{Duration: time.Hour}}}
+	if _, err := cache.condition(updated); err == nil {
+		t.Errorf("expect compile error of the new generation")
+	}
+	if windows, err := cache.windows(updated); err != nil || len(windows) != 1 || windows[0].schedule == nil {
+		t.Errorf("expect the cron window of the new generation, but got %v, %v", windows, err)
+	}
+
+	cache.delete(updated)
+	if len(cache.entries) != 0 {
+		t.Errorf("expect the entry to be deleted")
+	}
+	if program, err := cache.condition(&eciv1.Selector{}); program != nil || err != nil {
+		t.Errorf("expect no condition, but got %v, %v", program, err)
+	}
+}
@@ -0,0 +1,119 @@
+package profile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"eci.io/eci-profile/pkg/expression"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// renderEffect returns the selector whose effect values are rendered for the
+// pod, the keys failing to render are dropped rather than set to a broken value.
+func (m *Manager) renderEffect(selector *eciv1.Selector, pod *v1.Pod) (*eciv1.Selector, []error) {
+	effect := selector.Spec.Effect
+	if effect == nil || (!hasTemplate(effect.Annotations) && !hasTemplate(effect.Labels)) {
+		return selector, nil
+	}
+	namespace, err := m.resourceManager.GetNamespace(pod.Namespace)
+	if err != nil {
+		if !api_errors.IsNotFound(err) {
+			klog.Warningf("failed to get namespace of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+		namespace = nil
+	}
+	rendered := selector.DeepCopy()
+	annotations, annotationErrs := m.renderEntries(selector, pod, namespace, "annotation", effect.Annotations, nil)
+	labels, labelErrs := m.renderEntries(selector, pod, namespace, "label", effect.Labels, validation.IsValidLabelValue)
+	rendered.Spec.Effect.Annotations = annotations
+	rendered.Spec.Effect.Labels = labels
+	return rendered, append(annotationErrs, labelErrs...)
+}
+
+func (m *Manager) renderEntries(selector *eciv1.Selector, pod *v1.Pod, namespace *v1.Namespace, kind string, entries map[string]string, validate func(string) []string) (map[string]string, []error) {
+	if len(entries) == 0 {
+		return entries, nil
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	rendered := make(map[string]string, len(entries))
+	var errs []error
+	for _, key := range keys {
+		value := entries[key]
+		if !expression.IsTemplate(value) {
+			rendered[key] = value
+			continue
+		}
+		template, err := m.selectors.template(selector, value)
+		if err == nil {
+			value, err = template.Render(pod, namespace)
+		}
+		if err == nil && validate != nil {
+			if msgs := validate(value); len(msgs) > 0 {
+				err = errors.Errorf("invalid value %q: %s", value, strings.Join(msgs, "; "))
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("skip %s %s: %v", kind, key, err))
+			continue
+		}
+		rendered[key] = value
+	}
+	return rendered, errs
+}
+
+// reportRenderErrors records an Event for every skipped effect key, nothing is
+// recorded on a dry run. The errors are returned as the admission warnings.
+func (m *Manager) reportRenderErrors(selector *eciv1.Selector, pod *v1.Pod, errs []error, dryRun bool) []string {
+	var warnings []string
+	for _, err := range errs {
+		message := fmt.Sprintf("selector %s: %v", selector.Name, err)
+		klog.Warningf("pod %s/%s: %s", pod.Namespace, pod.Name, message)
+		warnings = append(warnings, message)
+		if dryRun {
+			continue
+		}
+		if pod.Name != "" {
+			m.eventRecorder.Event(pod, v1.EventTypeWarning, EventReasonEffectRenderFailed, message)
+		} else {
+			// the name of the pod is generated after admission
+			m.eventRecorder.Event(selector, v1.EventTypeWarning, EventReasonEffectRenderFailed, fmt.Sprintf("pod %s/%s*: %v", pod.Namespace, pod.GenerateName, err))
+		}
+	}
+	return warnings
+}
+
+func hasTemplate(entries map[string]string) bool {
+	for _, value := range entries {
+		if expression.IsTemplate(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateEffectTemplates(effect *eciv1.SideEffect) error {
+	if effect == nil {
+		return nil
+	}
+	for _, entries := range []map[string]string{effect.Annotations, effect.Labels} {
+		for key, value := range entries {
+			if !expression.IsTemplate(value) {
+				continue
+			}
+			if _, err := expression.ParseTemplate(value); err != nil {
+				return errors.Wrapf(err, "invalid template of effect key %s", key)
+			}
+		}
+	}
+	return nil
+}
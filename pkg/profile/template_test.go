@@ -0,0 +1,72 @@
+package profile
+
+import (
+	"reflect"
+	"testing"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestRenderEntries(t *testing.T) {
+	m := &Manager{selectors: newSelectorCache()}
+	selector := &eciv1.Selector{ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: "uid", Generation: 1}}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "pod",
+		Namespace:   "default",
+		Annotations: map[string]string{"owner": "team a"},
+	}}
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "default",
+		Annotations: map[string]string{"team/sg": "sg-123"},
+	}}
+	entries := map[string]string{
+		"static":  "true",
+		"sg":      `{{ namespaceObject.metadata.annotations["team/sg"] }}`,
+		"missing": `{{ namespaceObject.metadata.annotations["missing"] }}`,
+		"owner":   `{{ pod.metadata.annotations["owner"] }}`,
+	}
+
+	annotations, errs := m.renderEntries(selector, pod, namespace, "annotation", entries, nil)
+	expect := map[string]string{"static": "true", "sg": "sg-123", "owner": "team a"}
+	if !reflect.DeepEqual(annotations, expect) || len(errs) != 1 {
+		t.Errorf("expect annotations %v with 1 error, but got %v, %v", expect, annotations, errs)
+	}
+
+	// the rendered value isn't a valid label value
+	labels, errs := m.renderEntries(selector, pod, namespace, "label", entries, validation.IsValidLabelValue)
+	expect = map[string]string{"static": "true", "sg": "sg-123"}
+	if !reflect.DeepEqual(labels, expect) || len(errs) != 2 {
+		t.Errorf("expect labels %v with 2 errors, but got %v, %v", expect, labels, errs)
+	}
+}
+
+func TestValidateSelector(t *testing.T) {
+	for desc, test := range map[string]struct {
+		spec      eciv1.SelectorSpec
+		expectErr bool
+	}{
+		"empty": {},
+		"valid": {
+			spec: eciv1.SelectorSpec{
+				MatchCondition: `pod.metadata.name == "foo"`,
+				Effect:         &eciv1.SideEffect{Annotations: map[string]string{"foo": "{{ pod.metadata.name }}"}},
+			},
+		},
+		"invalid condition": {
+			spec:      eciv1.SelectorSpec{MatchCondition: `pod.metadata.name ==`},
+			expectErr: true,
+		},
+		"invalid template": {
+			spec:      eciv1.SelectorSpec{Effect: &eciv1.SideEffect{Labels: map[string]string{"foo": "{{ pod.metadata.name"}}},
+			expectErr: true,
+		},
+	} {
+		err := validateSelector(&eciv1.Selector{Spec: test.spec})
+		if (err != nil) != test.expectErr {
+			t.Errorf("%s: expect error %v, but got %v", desc, test.expectErr, err)
+		}
+	}
+}
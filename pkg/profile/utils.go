@@ -1,6 +1,8 @@
 package profile
 
 import (
+	"time"
+
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
 )
@@ -26,3 +28,40 @@ func isUnscheduledPod(pod *v1.Pod) bool {
 
 	return false
 }
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// unschedulableCondition returns the PodScheduled condition of the
+// unschedulable pod, or nil if the pod isn't unschedulable.
+func unschedulableCondition(pod *v1.Pod) *v1.PodCondition {
+	for i := range pod.Status.Conditions {
+		condition := &pod.Status.Conditions[i]
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Reason == v1.PodReasonUnschedulable {
+			return condition
+		}
+	}
+	return nil
+}
+
+// unschedulableSince returns when the pod became unschedulable.
+func unschedulableSince(pod *v1.Pod) (time.Time, bool) {
+	condition := unschedulableCondition(pod)
+	if condition == nil || condition.LastTransitionTime.IsZero() {
+		return time.Time{}, false
+	}
+	return condition.LastTransitionTime.Time, true
+}
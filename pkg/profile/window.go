@@ -0,0 +1,179 @@
+package profile
+
+import (
+	"strings"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+)
+
+// windowLookahead bounds the search of the next activation.
+const windowLookahead = 366 * 24 * time.Hour
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// activeWindow is a parsed window, it yields the intervals in which the
+// selector is active.
+type activeWindow struct {
+	location *time.Location
+	// schedule and duration of cron windows
+	schedule cron.Schedule
+	duration time.Duration
+	// days, start and end of time ranges, the times are minutes of the day
+	days  map[time.Weekday]bool
+	start int
+	end   int
+}
+
+func parseActiveWindows(windows []eciv1.ActiveWindow) ([]*activeWindow, error) {
+	var result []*activeWindow
+	for i := range windows {
+		window, err := parseActiveWindow(&windows[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid active window %d", i)
+		}
+		result = append(result, window)
+	}
+	return result, nil
+}
+
+func parseActiveWindow(window *eciv1.ActiveWindow) (*activeWindow, error) {
+	location := time.UTC
+	if window.TimeZone != "" {
+		loc, err := time.LoadLocation(window.TimeZone)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid time zone %q", window.TimeZone)
+		}
+		location = loc
+	}
+	result := &activeWindow{location: location}
+	if window.Schedule != "" {
+		if window.Start != "" || window.End != "" || len(window.Days) > 0 {
+			return nil, errors.New("schedule can't be used together with days, start or end")
+		}
+		schedule, err := cron.ParseStandard(window.Schedule)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid schedule %q", window.Schedule)
+		}
+		if window.Duration == nil || window.Duration.Duration <= 0 {
+			return nil, errors.New("a positive duration is required by schedule")
+		}
+		result.schedule = schedule
+		result.duration = window.Duration.Duration
+		return result, nil
+	}
+	if window.Start == "" || window.End == "" {
+		return nil, errors.New("either schedule or start and end is required")
+	}
+	start, err := parseClock(window.Start)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(window.End)
+	if err != nil {
+		return nil, err
+	}
+	result.start, result.end = start, end
+	if len(window.Days) > 0 {
+		result.days = map[time.Weekday]bool{}
+		for _, day := range window.Days {
+			weekday, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				return nil, errors.Errorf("invalid day %q", day)
+			}
+			result.days[weekday] = true
+		}
+	}
+	return result, nil
+}
+
+// parseClock parses HH:MM into the minutes of the day.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, errors.Errorf("invalid time %q, expect HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// isActive reports whether now is within any interval of the window, the
+// intervals include their starts but not their ends.
+func (w *activeWindow) isActive(now time.Time) bool {
+	now = now.In(w.location)
+	if w.schedule != nil {
+		// the schedule has no previous time, look for a start since now-duration
+		start := w.schedule.Next(now.Add(-w.duration))
+		return !start.IsZero() && !start.After(now)
+	}
+	// the range may have started yesterday and crossed midnight
+	for offset := 0; offset >= -1; offset-- {
+		start, end := w.rangeOfDay(now.AddDate(0, 0, offset))
+		if w.days != nil && !w.days[start.Weekday()] {
+			continue
+		}
+		if !start.After(now) && now.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextStart returns the start of the first interval after now.
+func (w *activeWindow) nextStart(now time.Time) (time.Time, bool) {
+	now = now.In(w.location)
+	if w.schedule != nil {
+		next := w.schedule.Next(now)
+		if next.IsZero() || next.Sub(now) > windowLookahead {
+			return time.Time{}, false
+		}
+		return next, true
+	}
+	for offset := 0; offset <= 7; offset++ {
+		start, _ := w.rangeOfDay(now.AddDate(0, 0, offset))
+		if w.days != nil && !w.days[start.Weekday()] {
+			continue
+		}
+		if start.After(now) {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (w *activeWindow) rangeOfDay(day time.Time) (time.Time, time.Time) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), w.start/60, w.start%60, 0, 0, w.location)
+	end := time.Date(day.Year(), day.Month(), day.Day(), w.end/60, w.end%60, 0, 0, w.location)
+	if w.end <= w.start {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+// windowState tells whether any of the windows is active at now, and when the
+// next window starts. No windows means always active.
+func windowState(windows []*activeWindow, now time.Time) (bool, *time.Time) {
+	if len(windows) == 0 {
+		return true, nil
+	}
+	active := false
+	var next *time.Time
+	for _, window := range windows {
+		if window.isActive(now) {
+			active = true
+		}
+		if start, ok := window.nextStart(now); ok && (next == nil || start.Before(*next)) {
+			next = &start
+		}
+	}
+	return active, next
+}
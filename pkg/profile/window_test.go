@@ -0,0 +1,113 @@
+package profile
+
+import (
+	"testing"
+	"time"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseActiveWindows(t *testing.T) {
+	hour := &metav1.Duration{Duration: time.Hour}
+	for desc, test := range map[string]struct {
+		window    eciv1.ActiveWindow
+		expectErr bool
+	}{
+		"cron":              {window: eciv1.ActiveWindow{Schedule: "0 9 * * 1-5", Duration: hour}},
+		"range":             {window: eciv1.ActiveWindow{Days: []string{"Mon", "sat"}, Start: "22:00", End: "06:00", TimeZone: "Asia/Shanghai"}},
+		"invalid cron":      {window: eciv1.ActiveWindow{Schedule: "0 9 *", Duration: hour}, expectErr: true},
+		"missing duration":  {window: eciv1.ActiveWindow{Schedule: "0 9 * * *"}, expectErr: true},
+		"cron with range":   {window: eciv1.ActiveWindow{Schedule: "0 9 * * *", Duration: hour, Start: "09:00"}, expectErr: true},
+		"missing end":       {window: eciv1.ActiveWindow{Start: "09:00"}, expectErr: true},
+		"invalid time":      {window: eciv1.ActiveWindow{Start: "9am", End: "18:00"}, expectErr: true},
+		"invalid day":       {window: eciv1.ActiveWindow{Days: []string{"Monday"}, Start: "09:00", End: "18:00"}, expectErr: true},
+		"invalid time zone": {window: eciv1.ActiveWindow{Start: "09:00", End: "18:00", TimeZone: "Mars/Base"}, expectErr: true},
+	} {
+		_, err := parseActiveWindows([]eciv1.ActiveWindow{test.window})
+		if (err != nil) != test.expectErr {
+			t.Errorf("%s: expect error %v, but got %v", desc, test.expectErr, err)
+		}
+	}
+}
+
+func TestWindowState(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("time zone database is unavailable: %v", err)
+	}
+	// 2024-01-01 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, shanghai)
+	}
+	ptr := func(t time.Time) *time.Time { return &t }
+	workHours := eciv1.ActiveWindow{Days: []string{"Mon", "Tue", "Wed", "Thu", "Fri"}, Start: "09:00", End: "18:00", TimeZone: "Asia/Shanghai"}
+	night := eciv1.ActiveWindow{Days: []string{"Fri"}, Start: "22:00", End: "02:00", TimeZone: "Asia/Shanghai"}
+	peak := eciv1.ActiveWindow{Schedule: "30 11 * * *", Duration: &metav1.Duration{Duration: 2 * time.Hour}, TimeZone: "Asia/Shanghai"}
+
+	for desc, test := range map[string]struct {
+		windows      []eciv1.ActiveWindow
+		now          time.Time
+		expectActive bool
+		expectNext   *time.Time
+	}{
+		"no windows": {
+			now:          at(1, 0, 0),
+			expectActive: true,
+		},
+		"within work hours": {
+			windows:      []eciv1.ActiveWindow{workHours},
+			now:          at(1, 9, 0),
+			expectActive: true,
+			expectNext:   ptr(at(2, 9, 0)),
+		},
+		"after work hours": {
+			windows:      []eciv1.ActiveWindow{workHours},
+			now:          at(1, 18, 0),
+			expectActive: false,
+			expectNext:   ptr(at(2, 9, 0)),
+		},
+		"weekend": {
+			windows:      []eciv1.ActiveWindow{workHours},
+			now:          at(6, 12, 0),
+			expectActive: false,
+			expectNext:   ptr(at(8, 9, 0)),
+		},
+		"crossing midnight": {
+			windows:      []eciv1.ActiveWindow{night},
+			now:          at(6, 1, 0),
+			expectActive: true,
+			expectNext:   ptr(at(12, 22, 0)),
+		},
+		"cron window": {
+			windows:      []eciv1.ActiveWindow{peak},
+			now:          at(1, 13, 29),
+			expectActive: true,
+			expectNext:   ptr(at(2, 11, 30)),
+		},
+		"cron window ended": {
+			windows:      []eciv1.ActiveWindow{peak},
+			now:          at(1, 13, 30),
+			expectActive: false,
+			expectNext:   ptr(at(2, 11, 30)),
+		},
+		"earliest next activation": {
+			windows:      []eciv1.ActiveWindow{workHours, peak},
+			now:          at(1, 8, 0),
+			expectActive: false,
+			expectNext:   ptr(at(1, 9, 0)),
+		},
+	} {
+		windows, err := parseActiveWindows(test.windows)
+		if err != nil {
+			t.Fatalf("%s: failed to parse windows: %v", desc, err)
+		}
+		active, next := windowState(windows, test.now)
+		if active != test.expectActive {
+			t.Errorf("%s: expect active %v, but got %v", desc, test.expectActive, active)
+		}
+		if (next == nil) != (test.expectNext == nil) || (next != nil && !next.Equal(*test.expectNext)) {
+			t.Errorf("%s: expect next activation %v, but got %v", desc, test.expectNext, next)
+		}
+	}
+}
@@ -7,34 +7,61 @@ import (
 	"eci.io/eci-profile/pkg/client/clientset/versioned"
 	"eci.io/eci-profile/pkg/client/informers/externalversions"
 	listereciv1 "eci.io/eci-profile/pkg/client/listers/eci/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	listerbatchv1 "k8s.io/client-go/listers/batch/v1"
 	listercorev1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 )
 
+// podEventIndex indexes the events by the UID of the pod they involve.
+const podEventIndex = "involvedObject.uid"
+
 type Manager struct {
 	coreV1InformerFactory  informers.SharedInformerFactory
+	eventInformerFactory   informers.SharedInformerFactory
 	profileInformerFactory externalversions.SharedInformerFactory
 	podInformer            cache.SharedIndexInformer
 	nodeInformer           cache.SharedIndexInformer
 	nsInformer             cache.SharedIndexInformer
 	selectorInformer       cache.SharedIndexInformer
 	rqInformer             cache.SharedIndexInformer
+	budgetInformer         cache.SharedIndexInformer
+	eventInformer          cache.SharedIndexInformer
+	jobInformer            cache.SharedIndexInformer
 	podLister              listercorev1.PodLister
 	nodeLister             listercorev1.NodeLister
 	nsLister               listercorev1.NamespaceLister
 	selectorLister         listereciv1.SelectorLister
 	rqLister               listercorev1.ResourceQuotaLister
+	budgetLister           listereciv1.VirtualNodeBudgetLister
+	jobLister              listerbatchv1.JobLister
 }
 
-func NewManager(k8sClient *kubernetes.Clientset, profileClient *versioned.Clientset) *Manager {
+func NewManager(k8sClient kubernetes.Interface, profileClient versioned.Interface) *Manager {
 	coreV1InformerFactory := informers.NewSharedInformerFactory(k8sClient, 30*time.Second)
 	profileInformerFactory := externalversions.NewSharedInformerFactory(profileClient, 30*time.Second)
+	// only the events of the pods are watched
+	eventInformerFactory := informers.NewSharedInformerFactoryWithOptions(k8sClient, 30*time.Second,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("involvedObject.kind", "Pod").String()
+		}))
+	eventInformer := eventInformerFactory.Core().V1().Events().Informer()
+	eventInformer.AddIndexers(cache.Indexers{podEventIndex: func(obj interface{}) ([]string, error) {
+		event, ok := obj.(*v1.Event)
+		if !ok {
+			return nil, nil
+		}
+		return []string{string(event.InvolvedObject.UID)}, nil
+	}})
 	return &Manager{
 		coreV1InformerFactory:  coreV1InformerFactory,
+		eventInformerFactory:   eventInformerFactory,
 		profileInformerFactory: profileInformerFactory,
 		podInformer:            coreV1InformerFactory.Core().V1().Pods().Informer(),
 		nodeInformer:           coreV1InformerFactory.Core().V1().Nodes().Informer(),
@@ -44,14 +71,20 @@ func NewManager(k8sClient *kubernetes.Clientset, profileClient *versioned.Client
 		nodeLister:             coreV1InformerFactory.Core().V1().Nodes().Lister(),
 		nsLister:               coreV1InformerFactory.Core().V1().Namespaces().Lister(),
 		rqLister:               coreV1InformerFactory.Core().V1().ResourceQuotas().Lister(),
+		jobInformer:            coreV1InformerFactory.Batch().V1().Jobs().Informer(),
+		jobLister:              coreV1InformerFactory.Batch().V1().Jobs().Lister(),
 		selectorInformer:       profileInformerFactory.Eci().V1().Selectors().Informer(),
 		selectorLister:         profileInformerFactory.Eci().V1().Selectors().Lister(),
+		budgetInformer:         profileInformerFactory.Eci().V1().VirtualNodeBudgets().Informer(),
+		budgetLister:           profileInformerFactory.Eci().V1().VirtualNodeBudgets().Lister(),
+		eventInformer:          eventInformer,
 	}
 }
 
 func (m *Manager) Run(stopChan <-chan struct{}) {
 	go m.coreV1InformerFactory.Start(stopChan)
 	go m.profileInformerFactory.Start(stopChan)
+	go m.eventInformerFactory.Start(stopChan)
 }
 
 func (m *Manager) HasSynced() bool {
@@ -59,7 +92,10 @@ func (m *Manager) HasSynced() bool {
 		m.nodeInformer.HasSynced() &&
 		m.nsInformer.HasSynced() &&
 		m.rqInformer.HasSynced() &&
-		m.selectorInformer.HasSynced()
+		m.selectorInformer.HasSynced() &&
+		m.budgetInformer.HasSynced() &&
+		m.eventInformer.HasSynced() &&
+		m.jobInformer.HasSynced()
 }
 
 func (m *Manager) AddPodEventHandler(handler cache.ResourceEventHandler) {
@@ -101,6 +137,25 @@ func (m *Manager) GetPod(namespace, name string) (*v1.Pod, error) {
 	return m.podLister.Pods(namespace).Get(name)
 }
 
+// ListPodEvents returns the cached events involving the pod.
+func (m *Manager) ListPodEvents(pod *v1.Pod) ([]*v1.Event, error) {
+	objects, err := m.eventInformer.GetIndexer().ByIndex(podEventIndex, string(pod.UID))
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*v1.Event, 0, len(objects))
+	for _, obj := range objects {
+		if event, ok := obj.(*v1.Event); ok {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (m *Manager) GetJob(namespace, name string) (*batchv1.Job, error) {
+	return m.jobLister.Jobs(namespace).Get(name)
+}
+
 func (m *Manager) ListSelectors() ([]*eciv1.Selector, error) {
 	return m.selectorLister.List(labels.Everything())
 }
@@ -109,6 +164,10 @@ func (m *Manager) GetSelector(name string) (*eciv1.Selector, error) {
 	return m.selectorLister.Get(name)
 }
 
+func (m *Manager) ListVirtualNodeBudgets() ([]*eciv1.VirtualNodeBudget, error) {
+	return m.budgetLister.List(labels.Everything())
+}
+
 func (m *Manager) ListNamespaces() ([]*v1.Namespace, error) {
 	return m.nsLister.List(labels.Everything())
 }
@@ -31,6 +31,14 @@ func (o *PatchOption) WithAnnotations(annotations map[string]string) *PatchOptio
 	return o
 }
 
+func (o *PatchOption) WithAnnotation(key, value string) *PatchOption {
+	if o.Metadata.Annotations == nil {
+		o.Metadata.Annotations = map[string]string{}
+	}
+	o.Metadata.Annotations[key] = value
+	return o
+}
+
 func (o *PatchOption) WithLabels(labels map[string]string) *PatchOption {
 	if len(labels) > 0 {
 		o.Metadata.Labels = labels
@@ -43,7 +51,11 @@ func (o *PatchOption) WithTolerations(tolerations []v1.Toleration) *PatchOption
 	return o
 }
 
-func PatchPod(ctx context.Context, k8sClient *kubernetes.Clientset, namespace, name string, option PatchOption) (*v1.Pod, error) {
+func (o *PatchOption) IsEmpty() bool {
+	return len(o.Metadata.Annotations) == 0 && len(o.Metadata.Labels) == 0 && len(o.Spec.Tolerations) == 0
+}
+
+func PatchPod(ctx context.Context, k8sClient kubernetes.Interface, namespace, name string, option PatchOption) (*v1.Pod, error) {
 	payload, err := json.Marshal(option)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// PodRequests returns the effective requests of the pod, i.e. the larger one
+// of the sum of the containers and any init container, plus the overhead.
+func PodRequests(pod *v1.Pod) v1.ResourceList {
+	return podResources(pod, func(requirements v1.ResourceRequirements) v1.ResourceList {
+		return requirements.Requests
+	})
+}
+
+// PodLimits returns the effective limits of the pod as PodRequests does.
+func PodLimits(pod *v1.Pod) v1.ResourceList {
+	return podResources(pod, func(requirements v1.ResourceRequirements) v1.ResourceList {
+		return requirements.Limits
+	})
+}
+
+func podResources(pod *v1.Pod, get func(v1.ResourceRequirements) v1.ResourceList) v1.ResourceList {
+	result := v1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResourceList(result, get(container.Resources))
+	}
+	for _, container := range pod.Spec.InitContainers {
+		for name, quantity := range get(container.Resources) {
+			if value, ok := result[name]; !ok || quantity.Cmp(value) > 0 {
+				result[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	addResourceList(result, pod.Spec.Overhead)
+	return result
+}
+
+func addResourceList(list, added v1.ResourceList) {
+	for name, quantity := range added {
+		if value, ok := list[name]; ok {
+			value.Add(quantity)
+			list[name] = value
+		} else {
+			list[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+// PodQOSClass computes the QoS class of the pod from its spec, the status
+// isn't filled when the pod is being created.
+func PodQOSClass(pod *v1.Pod) v1.PodQOSClass {
+	requests := v1.ResourceList{}
+	limits := v1.ResourceList{}
+	zero := resource.MustParse("0")
+	isGuaranteed := true
+	containers := append(append([]v1.Container{}, pod.Spec.Containers...), pod.Spec.InitContainers...)
+	for _, container := range containers {
+		for name, quantity := range container.Resources.Requests {
+			if !isQOSResource(name) || quantity.Cmp(zero) <= 0 {
+				continue
+			}
+			addResourceList(requests, v1.ResourceList{name: quantity})
+		}
+		limitsFound := map[v1.ResourceName]bool{}
+		for name, quantity := range container.Resources.Limits {
+			if !isQOSResource(name) || quantity.Cmp(zero) <= 0 {
+				continue
+			}
+			limitsFound[name] = true
+			addResourceList(limits, v1.ResourceList{name: quantity})
+		}
+		if !limitsFound[v1.ResourceCPU] || !limitsFound[v1.ResourceMemory] {
+			isGuaranteed = false
+		}
+	}
+	if len(requests) == 0 && len(limits) == 0 {
+		return v1.PodQOSBestEffort
+	}
+	if isGuaranteed {
+		for name, request := range requests {
+			if limit, ok := limits[name]; !ok || limit.Cmp(request) != 0 {
+				isGuaranteed = false
+				break
+			}
+		}
+	}
+	if isGuaranteed && len(requests) == len(limits) {
+		return v1.PodQOSGuaranteed
+	}
+	return v1.PodQOSBurstable
+}
+
+func isQOSResource(name v1.ResourceName) bool {
+	return name == v1.ResourceCPU || name == v1.ResourceMemory
+}
@@ -32,31 +32,33 @@ type admitv1beta1Func func(admissionv1beta1.AdmissionReview) *admissionv1beta1.A
 // admitv1beta1Func handles a v1 admission
 type admitv1Func func(admissionv1.AdmissionReview) *admissionv1.AdmissionResponse
 
-type MutatePodFunc func(pod *v1.Pod, nodeName string) ([]policy.PatchInfo, error)
-type MutateBindingFunc func(pod *v1.Pod, nodeName string) error
+// MutatePodFunc computes the patches and the admission warnings of a creating
+// pod, it must not write anything when dryRun is set.
+type MutatePodFunc func(pod *v1.Pod, nodeName string, dryRun bool) ([]policy.PatchInfo, []string, error)
 
 type Config struct {
-	K8sClient         *kubernetes.Clientset
-	MutatePodFunc     MutatePodFunc
-	MutateBindingFunc MutateBindingFunc
-	CACertPath        string
-	CAKeyPath         string
+	K8sClient     kubernetes.Interface
+	MutatePodFunc MutatePodFunc
+	// ValidateSelectorFunc rejects the invalid selectors, it's optional
+	ValidateSelectorFunc ValidateSelectorFunc
+	CACertPath           string
+	CAKeyPath            string
 }
 
 type Server struct {
 	isSupportAdmissionV1 bool
-	k8sClient            *kubernetes.Clientset
+	k8sClient            kubernetes.Interface
 	mutatingName         string
 	serverPath           string
 	serverPort           int32
 	certIssuer           *cert.Issuer
 	mutatePodFunc        MutatePodFunc
-	mutateBindingFunc    MutateBindingFunc
+	validateSelectorFunc ValidateSelectorFunc
 }
 
 func NewServer(config *Config) (*Server, error) {
 	isSupportAdmissionV1 := true
-	serverVersion, err := config.K8sClient.DiscoveryClient.ServerVersion()
+	serverVersion, err := config.K8sClient.Discovery().ServerVersion()
 	if err != nil {
 		return nil, errors.Wrap(err, "get cluster ServerVersion failed")
 	}
@@ -102,7 +104,7 @@ func NewServer(config *Config) (*Server, error) {
 		serverPath:           "/inject",
 		serverPort:           443,
 		mutatePodFunc:        config.MutatePodFunc,
-		mutateBindingFunc:    config.MutateBindingFunc,
+		validateSelectorFunc: config.ValidateSelectorFunc,
 	}, nil
 }
 
@@ -113,6 +115,13 @@ func (s *Server) Run(ctx context.Context) error {
 		return errors.Wrap(err, "failed to register webhook")
 	}
 	klog.Info("register mutating webhook successfully")
+	if s.validateSelectorFunc != nil {
+		if err := s.registerValidatingWebhook(ctx); err != nil {
+			klog.Errorf("failed to register validating webhook: %q", err)
+			return errors.Wrap(err, "failed to register validating webhook")
+		}
+		klog.Info("register validating webhook successfully")
+	}
 
 	hosts := []string{s.mutatingName,
 		fmt.Sprintf("%s.kube-system", s.mutatingName),
@@ -132,6 +141,7 @@ func (s *Server) Run(ctx context.Context) error {
 		},
 	}
 	http.HandleFunc(s.serverPath, s.serveMutatingPod)
+	http.HandleFunc(validatingPath, s.serveValidatingSelector)
 	http.HandleFunc("/healthz", s.healthCheckHandle)
 
 	klog.Info("ready to start webhook http service")
@@ -142,6 +152,10 @@ func (s *Server) serveMutatingPod(w http.ResponseWriter, r *http.Request) {
 	serve(w, r, newDelegateToV1AdmitHandler(s.mutate))
 }
 
+func (s *Server) serveValidatingSelector(w http.ResponseWriter, r *http.Request) {
+	serve(w, r, newDelegateToV1AdmitHandler(s.validate))
+}
+
 func (s *Server) healthCheckHandle(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
@@ -241,9 +255,9 @@ func serve(w http.ResponseWriter, r *http.Request, admit admitHandler) {
 
 func (s *Server) mutate(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
 	req := ar.Request
-	klog.Infof("AdmissionReview for Kind=%v, Namespace=%v Name=%v UID=%v PatchOperation=%v UserInfo=%v Resource=%v, SubResource=%v",
-		req.Kind, req.Namespace, req.Name, req.UID, req.Operation, req.UserInfo, req.Resource, req.SubResource)
-	// for pod creating, check if created with nodeName
+	klog.Infof("AdmissionReview for Kind=%v, Namespace=%v Name=%v UID=%v PatchOperation=%v UserInfo=%v Resource=%v, SubResource=%v, DryRun=%v",
+		req.Kind, req.Namespace, req.Name, req.UID, req.Operation, req.UserInfo, req.Resource, req.SubResource, req.DryRun != nil && *req.DryRun)
+	// only pod creating is mutated, the effect of bound pods is applied after binding
 	podResource := metav1.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
 	if req.Resource != podResource {
 		klog.Errorf("Resource=%s, expect Resource %s", req.Resource.String(), podResource.String())
@@ -253,48 +267,27 @@ func (s *Server) mutate(ar admissionv1.AdmissionReview) *admissionv1.AdmissionRe
 	nodename := ""
 	pod := &v1.Pod{}
 	patchInfos := []policy.PatchInfo{}
+	var warnings []string
 	var err error
 
-	if req.SubResource == "binding" {
-		podBinding := &v1.Binding{}
+	if req.SubResource == "" {
 		deserializer := codecs.UniversalDeserializer()
-		if _, _, err := deserializer.Decode(req.Object.Raw, nil, podBinding); err != nil {
-			klog.Error(err)
-			return toV1AdmissionResponse(err)
-		}
-
-		pod, err = s.k8sClient.CoreV1().Pods(podBinding.Namespace).Get(context.Background(), podBinding.Name, metav1.GetOptions{})
-		if err != nil {
+		if _, _, err := deserializer.Decode(req.Object.Raw, nil, pod); err != nil {
 			klog.Error(err)
 			return toV1AdmissionResponse(err)
 		}
-		nodename = podBinding.Target.Name
-		err = s.mutateBindingFunc(pod, nodename)
+		nodename = pod.Spec.NodeName
+		pod.Namespace = req.Namespace
+		patchInfos, warnings, err = s.mutatePodFunc(pod, nodename, req.DryRun != nil && *req.DryRun)
 		if err != nil {
 			klog.Error(err)
 			return toV1AdmissionResponse(err)
 		}
 	}
 
-	if req.SubResource == "" {
-		deserializer := codecs.UniversalDeserializer()
-		if _, _, err := deserializer.Decode(req.Object.Raw, nil, pod); err != nil {
-			klog.Error(err)
-			return toV1AdmissionResponse(err)
-		}
-		if pod.Spec.NodeName != "" {
-			nodename = pod.Spec.NodeName
-			pod.Namespace = req.Namespace
-			patchInfos, err = s.mutatePodFunc(pod, nodename)
-			if err != nil {
-				klog.Error(err)
-				return toV1AdmissionResponse(err)
-			}
-		}
-	}
-
 	ret := &admissionv1.AdmissionResponse{
-		Allowed: true,
+		Allowed:  true,
+		Warnings: warnings,
 	}
 	if len(patchInfos) != 0 {
 		data, _ := json.Marshal(patchInfos)
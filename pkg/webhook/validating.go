@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	eciv1 "eci.io/eci-profile/pkg/apis/eci/v1"
+	"github.com/pkg/errors"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	api_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const validatingPath = "/validate-selector"
+
+// ValidateSelectorFunc reports the errors of a creating or updating selector.
+type ValidateSelectorFunc func(selector *eciv1.Selector) error
+
+func (s *Server) registerValidatingWebhook(ctx context.Context) error {
+	if s.isSupportAdmissionV1 {
+		return s.registerValidatingWebhookV1(ctx)
+	}
+	return s.registerValidatingWebhookV1beta1(ctx)
+}
+
+func (s *Server) registerValidatingWebhookV1(ctx context.Context) error {
+	client := s.k8sClient.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	webhookConfig := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: s.mutatingName,
+		},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{s.createV1ValidatingWebhook()},
+	}
+	if _, err := client.Get(ctx, s.mutatingName, metav1.GetOptions{}); err != nil {
+		if !api_errors.IsNotFound(err) {
+			klog.Warningf("[v1] get %q ValidatingWebhookConfiguration failed: %s", s.mutatingName, err)
+			return errors.Wrapf(err, "get '%s' validating admission failed", s.mutatingName)
+		}
+		klog.Infof("[v1] create %q ValidatingWebhookConfiguration ......", s.mutatingName)
+		if _, err := client.Create(ctx, webhookConfig, metav1.CreateOptions{}); err != nil {
+			klog.Errorf("[v1] create %q ValidatingWebhookConfiguration failed: %s", s.mutatingName, err)
+			return err
+		}
+		return nil
+	}
+	valueByte, _ := json.Marshal(webhookConfig.Webhooks)
+	patchData := fmt.Sprintf(`[{"op":"replace","path":"/webhooks","value": %s}]`, string(valueByte))
+	if _, err := client.Patch(ctx, s.mutatingName, types.JSONPatchType, []byte(patchData), metav1.PatchOptions{}); err != nil {
+		klog.Errorf("Error patching ValidatingWebhookConfiguration %q: %s", s.mutatingName, err)
+		return fmt.Errorf("error patching ValidatingWebhookConfiguration %q: %s", s.mutatingName, err)
+	}
+	klog.Infof("Patched ValidatingWebhookConfiguration %q ...", s.mutatingName)
+	return nil
+}
+
+func (s *Server) registerValidatingWebhookV1beta1(ctx context.Context) error {
+	client := s.k8sClient.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations()
+	webhookConfig := &admissionregistrationv1beta1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: s.mutatingName,
+		},
+		Webhooks: []admissionregistrationv1beta1.ValidatingWebhook{s.createV1beta1ValidatingWebhook()},
+	}
+	if _, err := client.Get(ctx, s.mutatingName, metav1.GetOptions{}); err != nil {
+		if !api_errors.IsNotFound(err) {
+			klog.Warningf("[v1beta1] get %q ValidatingWebhookConfiguration failed: %s", s.mutatingName, err)
+			return errors.Wrapf(err, "get '%s' validating admission failed", s.mutatingName)
+		}
+		klog.Infof("[v1beta1] create %q ValidatingWebhookConfiguration ......", s.mutatingName)
+		if _, err := client.Create(ctx, webhookConfig, metav1.CreateOptions{}); err != nil {
+			klog.Errorf("[v1beta1] create %q ValidatingWebhookConfiguration failed: %s", s.mutatingName, err)
+			return err
+		}
+		return nil
+	}
+	valueByte, _ := json.Marshal(webhookConfig.Webhooks)
+	patchData := fmt.Sprintf(`[{"op":"replace","path":"/webhooks","value": %s}]`, string(valueByte))
+	if _, err := client.Patch(ctx, s.mutatingName, types.JSONPatchType, []byte(patchData), metav1.PatchOptions{}); err != nil {
+		klog.Errorf("Error patching ValidatingWebhookConfiguration %q: %s", s.mutatingName, err)
+		return fmt.Errorf("error patching ValidatingWebhookConfiguration %q: %s", s.mutatingName, err)
+	}
+	klog.Infof("Patched ValidatingWebhookConfiguration %q ...", s.mutatingName)
+	return nil
+}
+
+// createV1ValidatingWebhook ignores the failures of the webhook, so that the
+// selectors are still manageable while eci-profile is down. The controller
+// validates the selectors again and ignores the invalid ones.
+func (s *Server) createV1ValidatingWebhook() admissionregistrationv1.ValidatingWebhook {
+	var (
+		sideEffectClass               = admissionregistrationv1.SideEffectClassNone
+		failurePolicy                 = admissionregistrationv1.Ignore
+		matchPolicy                   = admissionregistrationv1.Equivalent
+		timeoutSeconds          int32 = 5
+		admissionReviewVersions       = []string{"v1", "v1beta1"}
+		path                          = validatingPath
+		scope                         = admissionregistrationv1.AllScopes
+	)
+	return admissionregistrationv1.ValidatingWebhook{
+		Name: "selector.eci-profile.eci.aliyun.com",
+		ClientConfig: admissionregistrationv1.WebhookClientConfig{
+			CABundle: s.certIssuer.GetCAData(),
+			Service: &admissionregistrationv1.ServiceReference{
+				Namespace: "kube-system",
+				Name:      s.mutatingName,
+				Path:      &path,
+				Port:      &s.serverPort,
+			},
+		},
+		Rules: []admissionregistrationv1.RuleWithOperations{
+			{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{eciv1.SchemeGroupVersion.Group},
+					APIVersions: []string{eciv1.SchemeGroupVersion.Version},
+					Resources:   []string{"selectors"},
+					Scope:       &scope,
+				},
+			},
+		},
+		FailurePolicy:           &failurePolicy,
+		MatchPolicy:             &matchPolicy,
+		SideEffects:             &sideEffectClass,
+		TimeoutSeconds:          &timeoutSeconds,
+		AdmissionReviewVersions: admissionReviewVersions,
+	}
+}
+
+func (s *Server) createV1beta1ValidatingWebhook() admissionregistrationv1beta1.ValidatingWebhook {
+	var (
+		sideEffectClass               = admissionregistrationv1beta1.SideEffectClassNone
+		failurePolicy                 = admissionregistrationv1beta1.Ignore
+		matchPolicy                   = admissionregistrationv1beta1.Equivalent
+		timeoutSeconds          int32 = 5
+		admissionReviewVersions       = []string{"v1beta1"}
+		path                          = validatingPath
+		scope                         = admissionregistrationv1beta1.AllScopes
+	)
+	return admissionregistrationv1beta1.ValidatingWebhook{
+		Name: "selector.eci-profile.eci.aliyun.com",
+		ClientConfig: admissionregistrationv1beta1.WebhookClientConfig{
+			CABundle: s.certIssuer.GetCAData(),
+			Service: &admissionregistrationv1beta1.ServiceReference{
+				Namespace: "kube-system",
+				Name:      s.mutatingName,
+				Path:      &path,
+				Port:      &s.serverPort,
+			},
+		},
+		Rules: []admissionregistrationv1beta1.RuleWithOperations{
+			{
+				Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.Create, admissionregistrationv1beta1.Update},
+				Rule: admissionregistrationv1beta1.Rule{
+					APIGroups:   []string{eciv1.SchemeGroupVersion.Group},
+					APIVersions: []string{eciv1.SchemeGroupVersion.Version},
+					Resources:   []string{"selectors"},
+					Scope:       &scope,
+				},
+			},
+		},
+		FailurePolicy:           &failurePolicy,
+		MatchPolicy:             &matchPolicy,
+		SideEffects:             &sideEffectClass,
+		TimeoutSeconds:          &timeoutSeconds,
+		AdmissionReviewVersions: admissionReviewVersions,
+	}
+}
+
+func (s *Server) validate(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	req := ar.Request
+	klog.Infof("AdmissionReview for Kind=%v, Name=%v UID=%v Operation=%v UserInfo=%v",
+		req.Kind, req.Name, req.UID, req.Operation, req.UserInfo)
+	selector := &eciv1.Selector{}
+	if err := json.Unmarshal(req.Object.Raw, selector); err != nil {
+		klog.Error(err)
+		return toV1AdmissionResponse(err)
+	}
+	if s.validateSelectorFunc != nil {
+		if err := s.validateSelectorFunc(selector); err != nil {
+			klog.Warningf("selector %s is invalid: %v", selector.Name, err)
+			return toV1AdmissionResponse(errors.Wrapf(err, "selector %s is invalid", selector.Name))
+		}
+	}
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
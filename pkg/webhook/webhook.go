@@ -75,7 +75,16 @@ func (s *Server) registerMutatingWebhookV1beta1(ctx context.Context) error {
 			klog.Errorf("[v1] create %q MutatingWebhookConfiguration failed: %s", s.mutatingName, err)
 			return err
 		}
+		return nil
 	}
+	// keep the side effect class of existing configurations up to date, or dry runs are rejected
+	valueByte, _ := json.Marshal(webhookConfig.Webhooks)
+	patchData := fmt.Sprintf(`[{"op":"replace","path":"/webhooks","value": %s}]`, string(valueByte))
+	if _, err := client.Patch(ctx, s.mutatingName, types.JSONPatchType, []byte(patchData), metav1.PatchOptions{}); err != nil {
+		klog.Errorf("Error patching MutatingWebhookConfiguration %q: %s", s.mutatingName, err)
+		return fmt.Errorf("error patching MutatingWebhookConfiguration %q: %s", s.mutatingName, err)
+	}
+	klog.Infof("Patched MutatingWebhookConfiguration %q ...", s.mutatingName)
 	return nil
 }
 
@@ -105,7 +114,7 @@ func (s *Server) createV1MutatingWebhook(nsSelector, objectSelector *metav1.Labe
 			Rule: admissionregistrationv1.Rule{
 				APIGroups:   []string{""},
 				APIVersions: []string{"v1"},
-				Resources:   []string{"pods", "pods/binding"},
+				Resources:   []string{"pods"},
 				Scope: func() *admissionregistrationv1.ScopeType {
 					tmp := admissionregistrationv1.AllScopes
 					return &tmp
@@ -131,7 +140,7 @@ func (s *Server) createV1MutatingWebhook(nsSelector, objectSelector *metav1.Labe
 
 func (s *Server) createV1beta1MutatingWebhook(nsSelector, objectSelector *metav1.LabelSelector) admissionregistrationv1beta1.MutatingWebhook {
 	var (
-		defaultSideEffectClass               = admissionregistrationv1beta1.SideEffectClassUnknown
+		defaultSideEffectClass               = admissionregistrationv1beta1.SideEffectClassNoneOnDryRun
 		defaultFailurePolicy                 = admissionregistrationv1beta1.Ignore
 		defaultMatchPolicy                   = admissionregistrationv1beta1.Equivalent
 		defaultTimeoutSeconds          int32 = 5
@@ -155,7 +164,7 @@ func (s *Server) createV1beta1MutatingWebhook(nsSelector, objectSelector *metav1
 			Rule: admissionregistrationv1beta1.Rule{
 				APIGroups:   []string{""},
 				APIVersions: []string{"v1"},
-				Resources:   []string{"pods", "pods/binding"},
+				Resources:   []string{"pods"},
 				Scope: func() *admissionregistrationv1beta1.ScopeType {
 					tmp := admissionregistrationv1beta1.AllScopes
 					return &tmp
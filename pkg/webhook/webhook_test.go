@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"eci.io/eci-profile/pkg/cert"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestServer(t *testing.T, isSupportAdmissionV1 bool, client *fake.Clientset) *Server {
+	certIssuer, err := cert.NewIssuer(caCert, caKey)
+	if err != nil {
+		t.Fatalf("create cert issuer failed, err: %v", err)
+	}
+	return &Server{
+		isSupportAdmissionV1: isSupportAdmissionV1,
+		k8sClient:            client,
+		certIssuer:           certIssuer,
+		mutatingName:         mutatingName,
+		serverPath:           "/inject",
+		serverPort:           443,
+	}
+}
+
+func TestCreateMutatingWebhook(t *testing.T) {
+	s := newTestServer(t, true, fake.NewSimpleClientset())
+
+	v1Webhook := s.createV1MutatingWebhook(nil, nil)
+	if len(v1Webhook.Rules) != 1 {
+		t.Fatalf("expect one rule, but got %v", v1Webhook.Rules)
+	}
+	v1Rule := v1Webhook.Rules[0]
+	if !reflect.DeepEqual(v1Rule.Operations, []admissionregistrationv1.OperationType{admissionregistrationv1.Create}) ||
+		!reflect.DeepEqual(v1Rule.Resources, []string{"pods"}) {
+		t.Errorf("expect only the pod creating is mutated, but got %v", v1Rule)
+	}
+	if *v1Webhook.SideEffects != admissionregistrationv1.SideEffectClassNoneOnDryRun {
+		t.Errorf("expect the side effect class NoneOnDryRun, but got %s", *v1Webhook.SideEffects)
+	}
+
+	v1beta1Webhook := s.createV1beta1MutatingWebhook(nil, nil)
+	if len(v1beta1Webhook.Rules) != 1 {
+		t.Fatalf("expect one rule, but got %v", v1beta1Webhook.Rules)
+	}
+	v1beta1Rule := v1beta1Webhook.Rules[0]
+	if !reflect.DeepEqual(v1beta1Rule.Operations, []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.Create}) ||
+		!reflect.DeepEqual(v1beta1Rule.Resources, []string{"pods"}) {
+		t.Errorf("expect only the pod creating is mutated, but got %v", v1beta1Rule)
+	}
+	if *v1beta1Webhook.SideEffects != admissionregistrationv1beta1.SideEffectClassNoneOnDryRun {
+		t.Errorf("expect the side effect class NoneOnDryRun, but got %s", *v1beta1Webhook.SideEffects)
+	}
+}
+
+func TestRegisterMutatingWebhookV1beta1(t *testing.T) {
+	sideEffectClass := admissionregistrationv1beta1.SideEffectClassUnknown
+	existing := &admissionregistrationv1beta1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: mutatingName},
+		Webhooks: []admissionregistrationv1beta1.MutatingWebhook{{
+			Name: "autoscaler.eci.aliyun.com",
+			Rules: []admissionregistrationv1beta1.RuleWithOperations{{
+				Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.Create},
+				Rule: admissionregistrationv1beta1.Rule{
+					APIGroups:   []string{""},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"pods", "pods/binding"},
+				},
+			}},
+			SideEffects: &sideEffectClass,
+		}},
+	}
+	for desc, client := range map[string]*fake.Clientset{
+		"create":         fake.NewSimpleClientset(),
+		"patch existing": fake.NewSimpleClientset(existing),
+	} {
+		s := newTestServer(t, false, client)
+		if err := s.registerMutatingWebhook(context.TODO()); err != nil {
+			t.Fatalf("[%s] register mutating webhook failed, err: %v", desc, err)
+		}
+		config, err := client.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Get(context.TODO(), mutatingName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("[%s] get mutating webhook configuration failed, err: %v", desc, err)
+		}
+		if len(config.Webhooks) != 1 || !reflect.DeepEqual(config.Webhooks[0], s.createV1beta1MutatingWebhook(nil, nil)) {
+			t.Errorf("[%s] unexpected webhooks: %v", desc, config.Webhooks)
+		}
+		if _, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), mutatingName, metav1.GetOptions{}); err == nil {
+			t.Errorf("[%s] expect no v1 configuration on the cluster without admission v1", desc)
+		}
+	}
+}
+
+func TestRegisterMutatingWebhookV1(t *testing.T) {
+	legacy := &admissionregistrationv1beta1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: mutatingName}}
+	client := fake.NewSimpleClientset(legacy)
+	s := newTestServer(t, true, client)
+	if err := s.registerMutatingWebhook(context.TODO()); err != nil {
+		t.Fatalf("register mutating webhook failed, err: %v", err)
+	}
+	config, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), mutatingName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get mutating webhook configuration failed, err: %v", err)
+	}
+	if len(config.Webhooks) != 1 || !reflect.DeepEqual(config.Webhooks[0].Rules, s.createV1MutatingWebhook(nil, nil).Rules) {
+		t.Errorf("unexpected webhooks: %v", config.Webhooks)
+	}
+	if _, err := client.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Get(context.TODO(), mutatingName, metav1.GetOptions{}); err == nil {
+		t.Errorf("expect the v1beta1 configuration deleted")
+	}
+}